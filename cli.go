@@ -0,0 +1,1084 @@
+package main
+
+import (
+	"connect-a-thon/conatho"
+	"connect-a-thon/config"
+	"connect-a-thon/layout"
+	"connect-a-thon/svg"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type command struct {
+	Usage       string
+	Description string
+	Run         func(flags *flag.FlagSet, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"help": {
+			Usage:       "help",
+			Description: "Show the available commands",
+			Run:         runHelp,
+		},
+		"diff": {
+			Usage:       "diff old.conatho new.conatho",
+			Description: "List the entities, connections and attribute types that were added, removed or changed",
+			Run:         runDiff,
+		},
+		"merge": {
+			Usage:       "merge [-base base.conatho] [-resolve ours|theirs] [-dry-run] ours.conatho theirs.conatho",
+			Description: "Merge the changes made in a copy of a file, conflicts must be resolved with -resolve",
+			Run:         runMerge,
+		},
+		"snapshot": {
+			Usage:       "snapshot file.conatho name",
+			Description: "Store the current contents of the file as a named snapshot",
+			Run:         runSnapshot,
+		},
+		"snapshots": {
+			Usage:       "snapshots file.conatho",
+			Description: "List the snapshots of a file, the newest first",
+			Run:         runSnapshots,
+		},
+		"restore-snapshot": {
+			Usage:       "restore-snapshot file.conatho id",
+			Description: "Replace the contents of the file with a snapshot",
+			Run:         runRestoreSnapshot,
+		},
+		"branch-snapshot": {
+			Usage:       "branch-snapshot file.conatho id out.conatho",
+			Description: "Write a snapshot to a new file",
+			Run:         runBranchSnapshot,
+		},
+		"delete-snapshot": {
+			Usage:       "delete-snapshot file.conatho id",
+			Description: "Delete a snapshot",
+			Run:         runDeleteSnapshot,
+		},
+		"trash": {
+			Usage:       "trash file.conatho",
+			Description: "List the deleted entities and connections",
+			Run:         runTrash,
+		},
+		"restore": {
+			Usage:       "restore file.conatho id",
+			Description: "Restore a deleted entity, with its connections, or a deleted connection",
+			Run:         runRestore,
+		},
+		"empty-trash": {
+			Usage:       "empty-trash [-older-than days] file.conatho",
+			Description: "Permanently delete what is in the trash",
+			Run:         runEmptyTrash,
+		},
+		"compact": {
+			Usage:       "compact file.conatho",
+			Description: "Delete unused images and give free space back to the file system",
+			Run:         runCompact,
+		},
+		"regenerate-thumbnails": {
+			Usage:       "regenerate-thumbnails [-size n] file.conatho",
+			Description: "Make the thumbnails of all images again from the original images",
+			Run:         runRegenerateThumbnails,
+		},
+		"history": {
+			Usage:       "history [-days n] file.conatho [entity-id]",
+			Description: "List the recorded changes, of one entity or of the whole file",
+			Run:         runHistory,
+		},
+		"modified": {
+			Usage:       "modified [-days n] file.conatho",
+			Description: "List the entities and connections created or changed in the last days",
+			Run:         runModified,
+		},
+		"export-dot": {
+			Usage:       "export-dot [-attributes a,b] [-thumbnails dir] file.conatho [out.dot]",
+			Description: "Export the graph to Graphviz DOT",
+			Run:         runExportDOT,
+		},
+		"export-svg": {
+			Usage:       "export-svg [-select a,b] file.conatho [out.svg]",
+			Description: "Draw the canvas, or the selected entities, as an SVG image",
+			Run:         runExportSVG,
+		},
+		"export-graphml": {
+			Usage:       "export-graphml file.conatho [out.graphml]",
+			Description: "Export the graph to GraphML",
+			Run:         runExportGraphML,
+		},
+		"import-graphml": {
+			Usage:       "import-graphml [-dry-run] file.conatho in.graphml",
+			Description: "Import a GraphML file into a file",
+			Run:         runImportGraphML,
+		},
+		"export-json": {
+			Usage:       "export-json [-files dir] file.conatho [out.json]",
+			Description: "Export the file as a JSON document",
+			Run:         runExportJSON,
+		},
+		"import-json": {
+			Usage:       "import-json [-dry-run] [-files dir] file.conatho in.json",
+			Description: "Import a JSON document into a file",
+			Run:         runImportJSON,
+		},
+		"import-csv": {
+			Usage:       "import-csv [-dry-run] [-name column] [-key column] [-skip a,b] file.conatho in.csv",
+			Description: "Import entities from a CSV file, rows matching an entity on a unique key update it",
+			Run:         runImportCSV,
+		},
+		"import-csv-connections": {
+			Usage:       "import-csv-connections [-dry-run] -superior column -inferior column [-name column] [-match type] file.conatho in.csv",
+			Description: "Import connections from an edge list CSV file",
+			Run:         runImportCSVConnections,
+		},
+		"export-gedcom": {
+			Usage:       "export-gedcom file.conatho [out.ged]",
+			Description: "Export entities and parent connections as a GEDCOM 5.5 family tree",
+			Run:         runExportGEDCOM,
+		},
+		"import-gedcom": {
+			Usage:       "import-gedcom [-dry-run] file.conatho in.ged",
+			Description: "Import a GEDCOM 5.5 family tree, individuals imported before are updated",
+			Run:         runImportGEDCOM,
+		},
+		"export-archive": {
+			Usage:       "export-archive file.conatho [out.conatho.zip]",
+			Description: "Export the file as a zip archive with images and data as separate files",
+			Run:         runExportArchive,
+		},
+		"import-archive": {
+			Usage:       "import-archive [-dry-run] file.conatho in.conatho.zip",
+			Description: "Import a zip archive, into a new file it restores the original exactly",
+			Run:         runImportArchive,
+		},
+		"export-text": {
+			Usage:       "export-text [-blobs dir] file.conatho out.txt",
+			Description: "Export the file in the line based text format for version control",
+			Run:         runExportText,
+		},
+		"import-text": {
+			Usage:       "import-text [-dry-run] [-blobs dir] file.conatho in.txt",
+			Description: "Import a text document into a file",
+			Run:         runImportText,
+		},
+		"json-schema": {
+			Usage:       "json-schema",
+			Description: "Print the JSON schema of the document format",
+			Run:         runJSONSchema,
+		},
+	}
+}
+
+// Run the command if the first argument is one, returns false otherwise. A
+// single argument naming an existing file is opened even when it is also the
+// name of a command, "--" always opens the file after it.
+func runCommand(args []string) bool {
+	if len(args) == 0 || args[0] == "--" {
+		return false
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+
+	if len(args) == 1 {
+		if info, err := os.Stat(args[0]); err == nil && info.Mode().IsRegular() {
+			return false
+		}
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: connect-a-thon", cmd.Usage)
+		flags.PrintDefaults()
+	}
+
+	err := cmd.Run(flags, args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	return true
+}
+
+func runHelp(flags *flag.FlagSet, args []string) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("Usage: connect-a-thon [--] [file.conatho]")
+	fmt.Println("       connect-a-thon <command> [arguments]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, name := range names {
+		fmt.Printf("  %-20s %s\n", name, commands[name].Description)
+	}
+
+	return nil
+}
+
+// Open an existing file and load its contents
+func openConatho(fPath string) (*conatho.Conatho, error) {
+	_, err := os.Stat(fPath)
+	if err != nil {
+		return nil, err
+	}
+
+	con, err := conatho.New(fPath)
+	if err != nil {
+		return nil, err
+	}
+
+	con.Author = configAuthor()
+
+	err = con.EntityGetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	err = con.GetAttributeTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	return &con, nil
+}
+
+// Changes made from the command line are recorded under the author from the
+// user config
+func configAuthor() string {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Println("Could not load config:", err)
+	}
+	return cfg.AuthorName()
+}
+
+// Write the output file, stdout is used when the path is empty or "-". An
+// error closing the file is returned, the file may not have been written
+// completely.
+func writeOutput(fPath string, write func(w io.Writer) error) error {
+	if fPath == "" || fPath == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(fPath)
+	if err != nil {
+		return err
+	}
+
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	list := strings.Split(s, ",")
+	for i := range list {
+		list[i] = strings.TrimSpace(list[i])
+	}
+	return list
+}
+
+func runExportDOT(flags *flag.FlagSet, args []string) error {
+	attributes := flags.String("attributes", "", "comma separated attribute types to add to the labels")
+	thumbnails := flags.String("thumbnails", "", "directory to write thumbnails to")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(flags.Arg(1), func(out io.Writer) error {
+		return con.ExportDOT(out, conatho.DOTOptions{
+			Attributes:   splitList(*attributes),
+			ThumbnailDir: *thumbnails,
+		})
+	})
+}
+
+// Find entities by their ID or name
+func selectEntities(con *conatho.Conatho, list []string) ([]uuid.UUID, error) {
+	var selection []uuid.UUID
+	for _, item := range list {
+		if id, err := uuid.Parse(item); err == nil {
+			if _, ok := con.Entities[id]; ok {
+				selection = append(selection, id)
+				continue
+			}
+		}
+
+		found := false
+		for _, k := range con.EntitiesKeys {
+			if con.Entities[k].Name == item {
+				selection = append(selection, k)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no entity %q", item)
+		}
+	}
+	return selection, nil
+}
+
+func runExportSVG(flags *flag.FlagSet, args []string) error {
+	selectList := flags.String("select", "", "comma separated IDs or names of the entities to draw, defaults to all")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	selection, err := selectEntities(con, splitList(*selectList))
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(flags.Arg(1), func(out io.Writer) error {
+		return svg.Export(out, con, layout.Default(), svg.Options{Selection: selection})
+	})
+}
+
+func runExportGraphML(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(flags.Arg(1), func(out io.Writer) error {
+		return con.ExportGraphML(out)
+	})
+}
+
+func runExportGEDCOM(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(flags.Arg(1), func(out io.Writer) error {
+		return con.ExportGEDCOM(out)
+	})
+}
+
+func runImportGEDCOM(flags *flag.FlagSet, args []string) error {
+	return runImport(flags, args, (*conatho.Conatho).ImportGEDCOM)
+}
+
+// Open or create the file to import into and import the input file
+func runImport(flags *flag.FlagSet, args []string, importer func(con *conatho.Conatho, r io.Reader) (conatho.ImportReport, error)) error {
+	dryRun := flags.Bool("dry-run", false, "report what the import would do without changing the file")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errors.New("no files given")
+	}
+
+	con, err := conatho.New(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	con.Author = configAuthor()
+
+	err = con.EntityGetAll()
+	if err != nil {
+		return err
+	}
+
+	err = con.GetAttributeTypes()
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var report conatho.ImportReport
+	if *dryRun {
+		report, err = con.DryRun(func() (conatho.ImportReport, error) {
+			return importer(&con, in)
+		})
+	} else {
+		report, err = importer(&con, in)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(report)
+	return nil
+}
+
+func runImportGraphML(flags *flag.FlagSet, args []string) error {
+	return runImport(flags, args, (*conatho.Conatho).ImportGraphML)
+}
+
+func runExportJSON(flags *flag.FlagSet, args []string) error {
+	files := flags.String("files", "", "directory to write images and data to instead of embedding them")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(flags.Arg(1), func(out io.Writer) error {
+		if *files != "" {
+			return con.ExportWithFiles(out, *files)
+		}
+		return con.Export(out)
+	})
+}
+
+func runImportJSON(flags *flag.FlagSet, args []string) error {
+	files := flags.String("files", "", "directory images and data are read from, defaults to the directory of the document")
+
+	return runImport(flags, args, func(con *conatho.Conatho, r io.Reader) (conatho.ImportReport, error) {
+		dir := *files
+		if dir == "" {
+			dir = filepath.Dir(flags.Arg(1))
+		}
+		return con.ImportWithFiles(r, dir)
+	})
+}
+
+func runExportArchive(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(flags.Arg(1), func(out io.Writer) error {
+		return con.ExportArchive(out)
+	})
+}
+
+func runImportArchive(flags *flag.FlagSet, args []string) error {
+	return runImport(flags, args, (*conatho.Conatho).ImportArchive)
+}
+
+func runExportText(flags *flag.FlagSet, args []string) error {
+	blobs := flags.String("blobs", "", "directory to store images and data in, defaults to out.blobs")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errors.New("no files given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	blobDir := *blobs
+	if blobDir == "" {
+		blobDir = conatho.TextBlobDir(flags.Arg(1))
+	}
+
+	return writeOutput(flags.Arg(1), func(out io.Writer) error {
+		return con.ExportText(out, blobDir)
+	})
+}
+
+func runImportText(flags *flag.FlagSet, args []string) error {
+	blobs := flags.String("blobs", "", "directory images and data are read from, defaults to in.blobs")
+
+	return runImport(flags, args, func(con *conatho.Conatho, r io.Reader) (conatho.ImportReport, error) {
+		blobDir := *blobs
+		if blobDir == "" {
+			blobDir = conatho.TextBlobDir(flags.Arg(1))
+		}
+		return con.ImportText(r, blobDir)
+	})
+}
+
+func runDiff(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errors.New("no files given")
+	}
+
+	a, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	b, err := openConatho(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	changes, err := conatho.Diff(a, b)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(changes)
+	return nil
+}
+
+func runMerge(flags *flag.FlagSet, args []string) error {
+	basePath := flags.String("base", "", "the file both files were copied from, without it every difference is a conflict")
+	resolve := flags.String("resolve", "", "resolve all conflicts by keeping \"ours\" or taking \"theirs\"")
+	dryRun := flags.Bool("dry-run", false, "show what the merge would change without changing the file")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errors.New("no files given")
+	}
+
+	var resolution conatho.Resolution
+	switch *resolve {
+	case "", "ours":
+		resolution = conatho.KeepOurs
+	case "theirs":
+		resolution = conatho.TakeTheirs
+	default:
+		return fmt.Errorf("unknown resolution %q", *resolve)
+	}
+
+	ours, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	theirs, err := openConatho(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	var base *conatho.Conatho
+	if *basePath != "" {
+		base, err = openConatho(*basePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	merge, err := ours.PrepareMerge(theirs, base)
+	if err != nil {
+		return err
+	}
+
+	for i := range merge.Conflicts {
+		merge.Conflicts[i].Resolution = resolution
+		fmt.Println("Conflict:", merge.Conflicts[i])
+	}
+	for _, dropped := range merge.Dropped {
+		fmt.Println("Dropped:", dropped)
+	}
+
+	fmt.Print(merge.Changes())
+
+	if *dryRun {
+		fmt.Println("Dry run, nothing has been changed")
+		return nil
+	}
+	if len(merge.Conflicts) > 0 && *resolve == "" {
+		return fmt.Errorf("%d conflicts, choose -resolve ours or -resolve theirs, nothing has been changed", len(merge.Conflicts))
+	}
+
+	_, err = ours.ApplyMerge(merge)
+	return err
+}
+
+func runSnapshot(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errors.New("no name given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	id, err := con.CreateSnapshot(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Snapshot", id)
+	return nil
+}
+
+func runSnapshots(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := con.GetSnapshots()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range snapshots {
+		fmt.Printf("%d\t%s\t%s\n", s.ID, s.Created.Format("2006-01-02 15:04:05"), s.Name)
+	}
+	return nil
+}
+
+// Open the file and parse the snapshot ID following it
+func openSnapshot(flags *flag.FlagSet) (*conatho.Conatho, int64, error) {
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return nil, 0, errors.New("no snapshot given")
+	}
+
+	id, err := strconv.ParseInt(flags.Arg(1), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid snapshot %q", flags.Arg(1))
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return con, id, nil
+}
+
+func runRestoreSnapshot(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	con, id, err := openSnapshot(flags)
+	if err != nil {
+		return err
+	}
+
+	report, err := con.RestoreSnapshot(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(report)
+	return nil
+}
+
+func runBranchSnapshot(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	if flags.NArg() < 3 {
+		flags.Usage()
+		return errors.New("no output file given")
+	}
+
+	con, id, err := openSnapshot(flags)
+	if err != nil {
+		return err
+	}
+
+	branch, err := con.SnapshotToFile(id, flags.Arg(2))
+	if err != nil {
+		return err
+	}
+
+	return branch.Close()
+}
+
+func runDeleteSnapshot(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	con, id, err := openSnapshot(flags)
+	if err != nil {
+		return err
+	}
+
+	return con.DeleteSnapshot(id)
+}
+
+func runTrash(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	trash, err := con.GetTrash()
+	if err != nil {
+		return err
+	}
+
+	for _, te := range trash.Entities {
+		fmt.Printf("%s\t%s\tentity %q\n", te.ID, te.DeletedAt.Format("2006-01-02 15:04:05"), te.Name)
+	}
+	for _, tc := range trash.Connections {
+		fmt.Printf("%s\t%s\tconnection %q %q -> %q\n", tc.ID, tc.DeletedAt.Format("2006-01-02 15:04:05"),
+			tc.Name, tc.SuperiorName, tc.InferiorName)
+	}
+	return nil
+}
+
+func runRestore(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errors.New("no ID given")
+	}
+
+	id, err := uuid.Parse(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	err = con.RestoreEntity(id)
+	if errors.Is(err, conatho.ErrNotInTrash) {
+		err = con.RestoreConnection(id)
+	}
+	return err
+}
+
+func runEmptyTrash(flags *flag.FlagSet, args []string) error {
+	days := flags.Int("older-than", 0, "only delete what has been in the trash for this many days")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var n int64
+	if *days > 0 {
+		n, err = con.PurgeTrash(time.Now().AddDate(0, 0, -*days))
+	} else {
+		n, err = con.EmptyTrash()
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Deleted", n)
+	return nil
+}
+
+func runCompact(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	report, err := con.Compact()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(report)
+	return nil
+}
+
+func runRegenerateThumbnails(flags *flag.FlagSet, args []string) error {
+	size := flags.Int("size", conatho.DefaultThumbnailSize, "width and height of the thumbnails in pixels")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+	if *size <= 0 {
+		return errors.New("invalid size")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	con.ThumbnailSize = *size
+
+	n, err := con.RegenerateThumbnails()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Regenerated", n, "thumbnails")
+	return nil
+}
+
+func runHistory(flags *flag.FlagSet, args []string) error {
+	days := flags.Int("days", 0, "only list the changes made in the last days")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	if *days > 0 {
+		since = time.Now().AddDate(0, 0, -*days)
+	}
+
+	var history []conatho.AuditEntry
+	if flags.NArg() > 1 {
+		id, err := uuid.Parse(flags.Arg(1))
+		if err != nil {
+			return err
+		}
+		e, ok := con.Entities[id]
+		if !ok {
+			return fmt.Errorf("no entity %s", id)
+		}
+
+		history, err = e.History()
+		if err != nil {
+			return err
+		}
+		history = slices.DeleteFunc(history, func(a conatho.AuditEntry) bool {
+			return a.Time.Before(since)
+		})
+	} else {
+		history, err = con.AuditLog(since)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, a := range history {
+		fmt.Printf("%s\t%s\n", a.Entity, a)
+	}
+	return nil
+}
+
+func runModified(flags *flag.FlagSet, args []string) error {
+	days := flags.Int("days", 7, "number of days to look back")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("no file given")
+	}
+
+	con, err := openConatho(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	entities, connections := con.ModifiedSince(time.Now().AddDate(0, 0, -*days))
+	for _, e := range entities {
+		fmt.Printf("%s\t%s\tentity %q\n", e.ID, e.UpdatedAt.Format("2006-01-02 15:04:05"), e.Name)
+	}
+	for _, connection := range connections {
+		fmt.Printf("%s\t%s\tconnection %q %q -> %q\n", connection.ID, connection.UpdatedAt.Format("2006-01-02 15:04:05"),
+			connection.Name, con.Entities[connection.Superior].Name, con.Entities[connection.Inferior].Name)
+	}
+	return nil
+}
+
+func runJSONSchema(flags *flag.FlagSet, args []string) error {
+	_, err := os.Stdout.Write(conatho.DocumentSchema)
+	return err
+}
+
+// Index of a column by its header
+func csvColumn(table conatho.CSVTable, header string) (int, error) {
+	i, ok := table.Column(header)
+	if !ok {
+		return 0, fmt.Errorf("no column %q", header)
+	}
+	return i, nil
+}
+
+func runImportCSV(flags *flag.FlagSet, args []string) error {
+	name := flags.String("name", "", "column holding the names, defaults to the column named \"name\" or the first column")
+	key := flags.String("key", "", "column holding a unique key, its attribute type is marked as key")
+	skip := flags.String("skip", "", "comma separated columns that are not imported")
+
+	return runImport(flags, args, func(con *conatho.Conatho, r io.Reader) (conatho.ImportReport, error) {
+		table, err := conatho.ReadCSV(r)
+		if err != nil {
+			return conatho.ImportReport{}, err
+		}
+
+		nameColumn := table.NameColumn()
+		if *name != "" {
+			nameColumn, err = csvColumn(table, *name)
+			if err != nil {
+				return conatho.ImportReport{}, err
+			}
+		}
+
+		var skipColumns []int
+		for _, header := range splitList(*skip) {
+			i, err := csvColumn(table, header)
+			if err != nil {
+				return conatho.ImportReport{}, err
+			}
+			skipColumns = append(skipColumns, i)
+		}
+
+		// Columns are mapped to attribute types by their header
+		mapping := table.DefaultEntityMapping(con, nameColumn)
+		mapping.Columns = slices.DeleteFunc(mapping.Columns, func(column conatho.CSVColumn) bool {
+			return slices.Contains(skipColumns, column.Column)
+		})
+
+		if *key != "" {
+			keyColumn, err := csvColumn(table, *key)
+			if err != nil {
+				return conatho.ImportReport{}, err
+			}
+
+			i := slices.IndexFunc(mapping.Columns, func(column conatho.CSVColumn) bool {
+				return column.Column == keyColumn
+			})
+			if i < 0 {
+				return conatho.ImportReport{}, fmt.Errorf("key column %q is not imported", *key)
+			}
+			mapping.Columns[i].Key = true
+		}
+
+		return con.ImportCSVEntities(table, mapping)
+	})
+}
+
+func runImportCSVConnections(flags *flag.FlagSet, args []string) error {
+	superior := flags.String("superior", "superior", "column holding the superior entities")
+	inferior := flags.String("inferior", "inferior", "column holding the inferior entities")
+	name := flags.String("name", "", "column holding the names of the connections")
+	match := flags.String("match", "", "attribute type to match entities on instead of their name")
+
+	return runImport(flags, args, func(con *conatho.Conatho, r io.Reader) (conatho.ImportReport, error) {
+		table, err := conatho.ReadCSV(r)
+		if err != nil {
+			return conatho.ImportReport{}, err
+		}
+
+		mapping := conatho.CSVConnectionMapping{NameColumn: -1}
+
+		mapping.SuperiorColumn, err = csvColumn(table, *superior)
+		if err != nil {
+			return conatho.ImportReport{}, err
+		}
+
+		mapping.InferiorColumn, err = csvColumn(table, *inferior)
+		if err != nil {
+			return conatho.ImportReport{}, err
+		}
+
+		if *name != "" {
+			mapping.NameColumn, err = csvColumn(table, *name)
+			if err != nil {
+				return conatho.ImportReport{}, err
+			}
+		}
+
+		if *match != "" {
+			id, ok := con.AttributeTypeByName(*match)
+			if !ok {
+				return conatho.ImportReport{}, fmt.Errorf("no attribute type %q", *match)
+			}
+			mapping.MatchAttribute = id
+		}
+
+		return con.ImportCSVConnections(table, mapping)
+	})
+}
@@ -0,0 +1,187 @@
+package conatho
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Files in an archive besides the images and data attributes
+const (
+	ArchiveManifest = "manifest.json"
+	ArchiveSchema   = "schema.json"
+	ArchiveView     = "view.json"
+)
+
+// View state and bookmarks are not part of a document, they are stored next
+// to the manifest so the archive holds the complete file
+type archiveView struct {
+	ViewState ViewState  `json:"view_state"`
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+func writeArchiveJSON(zw *zip.Writer, name string, v any) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(v)
+}
+
+// ExportArchive writes the file as a zip archive holding a JSON document
+// (manifest.json) with its JSON schema, every image as a file in the format it
+// is stored in, QOI images as PNG, and every data attribute as a file
+func (c *Conatho) ExportArchive(w io.Writer) error {
+	doc, err := c.Document()
+	if err != nil {
+		return err
+	}
+
+	var view archiveView
+	view.ViewState, err = c.GetViewState()
+	if err != nil {
+		return err
+	}
+	view.Bookmarks, err = c.GetBookmarks()
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+
+	err = doc.Externalize(func(name string, data []byte) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeArchiveJSON(zw, ArchiveManifest, doc)
+	if err != nil {
+		return err
+	}
+
+	f, err := zw.Create(ArchiveSchema)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(DocumentSchema)
+	if err != nil {
+		return err
+	}
+
+	err = writeArchiveJSON(zw, ArchiveView, view)
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func readArchiveFile(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("archive has no file %q", name)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// ImportArchive adds the contents of an archive written by ExportArchive to
+// the file. Bookmarks are added as well, the view state is only restored when
+// the file was empty.
+func (c *Conatho) ImportArchive(r io.Reader) (ImportReport, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	manifest, err := readArchiveFile(files, ArchiveManifest)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	doc, err := ReadDocument(bytes.NewReader(manifest))
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	err = doc.Internalize(func(name string) ([]byte, error) {
+		return readArchiveFile(files, name)
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	var view *archiveView
+	if _, ok := files[ArchiveView]; ok {
+		viewData, err := readArchiveFile(files, ArchiveView)
+		if err != nil {
+			return ImportReport{}, err
+		}
+
+		view = &archiveView{}
+		err = json.Unmarshal(viewData, view)
+		if err != nil {
+			return ImportReport{}, err
+		}
+	}
+
+	empty := len(c.Entities) == 0
+
+	var report ImportReport
+	err = c.Transaction(func() error {
+		var err error
+		report, err = c.ImportDocument(doc)
+		if err != nil {
+			return err
+		}
+
+		if view == nil {
+			return nil
+		}
+
+		for _, bookmark := range view.Bookmarks {
+			_, err := c.AddBookmark(bookmark.Name, bookmark.X, bookmark.Y, bookmark.Zoom)
+			if err != nil {
+				return err
+			}
+		}
+
+		if empty {
+			return c.SaveViewState(view.ViewState)
+		}
+		return nil
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,279 @@
+package conatho
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditOperation string
+
+const (
+	AuditCreate     AuditOperation = "create"
+	AuditRename     AuditOperation = "rename"
+	AuditMove       AuditOperation = "move"
+	AuditAttribute  AuditOperation = "attribute"
+	AuditImage      AuditOperation = "image"
+	AuditDelete     AuditOperation = "delete"
+	AuditRestore    AuditOperation = "restore"
+	AuditConnect    AuditOperation = "connect"
+	AuditDisconnect AuditOperation = "disconnect"
+	AuditPurge      AuditOperation = "purge"
+
+	// Replacing the contents of the file is recorded once for the file and
+	// once for every changed field of an item
+	AuditReplace         AuditOperation = "replace"
+	AuditRestoreSnapshot AuditOperation = "restore snapshot"
+	AuditMerge           AuditOperation = "merge"
+)
+
+// AuditEntry records a single change. Connections are recorded with the
+// superior as entity and the inferior as related entity, the connection name
+// as field.
+type AuditEntry struct {
+	ID        int64
+	Time      time.Time
+	Author    string
+	Operation AuditOperation
+	Entity    uuid.UUID
+	Related   uuid.UUID
+	Field     string
+	Old       string
+	New       string
+}
+
+const auditTimeFormat = "2006-01-02 15:04:05"
+
+func (a AuditEntry) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s %s", a.Time.Format(auditTimeFormat), a.Author, a.Operation)
+	if a.Field != "" {
+		fmt.Fprintf(&sb, " %s", strconv.Quote(a.Field))
+	}
+	if a.Old != "" || a.New != "" {
+		fmt.Fprintf(&sb, ": %s -> %s", valueOrNone(a.Old), valueOrNone(a.New))
+	}
+	return sb.String()
+}
+
+func valueOrNone(s string) string {
+	if s == "" {
+		return diffNone
+	}
+	return s
+}
+
+// Record a change made by the author of the file
+func (c *Conatho) audit(op AuditOperation, entity, related uuid.UUID, field, from, to string) error {
+	if c.unaudited {
+		return nil
+	}
+
+	_, err := c.db().Exec(`
+		INSERT INTO audit (time, author, operation, entity, related, field, old, new)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		time.Now().Unix(), c.Author, string(op), nullUUID(entity), nullUUID(related), field, from, to)
+	return err
+}
+
+// Stored as NULL when not set
+func nullUUID(id uuid.UUID) []byte {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id[:]
+}
+
+// History returns the changes made to the entity and its connections, the
+// newest first
+func (e *Entity) History() ([]AuditEntry, error) {
+	return e.c.auditEntries("WHERE entity = ? OR related = ?", e.ID[:], e.ID[:])
+}
+
+// AuditLog returns all changes made since the given time, the newest first
+func (c *Conatho) AuditLog(since time.Time) ([]AuditEntry, error) {
+	return c.auditEntries("WHERE time >= ?", since.Unix())
+}
+
+func (c *Conatho) auditEntries(where string, args ...any) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+
+	rows, err := c.db().Query(`
+		SELECT id, time, author, operation, entity, related, field, old, new
+		FROM audit `+where+`
+		ORDER BY time DESC, id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a AuditEntry
+		var t int64
+		var entity, related []byte
+		err := rows.Scan(&a.ID, &t, &a.Author, &a.Operation, &entity, &related, &a.Field, &a.Old, &a.New)
+		if err != nil {
+			return nil, err
+		}
+		a.Time = time.Unix(t, 0)
+		if entity != nil {
+			a.Entity, err = uuid.FromBytes(entity)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if related != nil {
+			a.Related, err = uuid.FromBytes(related)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		entries = append(entries, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Value of an attribute as recorded in the audit trail
+func auditValue(num *int64, str *string, data []byte) string {
+	da := DocumentAttribute{Number: num, String: str}
+	if data != nil {
+		da.Data = &DocumentFile{Data: data}
+	}
+	return formatAttribute(da)
+}
+
+// Name and ends of a connection as recorded in the audit trail
+func (c *Conatho) auditConnection(connection *Connection) string {
+	var superior, inferior string
+	if e, ok := c.Entities[connection.Superior]; ok {
+		superior = e.Name
+	}
+	if e, ok := c.Entities[connection.Inferior]; ok {
+		inferior = e.Name
+	}
+	return auditConnectionEnds(superior, inferior)
+}
+
+func auditConnectionEnds(superior, inferior string) string {
+	return fmt.Sprintf("%s to %s", strconv.Quote(superior), strconv.Quote(inferior))
+}
+
+// Record replacing the contents of the file from before to after. Items that
+// are kept keep their history, added, removed and changed items get an entry
+// with the operation.
+func (c *Conatho) auditReplace(op AuditOperation, name string, before, after Document) error {
+	err := c.audit(op, uuid.Nil, uuid.Nil, name, "", "")
+	if err != nil {
+		return err
+	}
+
+	changes := DiffDocuments(before, after)
+
+	for _, change := range changes.AttributeTypes {
+		var err error
+		switch change.Kind {
+		case ChangeAdded:
+			err = c.audit(op, uuid.Nil, uuid.Nil, change.New.Name, "", "attribute type "+change.New.Datatype.String())
+		case ChangeRemoved:
+			err = c.audit(op, uuid.Nil, uuid.Nil, change.Old.Name, "attribute type "+change.Old.Datatype.String(), "")
+		default:
+			for _, field := range change.Changes {
+				err = errors.Join(err, c.audit(op, uuid.Nil, uuid.Nil, change.New.Name+" "+field.Field, field.Old, field.New))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, change := range changes.Entities {
+		var err error
+		switch change.Kind {
+		case ChangeAdded:
+			err = c.audit(op, change.New.ID, uuid.Nil, "", "", strconv.Quote(change.New.Name))
+		case ChangeRemoved:
+			err = c.audit(op, change.Old.ID, uuid.Nil, "", strconv.Quote(change.Old.Name), "")
+		default:
+			for _, field := range change.Changes {
+				// Attributes are recorded by the name of their type, like
+				// when they are edited
+				name := field.Field
+				if quoted, ok := strings.CutPrefix(name, "attribute "); ok {
+					name, _ = strconv.Unquote(quoted)
+				}
+				err = errors.Join(err, c.audit(op, change.New.ID, uuid.Nil, name, field.Old, field.New))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	names := func(doc Document) map[uuid.UUID]string {
+		m := make(map[uuid.UUID]string)
+		for _, de := range doc.Entities {
+			m[de.ID] = de.Name
+		}
+		return m
+	}
+	beforeNames, afterNames := names(before), names(after)
+
+	for _, change := range changes.Connections {
+		from, to := "", ""
+		dc := change.New
+		if change.Old != nil {
+			from = auditConnectionEnds(beforeNames[change.Old.Superior], beforeNames[change.Old.Inferior])
+		}
+		if change.New != nil {
+			to = auditConnectionEnds(afterNames[change.New.Superior], afterNames[change.New.Inferior])
+		} else {
+			dc = change.Old
+		}
+		if change.Kind == ChangeModified && change.Old.Name != change.New.Name {
+			from = strconv.Quote(change.Old.Name) + " " + from
+			to = strconv.Quote(change.New.Name) + " " + to
+		}
+
+		err := c.audit(op, dc.Superior, dc.Inferior, dc.Name, from, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Copy the history of the entities and their connections to another file
+func (c *Conatho) copyAudit(to *Conatho, entities map[uuid.UUID]bool) error {
+	history, err := c.auditEntries("")
+	if err != nil {
+		return err
+	}
+
+	return to.Transaction(func() error {
+		// Oldest first, so the copies are listed in the same order
+		for _, a := range slices.Backward(history) {
+			if !entities[a.Entity] && !entities[a.Related] {
+				continue
+			}
+			_, err := to.db().Exec(`
+				INSERT INTO audit (time, author, operation, entity, related, field, old, new)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				a.Time.Unix(), a.Author, string(a.Operation), nullUUID(a.Entity), nullUUID(a.Related), a.Field, a.Old, a.New)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
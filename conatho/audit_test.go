@@ -0,0 +1,153 @@
+package conatho
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The operations recorded for an entity, oldest first
+func auditOperations(t *testing.T, e *Entity) []AuditOperation {
+	t.Helper()
+	history, err := e.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var operations []AuditOperation
+	for _, entry := range slices.Backward(history) {
+		if entry.Entity == e.ID && entry.Related == uuid.Nil {
+			operations = append(operations, entry.Operation)
+		}
+	}
+	return operations
+}
+
+func TestRestoreSnapshotAudit(t *testing.T) {
+	c := testConatho(t)
+	entities := testConnected(t, c, "A", "B")
+	id, err := c.CreateSnapshot("before")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = entities["A"].Rename("A renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := c.CreateEntity(0, 200, "C")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c3 := c.Entities[created.ID]
+
+	_, err = c.RestoreSnapshot(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Entities in the snapshot keep their history, only the change is added
+	a := c.Entities[entities["A"].ID]
+	if got, want := auditOperations(t, a), []AuditOperation{AuditCreate, AuditRename, AuditRestoreSnapshot}; !slices.Equal(got, want) {
+		t.Errorf("history of A %v, want %v", got, want)
+	}
+	b := c.Entities[entities["B"].ID]
+	if got, want := auditOperations(t, b), []AuditOperation{AuditCreate}; !slices.Equal(got, want) {
+		t.Errorf("history of B %v, want %v", got, want)
+	}
+	if got, want := auditOperations(t, c3), []AuditOperation{AuditCreate, AuditRestoreSnapshot}; !slices.Equal(got, want) {
+		t.Errorf("history of C %v, want %v", got, want)
+	}
+
+	log, err := c.AuditLog(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored bool
+	for _, entry := range log {
+		if entry.Operation == AuditRestoreSnapshot && entry.Entity == uuid.Nil && entry.Field == "before" {
+			restored = true
+		}
+	}
+	if !restored {
+		t.Errorf("restoring the snapshot is not recorded: %v", log)
+	}
+
+	// A branch carries the history of its entities, they are added to the new
+	// file by restoring the snapshot
+	branch, err := c.SnapshotToFile(id, t.TempDir()+"/branch.conatho")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer branch.Close()
+	if got, want := auditOperations(t, branch.Entities[b.ID]), []AuditOperation{AuditCreate, AuditRestoreSnapshot}; !slices.Equal(got, want) {
+		t.Errorf("history of B in the branch %v, want %v", got, want)
+	}
+}
+
+func TestMergeAudit(t *testing.T) {
+	c := testConatho(t)
+	entities := testConnected(t, c, "A", "B")
+	theirs, err := c.Document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range theirs.Entities {
+		if theirs.Entities[i].ID == entities["A"].ID {
+			theirs.Entities[i].Name = "A merged"
+		}
+	}
+
+	_, err = c.ApplyMerge(MergeDocuments(nil, theirs, theirs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := c.Entities[entities["A"].ID]
+	if got, want := auditOperations(t, a), []AuditOperation{AuditCreate, AuditMerge}; !slices.Equal(got, want) {
+		t.Errorf("history of A %v, want %v", got, want)
+	}
+	history, err := a.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := history[0]; entry.Field != "name" || entry.Old != `"A"` || entry.New != `"A merged"` {
+		t.Errorf("merge recorded as %+v", entry)
+	}
+}
+
+func TestPurgeAudit(t *testing.T) {
+	c := testConatho(t)
+	entities := testConnected(t, c, "A", "B", "C")
+	a, bc := entities["A"], connectionByName(t, c, "BC")
+	err := c.RemoveConnection(bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Delete()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.EmptyTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := c.AuditLog(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var purged []string
+	for _, entry := range log {
+		if entry.Operation == AuditPurge {
+			purged = append(purged, entry.Field+" "+entry.Old)
+		}
+	}
+	slices.Sort(purged)
+	want := []string{` "A"`, `AB "A" to "B"`, `BC "B" to "C"`}
+	if !slices.Equal(purged, want) {
+		t.Errorf("purged %q, want %q", purged, want)
+	}
+}
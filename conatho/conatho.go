@@ -1,32 +1,44 @@
 package conatho
 
 import (
-	"bufio"
 	"bytes"
+	"cmp"
 	"database/sql"
 	_ "embed"
 	"errors"
 	"fmt"
 	"image"
 	"io"
+	"maps"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/xfmoulet/qoi"
+	_ "golang.org/x/image/bmp"
 	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
 )
 
 var ErrEntityNoImage = errors.New("entity has no image")
+var ErrUnsupportedImage = errors.New("unsupported image format, supported are " + strings.Join(SupportedImageFormats, ", "))
+var ErrConnectToItself = errors.New("can not connect to itself")
 
 type Connection struct {
-	ID       uuid.UUID
-	Name     string
-	Superior uuid.UUID
-	Inferior uuid.UUID
+	ID        uuid.UUID
+	Name      string
+	Superior  uuid.UUID
+	Inferior  uuid.UUID
+	CreatedAt time.Time // Zero for connections made before times were recorded
+	UpdatedAt time.Time
 }
 
 type Entity struct {
@@ -36,12 +48,15 @@ type Entity struct {
 	Name        string
 	Image       bool
 	Connections []uuid.UUID // UUIDs of connections
+	CreatedAt   time.Time   // Zero for entities created before times were recorded
+	UpdatedAt   time.Time
 
 	c *Conatho // So we can access the main object from the entity methods
 }
 
 type Conatho struct {
 	sql *sql.DB
+	tx  *sql.Tx
 
 	Entities     map[uuid.UUID]*Entity
 	EntitiesKeys []uuid.UUID
@@ -50,10 +65,25 @@ type Conatho struct {
 	ConnectionsKeys []uuid.UUID
 
 	AttributeTypes map[int64]AttributeType
+
+	// Author is recorded in the audit trail for every change
+	Author string
+
+	// Changes are not recorded one by one while the contents are replaced
+	unaudited bool
+
+	// ThumbnailSize is the width and height of new thumbnails in pixels,
+	// DefaultThumbnailSize when 0
+	ThumbnailSize int
 }
 
-const ThumbnailWidth = int(150)
-const ThumbnailHeight = int(150)
+// SupportedImageFormats are the formats images can be added in. Only the first
+// frame of animated GIF images is shown.
+var SupportedImageFormats = []string{"PNG", "JPEG", "GIF", "WebP", "BMP", "TIFF", "QOI"}
+
+// DefaultThumbnailSize is the width and height of thumbnails when
+// ThumbnailSize is not set, twice the size of the thumbnail on a card
+const DefaultThumbnailSize = 256
 
 func New(filename string) (Conatho, error) {
 	var c Conatho
@@ -74,6 +104,11 @@ func New(filename string) (Conatho, error) {
 		}
 	}
 
+	err = c.migrate()
+	if err != nil {
+		return c, err
+	}
+
 	c.Entities = make(map[uuid.UUID]*Entity)
 	c.Connections = make(map[uuid.UUID]*Connection)
 	c.AttributeTypes = make(map[int64]AttributeType)
@@ -81,6 +116,11 @@ func New(filename string) (Conatho, error) {
 	return c, nil
 }
 
+// Close closes the file, it can not be used afterwards
+func (c *Conatho) Close() error {
+	return c.sql.Close()
+}
+
 func (c *Conatho) init() error {
 	_, err := c.sql.Exec(`
 	    CREATE TABLE "info" (
@@ -134,9 +174,106 @@ func (c *Conatho) init() error {
 	return nil
 }
 
+// Implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// The active transaction if there is one, otherwise the database
+func (c *Conatho) db() querier {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.sql
+}
+
+// Transaction runs fn inside a single transaction. When fn returns an error
+// the transaction is rolled back and the entities, connections and attribute
+// types are restored to how they were before.
+func (c *Conatho) Transaction(fn func() error) error {
+	// Already inside a transaction
+	if c.tx != nil {
+		return fn()
+	}
+
+	tx, err := c.sql.Begin()
+	if err != nil {
+		return err
+	}
+
+	state := c.saveState()
+
+	c.tx = tx
+	err = fn()
+	c.tx = nil
+
+	if err != nil {
+		tx.Rollback()
+		c.restoreState(state)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Entities, connections and attribute types as they were before a
+// transaction. Rolling back restores them in place so pointers to entities
+// and connections held elsewhere stay valid.
+type memoryState struct {
+	entities         map[uuid.UUID]*Entity
+	entityValues     map[*Entity]Entity
+	entitiesKeys     []uuid.UUID
+	connections      map[uuid.UUID]*Connection
+	connectionValues map[*Connection]Connection
+	connectionsKeys  []uuid.UUID
+	attributeTypes   map[int64]AttributeType
+}
+
+func (c *Conatho) saveState() memoryState {
+	s := memoryState{
+		entities:         c.Entities,
+		entityValues:     make(map[*Entity]Entity, len(c.Entities)),
+		entitiesKeys:     slices.Clone(c.EntitiesKeys),
+		connections:      c.Connections,
+		connectionValues: make(map[*Connection]Connection, len(c.Connections)),
+		connectionsKeys:  slices.Clone(c.ConnectionsKeys),
+		attributeTypes:   maps.Clone(c.AttributeTypes),
+	}
+	for _, e := range c.Entities {
+		value := *e
+		value.Connections = slices.Clone(e.Connections)
+		s.entityValues[e] = value
+	}
+	for _, connection := range c.Connections {
+		s.connectionValues[connection] = *connection
+	}
+	return s
+}
+
+func (c *Conatho) restoreState(s memoryState) {
+	c.Entities = s.entities
+	clear(c.Entities)
+	for e, value := range s.entityValues {
+		*e = value
+		c.Entities[e.ID] = e
+	}
+	c.EntitiesKeys = s.entitiesKeys
+
+	c.Connections = s.connections
+	clear(c.Connections)
+	for connection, value := range s.connectionValues {
+		*connection = value
+		c.Connections[connection.ID] = connection
+	}
+	c.ConnectionsKeys = s.connectionsKeys
+
+	c.AttributeTypes = s.attributeTypes
+}
+
 func (c *Conatho) CreateEntity(posX, posY int32, name string) (Entity, error) {
 	e := Entity{
-		c:     c,
 		ID:    uuid.New(),
 		X:     posX,
 		Y:     posY,
@@ -144,20 +281,90 @@ func (c *Conatho) CreateEntity(posX, posY int32, name string) (Entity, error) {
 		Image: false,
 	}
 
-	id, err := e.ID.MarshalBinary()
+	_, err := c.insertEntity(&e)
 	if err != nil {
 		return e, err
 	}
 
-	_, err = c.sql.Exec("INSERT INTO entities (id, name, posx, posy) VALUES (?, ?, ?, ?)", id, e.Name, e.X, e.Y)
+	return e, nil
+}
+
+// Insert an entity with an already set ID. An entity with the same ID in the
+// trash is taken out of it with the new name and position instead, its
+// attributes and images are removed and its history is kept. restored reports
+// whether that happened.
+func (c *Conatho) insertEntity(e *Entity) (restored bool, err error) {
+	e.c = c
+
+	id, err := e.ID.MarshalBinary()
 	if err != nil {
-		return e, err
+		return false, err
 	}
 
-	c.Entities[e.ID] = &e
+	err = c.Transaction(func() error {
+		now := time.Now().Unix()
+
+		var createdAt int64
+		row := c.db().QueryRow(`
+			UPDATE entities SET name = ?, posx = ?, posy = ?, image = FALSE, deleted_at = NULL, updated_at = ?
+			WHERE id = ? AND deleted_at IS NOT NULL
+			RETURNING created_at`, e.Name, e.X, e.Y, now, id)
+		err := row.Scan(&createdAt)
+		if err == nil {
+			restored = true
+			e.CreatedAt = unixTime(createdAt)
+			e.UpdatedAt = unixTime(now)
+
+			err = c.clearRestoredEntity(e)
+			if err != nil {
+				return err
+			}
+			return c.audit(AuditRestore, e.ID, uuid.Nil, "", "", strconv.Quote(e.Name))
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		_, err = c.db().Exec("INSERT INTO entities (id, name, posx, posy, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+			id, e.Name, e.X, e.Y, now, now)
+		if err != nil {
+			return err
+		}
+		e.CreatedAt = unixTime(now)
+		e.UpdatedAt = e.CreatedAt
+
+		return c.audit(AuditCreate, e.ID, uuid.Nil, "", "", strconv.Quote(e.Name))
+	})
+	if err != nil {
+		return false, err
+	}
+
+	c.Entities[e.ID] = e
 	c.EntitiesKeys = append(c.EntitiesKeys, e.ID)
 
-	return e, nil
+	return restored, nil
+}
+
+// Remove the attributes and images of an entity taken out of the trash by an
+// import, which adds its own. Connections deleted along with it stay in the
+// trash, where they can be restored by themselves.
+func (c *Conatho) clearRestoredEntity(e *Entity) error {
+	id, err := e.ID.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db().Exec("DELETE FROM attributes WHERE entity = ?", id)
+	if err != nil {
+		return err
+	}
+
+	err = c.deleteImages("entity = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db().Exec("UPDATE connections SET deleted_with = NULL WHERE deleted_with = ?", id)
+	return err
 }
 
 func (c *Conatho) generateEntitiesKeys() {
@@ -174,93 +381,155 @@ func (c *Conatho) generateConnectionsKeys() {
 	}
 }
 
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	return slices.Sorted(maps.Keys(m))
+}
+
+func compareUUID(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// Keys sorted by UUID, so exports are the same every time
+func (c *Conatho) sortedEntitiesKeys() []uuid.UUID {
+	return slices.SortedFunc(maps.Keys(c.Entities), compareUUID)
+}
+
+func (c *Conatho) sortedConnectionsKeys() []uuid.UUID {
+	return slices.SortedFunc(maps.Keys(c.Connections), compareUUID)
+}
+
+// EntityAddImage sets the primary image of the entity, replacing the current
+// one. Other images are added with AddImage.
 func (e *Entity) EntityAddImage(imageReader io.Reader) error {
-	id, err := e.ID.MarshalBinary()
+	si, err := readImage(imageReader)
 	if err != nil {
 		return err
 	}
 
-	// Load image
-	img, format, err := image.Decode(imageReader)
+	return e.storeImage(si)
+}
+
+// An image as it is stored, the original bytes in their own format
+type storedImage struct {
+	data     []byte
+	mimeType string
+	img      image.Image
+}
+
+// Read an image and decode it, the original bytes are kept
+func readImage(imageReader io.Reader) (storedImage, error) {
+	data, err := io.ReadAll(imageReader)
 	if err != nil {
-		return err
+		return storedImage{}, err
 	}
-	fmt.Println(format)
 
-	// Save to buffer as QOI
-	var qoiImg bytes.Buffer
-	qoiImgWriter := bufio.NewWriter(&qoiImg)
-	err = qoi.Encode(qoiImgWriter, img)
+	img, format, err := decodeImage(data)
 	if err != nil {
-		panic(err)
+		return storedImage{}, err
+	}
+
+	return storedImage{data: data, mimeType: "image/" + format, img: img}, nil
+}
+
+// Decode an image and turn it upright, of animated images the first frame
+func decodeImage(data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, "", ErrUnsupportedImage
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	return orient(img, exifOrientation(data)), format, nil
+}
+
+// Size of new thumbnails
+func (c *Conatho) thumbnailSize() int {
+	if c.ThumbnailSize > 0 {
+		return c.ThumbnailSize
 	}
+	return DefaultThumbnailSize
+}
 
+// Square thumbnail of img, scaled to fit and centered
+func makeThumbnail(img image.Image, size int) ([]byte, error) {
 	bounds := img.Bounds()
-	width := float32(bounds.Max.X)
-	height := float32(bounds.Max.Y)
-	// bounds.Max.X
+	width, height := bounds.Dx(), bounds.Dy()
+
 	var rect image.Rectangle
 	if width > height {
-		newWidth := ThumbnailWidth
-		newHeight := int(height / width * float32(ThumbnailWidth))
-		rect = image.Rect(
-			0,
-			(ThumbnailHeight-newHeight)/2,
-			newWidth,
-			ThumbnailHeight-((ThumbnailHeight-newHeight)/2))
-	} else if height > width {
-		newHeight := ThumbnailHeight
-		newWidth := int(width / height * float32(ThumbnailHeight))
-		x0 := (ThumbnailWidth - newWidth) / 2
-		y0 := 0
-		x1 := ((ThumbnailWidth - newWidth) / 2) + newWidth
-		y1 := newHeight
-		fmt.Println(width, height)
-		fmt.Println(newWidth, newHeight)
-		fmt.Println(x0, y0, x1, y1)
-
-		rect = image.Rect(
-			(ThumbnailWidth-newWidth)/2,
-			0,
-			((ThumbnailWidth-newWidth)/2)+newWidth,
-			newHeight)
+		newHeight := max(1, height*size/width)
+		rect = image.Rect(0, (size-newHeight)/2, size, (size-newHeight)/2+newHeight)
 	} else {
-		rect = image.Rect(0, 0, 150, 150)
+		newWidth := max(1, width*size/height)
+		rect = image.Rect((size-newWidth)/2, 0, (size-newWidth)/2+newWidth, size)
 	}
 
-	dst := image.NewRGBA(image.Rect(0, 0, ThumbnailWidth, ThumbnailHeight))
-	draw.NearestNeighbor.Scale(dst, rect, img, img.Bounds(), draw.Over, nil)
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, rect, img, bounds, draw.Over, nil)
 
-	var qoiImgThumbnail bytes.Buffer
-	qoiImgThumbnailWriter := bufio.NewWriter(&qoiImgThumbnail)
+	var thumbnail bytes.Buffer
+	err := qoi.Encode(&thumbnail, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	return thumbnail.Bytes(), nil
+}
 
-	err = qoi.Encode(qoiImgThumbnailWriter, dst)
+// Store the image as primary image together with a thumbnail, replacing the
+// current primary image
+func (e *Entity) storeImage(si storedImage) error {
+	id, err := e.ID.MarshalBinary()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	if !e.Image {
-		_, err = e.c.sql.Exec("INSERT INTO images (id, image, thumbnail) VALUES (?, ?, ?)", id, qoiImg.Bytes(), qoiImgThumbnail.Bytes())
+	var imageID int64
+	var oldHash string
+	var size int64
+	row := e.c.db().QueryRow(`
+		SELECT images.id, hash, length(data)
+		FROM images JOIN image_blobs USING (hash)
+		WHERE entity = ? AND is_primary`, id)
+	err = row.Scan(&imageID, &oldHash, &size)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = e.insertImage(si, "", true, ImageEdit{})
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	thumbnail, err := makeThumbnail(si.img, e.c.thumbnailSize())
+	if err != nil {
+		return err
+	}
+
+	return e.c.Transaction(func() error {
+		// The new blob is taken first, it may be the same one
+		hash, err := e.c.acquireImageBlob(si)
 		if err != nil {
 			return err
 		}
 
-		_, err = e.c.sql.Exec("UPDATE entities SET image = TRUE WHERE id = ?", id)
+		// A new image starts without edit
+		_, err = e.c.db().Exec(`
+			UPDATE images SET hash = ?, thumbnail = ?, rotation = 0, flip = FALSE, crop_x = 0, crop_y = 0, crop_width = 0, crop_height = 0
+			WHERE id = ?`, hash, thumbnail, imageID)
 		if err != nil {
 			return err
 		}
-	} else {
-		_, err = e.c.sql.Exec("UPDATE images SET image = ?, thumbnail = ? WHERE id = ?", qoiImg.Bytes(), qoiImgThumbnail.Bytes(), id)
+
+		err = e.c.releaseImageBlob(oldHash)
 		if err != nil {
 			return err
 		}
-	}
 
-	e.Image = true
-
-	return nil
+		return e.changed(AuditImage, "", fmt.Sprintf("%d bytes", size), fmt.Sprintf("%d bytes", len(si.data)))
+	})
 }
 
+// EntityGetThumbnail returns the thumbnail of the primary image
 func (e *Entity) EntityGetThumbnail() ([]byte, error) {
 	id, err := e.ID.MarshalBinary()
 	if err != nil {
@@ -272,7 +541,7 @@ func (e *Entity) EntityGetThumbnail() ([]byte, error) {
 	}
 
 	var img []byte
-	row := e.c.sql.QueryRow("SELECT thumbnail FROM images WHERE id = ?", id)
+	row := e.c.db().QueryRow("SELECT thumbnail FROM images WHERE entity = ? AND is_primary", id)
 	if err := row.Scan(&img); err != nil {
 		return nil, err
 	}
@@ -280,6 +549,22 @@ func (e *Entity) EntityGetThumbnail() ([]byte, error) {
 	return img, nil
 }
 
+// Decoded thumbnail of the entity
+func (e *Entity) thumbnailImage() (image.Image, error) {
+	thumbnail, err := e.EntityGetThumbnail()
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(thumbnail))
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// EntityGetImage returns the primary image in its original format
 func (e *Entity) EntityGetImage() ([]byte, error) {
 	id, err := e.ID.MarshalBinary()
 	if err != nil {
@@ -291,7 +576,7 @@ func (e *Entity) EntityGetImage() ([]byte, error) {
 	}
 
 	var img []byte
-	row := e.c.sql.QueryRow("SELECT image FROM images WHERE id = ?", id)
+	row := e.c.db().QueryRow("SELECT data FROM images JOIN image_blobs USING (hash) WHERE entity = ? AND is_primary", id)
 	if err := row.Scan(&img); err != nil {
 		return nil, err
 	}
@@ -310,13 +595,16 @@ const (
 type AttributeType struct {
 	Name string
 	Type Datatype
+	// Values are unique external identifiers, importers update the entity
+	// with a matching value instead of creating a new one
+	Key bool
 }
 
 func (c *Conatho) GetAttributeTypes() error {
 	c.AttributeTypes = make(map[int64]AttributeType)
 
-	rows, err := c.sql.Query(`
-		SELECT id, name, datatype
+	rows, err := c.db().Query(`
+		SELECT id, name, datatype, unique_key
 		FROM attribute_types`)
 	if err != nil {
 		return err
@@ -326,7 +614,7 @@ func (c *Conatho) GetAttributeTypes() error {
 	for rows.Next() {
 		var id int64
 		var a AttributeType
-		err := rows.Scan(&id, &a.Name, &a.Type)
+		err := rows.Scan(&id, &a.Name, &a.Type, &a.Key)
 		if err != nil {
 			return err
 		}
@@ -340,10 +628,33 @@ func (c *Conatho) GetAttributeTypes() error {
 	return nil
 }
 
+// AttributeTypeByName returns the ID of the first attribute type with the name
+func (c *Conatho) AttributeTypeByName(name string) (int64, bool) {
+	found := false
+	var foundID int64
+	for id, a := range c.AttributeTypes {
+		if a.Name == name && (!found || id < foundID) {
+			found = true
+			foundID = id
+		}
+	}
+	return foundID, found
+}
+
 func (c *Conatho) AddAttributeType(name string, dataType Datatype) (int64, error) {
+	return c.insertAttributeType(0, name, dataType)
+}
+
+// Insert an attribute type, the ID is kept if it is not in use
+func (c *Conatho) insertAttributeType(wantedID int64, name string, dataType Datatype) (int64, error) {
 	var id int64
 
-	row := c.sql.QueryRow("INSERT INTO attribute_types (name, datatype) VALUES (?, ?) RETURNING id", name, int64(dataType))
+	var idArg any
+	if _, ok := c.AttributeTypes[wantedID]; wantedID > 0 && !ok {
+		idArg = wantedID
+	}
+
+	row := c.db().QueryRow("INSERT INTO attribute_types (id, name, datatype) VALUES (?, ?, ?) RETURNING id", idArg, name, int64(dataType))
 	err := row.Scan(&id)
 	if err != nil {
 		return id, err
@@ -357,13 +668,36 @@ func (c *Conatho) AddAttributeType(name string, dataType Datatype) (int64, error
 	return id, nil
 }
 
+// SetAttributeTypeKey marks the attribute type as a unique external key
+func (c *Conatho) SetAttributeTypeKey(id int64, key bool) error {
+	attributeType, ok := c.AttributeTypes[id]
+	if !ok {
+		return errors.New("unknown type")
+	}
+	if key && attributeType.Type == DatatypeData {
+		return errors.New("data can not be used as a key")
+	}
+
+	_, err := c.db().Exec("UPDATE attribute_types SET unique_key = ? WHERE id = ?", key, id)
+	if err != nil {
+		return err
+	}
+
+	attributeType.Key = key
+	c.AttributeTypes[id] = attributeType
+
+	return nil
+}
+
 type Attribute struct {
 	ID     int64
+	TypeID int64
 	Name   string
 	Type   Datatype
 	Number int64
 	String string
 	Data   []byte
+	Null   bool // No value has been set yet
 }
 
 func (e *Entity) GetAttributes() ([]Attribute, error) {
@@ -374,11 +708,12 @@ func (e *Entity) GetAttributes() ([]Attribute, error) {
 
 	attributes := []Attribute{}
 
-	rows, err := e.c.sql.Query(`
-		SELECT attributes.id, attribute_types.name, attribute_types.datatype, attributes.num, attributes.str, attributes.data
+	rows, err := e.c.db().Query(`
+		SELECT attributes.id, attributes.type, attribute_types.name, attribute_types.datatype, attributes.num, attributes.str, attributes.data
 		FROM attributes
 		LEFT JOIN attribute_types ON attributes.type = attribute_types.id
-		WHERE attributes.entity = ?`, id)
+		WHERE attributes.entity = ?
+		ORDER BY attributes.id`, id)
 	if err != nil {
 		return nil, err
 	}
@@ -389,7 +724,7 @@ func (e *Entity) GetAttributes() ([]Attribute, error) {
 		var num sql.NullInt64
 		var str sql.NullString
 		var data []byte
-		err := rows.Scan(&attribute.ID, &attribute.Name, &attribute.Type, &num, &str, &data)
+		err := rows.Scan(&attribute.ID, &attribute.TypeID, &attribute.Name, &attribute.Type, &num, &str, &data)
 		if err != nil {
 			return nil, err
 		}
@@ -399,12 +734,15 @@ func (e *Entity) GetAttributes() ([]Attribute, error) {
 			if num.Valid {
 				attribute.Number = num.Int64
 			}
+			attribute.Null = !num.Valid
 		case DatatypeString:
 			if str.Valid {
 				attribute.String = str.String
 			}
+			attribute.Null = !str.Valid
 		case DatatypeData:
 			attribute.Data = data
+			attribute.Null = data == nil
 		}
 
 		attributes = append(attributes, attribute)
@@ -422,15 +760,21 @@ func (e *Entity) AddAttribute(attributeTypeID int64) (int64, error) {
 		return 0, err
 	}
 
-	_, ok := e.c.AttributeTypes[attributeTypeID]
+	attributeType, ok := e.c.AttributeTypes[attributeTypeID]
 	if !ok {
 		return 0, errors.New("unknown type")
 	}
 
-	row := e.c.sql.QueryRow("INSERT INTO attributes (entity, type) VALUES (?, ?) RETURNING id", id, attributeTypeID)
-
 	var attributeID int64
-	err = row.Scan(&attributeID)
+	err = e.c.Transaction(func() error {
+		row := e.c.db().QueryRow("INSERT INTO attributes (entity, type) VALUES (?, ?) RETURNING id", id, attributeTypeID)
+		err := row.Scan(&attributeID)
+		if err != nil {
+			return err
+		}
+
+		return e.changed(AuditAttribute, attributeType.Name, "", diffNotSet)
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -438,42 +782,115 @@ func (e *Entity) AddAttribute(attributeTypeID int64) (int64, error) {
 	return attributeID, nil
 }
 
-func (e *Entity) UpdateAttribute(attributeID int64, value interface{}) error {
+// Insert an attribute with its value, the ID is kept if it is not in use
+func (e *Entity) insertAttribute(wantedID int64, attributeTypeID int64, num *int64, str *string, data []byte) (int64, error) {
 	id, err := e.ID.MarshalBinary()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	switch v := value.(type) {
-	case int64:
-		_, err = e.c.sql.Exec("UPDATE attributes SET num = ? WHERE entity = ? AND id = ?", v, id, attributeID)
-	case string:
-		_, err = e.c.sql.Exec("UPDATE attributes SET str = ? WHERE entity = ? AND id = ?", v, id, attributeID)
-	case []byte:
-		_, err = e.c.sql.Exec("UPDATE attributes SET data = ? WHERE entity = ? AND id = ?", v, id, attributeID)
-	default:
-		return errors.New("unsupported type")
+	var idArg any
+	if wantedID > 0 {
+		var inUse bool
+		row := e.c.db().QueryRow("SELECT EXISTS (SELECT 1 FROM attributes WHERE id = ?)", wantedID)
+		err = row.Scan(&inUse)
+		if err != nil {
+			return 0, err
+		}
+		if !inUse {
+			idArg = wantedID
+		}
 	}
 
+	var attributeID int64
+	err = e.c.Transaction(func() error {
+		row := e.c.db().QueryRow("INSERT INTO attributes (id, entity, type, num, str, data) VALUES (?, ?, ?, ?, ?, ?) RETURNING id",
+			idArg, id, attributeTypeID, num, str, data)
+		err := row.Scan(&attributeID)
+		if err != nil {
+			return err
+		}
+
+		return e.changed(AuditAttribute, e.c.AttributeTypes[attributeTypeID].Name, "", auditValue(num, str, data))
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return attributeID, nil
 }
 
-func (e *Entity) Delete() error {
+func (e *Entity) UpdateAttribute(attributeID int64, value interface{}) error {
 	id, err := e.ID.MarshalBinary()
 	if err != nil {
 		return err
 	}
 
-	_, err = e.c.sql.Exec("DELETE FROM entities WHERE id = ?", id)
+	return e.c.Transaction(func() error {
+		var typeName string
+		var num *int64
+		var str *string
+		var data []byte
+		row := e.c.db().QueryRow(`
+			SELECT attribute_types.name, attributes.num, attributes.str, attributes.data
+			FROM attributes
+			LEFT JOIN attribute_types ON attributes.type = attribute_types.id
+			WHERE attributes.entity = ? AND attributes.id = ?`, id, attributeID)
+		err := row.Scan(&typeName, &num, &str, &data)
+		if err != nil {
+			return err
+		}
+		oldValue := auditValue(num, str, data)
+
+		switch v := value.(type) {
+		case int64:
+			_, err = e.c.db().Exec("UPDATE attributes SET num = ? WHERE entity = ? AND id = ?", v, id, attributeID)
+			num = &v
+		case string:
+			_, err = e.c.db().Exec("UPDATE attributes SET str = ? WHERE entity = ? AND id = ?", v, id, attributeID)
+			str = &v
+		case []byte:
+			_, err = e.c.db().Exec("UPDATE attributes SET data = ? WHERE entity = ? AND id = ?", v, id, attributeID)
+			data = v
+		default:
+			return errors.New("unsupported type")
+		}
+		if err != nil {
+			return err
+		}
+
+		newValue := auditValue(num, str, data)
+		if newValue == oldValue {
+			return nil
+		}
+		return e.changed(AuditAttribute, typeName, oldValue, newValue)
+	})
+}
+
+// Delete moves the entity and its connections to the trash
+func (e *Entity) Delete() error {
+	id, err := e.ID.MarshalBinary()
 	if err != nil {
 		return err
 	}
 
-	_, err = e.c.sql.Exec("DELETE FROM connections WHERE superior = ? OR inferior = ?", id, id)
+	deletedAt := time.Now().Unix()
+	err = e.c.Transaction(func() error {
+		_, err := e.c.db().Exec("UPDATE entities SET deleted_at = ? WHERE id = ?", deletedAt, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = e.c.db().Exec(`
+			UPDATE connections SET deleted_at = ?, deleted_with = ?
+			WHERE (superior = ? OR inferior = ?) AND deleted_at IS NULL`,
+			deletedAt, id, id, id)
+		if err != nil {
+			return err
+		}
+
+		return e.c.audit(AuditDelete, e.ID, uuid.Nil, "", strconv.Quote(e.Name), "")
+	})
 	if err != nil {
 		return err
 	}
@@ -518,11 +935,19 @@ func (e *Entity) Delete() error {
 }
 
 func (e *Entity) ConnectTo(inferior *Entity, connectionName string) error {
+	_, err := e.connectTo(inferior, connectionName, uuid.New())
+	return err
+}
+
+// Connect with an already set ID. A connection with the same ID in the trash
+// is taken out of it with the new ends and name instead, restored reports
+// whether that happened.
+func (e *Entity) connectTo(inferior *Entity, connectionName string, connectionID uuid.UUID) (restored bool, err error) {
 	if e.ID == inferior.ID {
-		return errors.New("can not connect to itself")
+		return false, ErrConnectToItself
 	}
 	connection := Connection{
-		ID:       uuid.New(),
+		ID:       connectionID,
 		Name:     connectionName,
 		Superior: e.ID,
 		Inferior: inferior.ID,
@@ -530,22 +955,49 @@ func (e *Entity) ConnectTo(inferior *Entity, connectionName string) error {
 
 	id, err := connection.ID.MarshalBinary()
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	superiorID, err := connection.Superior.MarshalBinary()
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	inferiorID, err := connection.Inferior.MarshalBinary()
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	_, err = e.c.sql.Exec("INSERT INTO connections (id, superior, inferior, name) VALUES (?, ?, ?, ?)", id, superiorID, inferiorID, connection.Name)
+	err = e.c.Transaction(func() error {
+		now := time.Now().Unix()
+
+		var createdAt int64
+		row := e.c.db().QueryRow(`
+			UPDATE connections SET superior = ?, inferior = ?, name = ?, deleted_at = NULL, deleted_with = NULL, updated_at = ?
+			WHERE id = ? AND deleted_at IS NOT NULL
+			RETURNING created_at`, superiorID, inferiorID, connection.Name, now, id)
+		err := row.Scan(&createdAt)
+		if err == nil {
+			restored = true
+			connection.CreatedAt = unixTime(createdAt)
+			connection.UpdatedAt = unixTime(now)
+			return e.c.audit(AuditRestore, e.ID, inferior.ID, connection.Name, "", e.c.auditConnection(&connection))
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		_, err = e.c.db().Exec("INSERT INTO connections (id, superior, inferior, name, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+			id, superiorID, inferiorID, connection.Name, now, now)
+		if err != nil {
+			return err
+		}
+		connection.CreatedAt = unixTime(now)
+		connection.UpdatedAt = connection.CreatedAt
+
+		return e.c.audit(AuditConnect, e.ID, inferior.ID, connection.Name, "", e.c.auditConnection(&connection))
+	})
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	e.c.Connections[connection.ID] = &connection
@@ -554,7 +1006,7 @@ func (e *Entity) ConnectTo(inferior *Entity, connectionName string) error {
 	e.Connections = append(e.Connections, connection.ID)
 	inferior.Connections = append(inferior.Connections, connection.ID)
 
-	return nil
+	return restored, nil
 }
 
 func (e *Entity) UpdatePosition() error {
@@ -563,24 +1015,93 @@ func (e *Entity) UpdatePosition() error {
 		return err
 	}
 
-	_, err = e.c.sql.Exec("UPDATE entities SET posx = ?, posy = ? WHERE id = ?", e.X, e.Y, id)
+	return e.c.Transaction(func() error {
+		var oldX, oldY int32
+		row := e.c.db().QueryRow("SELECT posx, posy FROM entities WHERE id = ?", id)
+		err := row.Scan(&oldX, &oldY)
+		if err != nil {
+			return err
+		}
+		if oldX == e.X && oldY == e.Y {
+			return nil
+		}
+
+		_, err = e.c.db().Exec("UPDATE entities SET posx = ?, posy = ? WHERE id = ?", e.X, e.Y, id)
+		if err != nil {
+			return err
+		}
+
+		return e.changed(AuditMove, "", formatPosition(oldX, oldY), formatPosition(e.X, e.Y))
+	})
+}
+
+func (e *Entity) Rename(name string) error {
+	id, err := e.ID.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	if name == e.Name {
+		return nil
+	}
+
+	err = e.c.Transaction(func() error {
+		_, err := e.c.db().Exec("UPDATE entities SET name = ? WHERE id = ?", name, id)
+		if err != nil {
+			return err
+		}
+
+		return e.changed(AuditRename, "", strconv.Quote(e.Name), strconv.Quote(name))
+	})
 	if err != nil {
 		return err
 	}
+
+	e.Name = name
 	return nil
 }
 
+// Record a change of the entity in the audit trail and update its modification
+// time
+func (e *Entity) changed(op AuditOperation, field, from, to string) error {
+	now := time.Now().Unix()
+	_, err := e.c.db().Exec("UPDATE entities SET updated_at = ? WHERE id = ?", now, e.ID[:])
+	if err != nil {
+		return err
+	}
+	e.UpdatedAt = unixTime(now)
+
+	return e.c.audit(op, e.ID, uuid.Nil, field, from, to)
+}
+
+// Times are stored as Unix seconds, 0 when unknown
+func unixTime(t int64) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t, 0)
+}
+
 func removeFromSlice[T any](s []T, i int) []T {
 	return append(s[:i], s[i+1:]...)
 }
 
+// RemoveConnection moves the connection to the trash
 func (c *Conatho) RemoveConnection(connection *Connection) error {
 	id, err := connection.ID.MarshalBinary()
 	if err != nil {
 		return err
 	}
 
-	_, err = c.sql.Exec("DELETE FROM connections WHERE id = ?", id)
+	err = c.Transaction(func() error {
+		now := time.Now().Unix()
+		_, err := c.db().Exec("UPDATE connections SET deleted_at = ?, updated_at = ? WHERE id = ?", now, now, id)
+		if err != nil {
+			return err
+		}
+
+		return c.audit(AuditDisconnect, connection.Superior, connection.Inferior, connection.Name, c.auditConnection(connection), "")
+	})
 	if err != nil {
 		return err
 	}
@@ -621,9 +1142,10 @@ func (c *Conatho) EntityGetAll() error {
 	// Empty entities
 	c.Entities = make(map[uuid.UUID]*Entity)
 
-	rows, err := c.sql.Query(`
-		SELECT id, name, posx, posy, image
+	rows, err := c.db().Query(`
+		SELECT id, name, posx, posy, image, created_at, updated_at
 		FROM entities
+		WHERE deleted_at IS NULL
 	`)
 	if err != nil {
 		return err
@@ -632,10 +1154,13 @@ func (c *Conatho) EntityGetAll() error {
 
 	for rows.Next() {
 		e := Entity{c: c}
-		err := rows.Scan(&e.ID, &e.Name, &e.X, &e.Y, &e.Image)
+		var createdAt, updatedAt int64
+		err := rows.Scan(&e.ID, &e.Name, &e.X, &e.Y, &e.Image, &createdAt, &updatedAt)
 		if err != nil {
 			return err
 		}
+		e.CreatedAt = unixTime(createdAt)
+		e.UpdatedAt = unixTime(updatedAt)
 
 		c.Entities[e.ID] = &e
 	}
@@ -649,9 +1174,10 @@ func (c *Conatho) EntityGetAll() error {
 	// Empty connections
 	c.Connections = make(map[uuid.UUID]*Connection)
 
-	rows, err = c.sql.Query(`
-		SELECT id, superior, inferior, name
+	rows, err = c.db().Query(`
+		SELECT id, superior, inferior, name, created_at, updated_at
 		FROM connections
+		WHERE deleted_at IS NULL
 	`)
 	if err != nil {
 		return err
@@ -660,10 +1186,13 @@ func (c *Conatho) EntityGetAll() error {
 
 	for rows.Next() {
 		connection := Connection{}
-		err := rows.Scan(&connection.ID, &connection.Superior, &connection.Inferior, &connection.Name)
+		var createdAt, updatedAt int64
+		err := rows.Scan(&connection.ID, &connection.Superior, &connection.Inferior, &connection.Name, &createdAt, &updatedAt)
 		if err != nil {
 			return err
 		}
+		connection.CreatedAt = unixTime(createdAt)
+		connection.UpdatedAt = unixTime(updatedAt)
 
 		c.Connections[connection.ID] = &connection
 
@@ -685,3 +1214,29 @@ func (c *Conatho) EntityGetAll() error {
 
 	return nil
 }
+
+// ModifiedSince returns the entities and connections created or changed since
+// the given time, the most recently changed first
+func (c *Conatho) ModifiedSince(since time.Time) ([]*Entity, []*Connection) {
+	var entities []*Entity
+	for _, k := range c.EntitiesKeys {
+		if e := c.Entities[k]; !e.UpdatedAt.Before(since) {
+			entities = append(entities, e)
+		}
+	}
+	slices.SortFunc(entities, func(a, b *Entity) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+
+	var connections []*Connection
+	for _, k := range c.ConnectionsKeys {
+		if connection := c.Connections[k]; !connection.UpdatedAt.Before(since) {
+			connections = append(connections, connection)
+		}
+	}
+	slices.SortFunc(connections, func(a, b *Connection) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+
+	return entities, connections
+}
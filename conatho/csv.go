@@ -0,0 +1,421 @@
+package conatho
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// CSVTable is a parsed CSV file, the first line holds the headers
+type CSVTable struct {
+	Headers []string
+	Rows    [][]string
+}
+
+// CSVColumn maps a column to an attribute type
+type CSVColumn struct {
+	Column int
+	// ID of an existing attribute type, when 0 a new attribute type named
+	// after the header is created
+	AttributeType int64
+	// Datatype of a new attribute type
+	Datatype Datatype
+	// Mark the attribute type as unique key, rows with a value matching an
+	// existing entity update that entity
+	Key bool
+}
+
+type CSVEntityMapping struct {
+	NameColumn int
+	Columns    []CSVColumn
+}
+
+type CSVConnectionMapping struct {
+	SuperiorColumn int
+	InferiorColumn int
+	// Column holding the name of the connection, -1 if there is none
+	NameColumn int
+	// Attribute type holding the key entities are matched on, when 0 entities
+	// are matched by name
+	MatchAttribute int64
+}
+
+func ReadCSV(r io.Reader) (CSVTable, error) {
+	var t CSVTable
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return t, err
+	}
+	if len(records) == 0 {
+		return t, errors.New("file is empty")
+	}
+
+	t.Headers = records[0]
+	for _, record := range records[1:] {
+		// Pad short rows so every row has a cell for each header
+		for len(record) < len(t.Headers) {
+			record = append(record, "")
+		}
+		t.Rows = append(t.Rows, record)
+	}
+
+	return t, nil
+}
+
+// Column returns the index of the column with the header, ignoring case
+func (t CSVTable) Column(header string) (int, bool) {
+	for i, h := range t.Headers {
+		if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(header)) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// DetectDatatype returns DatatypeNumber when every filled in cell of the
+// column is a whole number, DatatypeString otherwise
+func (t CSVTable) DetectDatatype(column int) Datatype {
+	found := false
+	for _, row := range t.Rows {
+		cell := strings.TrimSpace(row[column])
+		if cell == "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(cell, 10, 64); err != nil {
+			return DatatypeString
+		}
+		found = true
+	}
+
+	if !found {
+		return DatatypeString
+	}
+	return DatatypeNumber
+}
+
+// NameColumn returns the column named "name", or the first column
+func (t CSVTable) NameColumn() int {
+	if i, ok := t.Column("name"); ok {
+		return i
+	}
+	return 0
+}
+
+// DefaultEntityMapping maps every column except the name column to the
+// attribute type with the same name, or a new one
+func (t CSVTable) DefaultEntityMapping(c *Conatho, nameColumn int) CSVEntityMapping {
+	m := CSVEntityMapping{NameColumn: nameColumn}
+
+	for i, header := range t.Headers {
+		if i == m.NameColumn {
+			continue
+		}
+
+		column := CSVColumn{Column: i, Datatype: t.DetectDatatype(i)}
+		if id, ok := c.AttributeTypeByName(header); ok {
+			column.AttributeType = id
+			column.Key = c.AttributeTypes[id].Key
+		}
+		m.Columns = append(m.Columns, column)
+	}
+
+	return m
+}
+
+// Convert a cell to a value for the datatype
+func csvValue(datatype Datatype, cell string) (any, error) {
+	switch datatype {
+	case DatatypeNumber:
+		return strconv.ParseInt(strings.TrimSpace(cell), 10, 64)
+	case DatatypeData:
+		return []byte(cell), nil
+	}
+	return cell, nil
+}
+
+// ImportCSVEntities creates an entity for every row of the table in a single
+// transaction. When a column holds a unique key, rows matching an existing
+// entity update that entity instead.
+func (c *Conatho) ImportCSVEntities(t CSVTable, m CSVEntityMapping) (ImportReport, error) {
+	var report ImportReport
+
+	if m.NameColumn < 0 || m.NameColumn >= len(t.Headers) {
+		return report, errors.New("name column out of range")
+	}
+	for _, column := range m.Columns {
+		if column.Column < 0 || column.Column >= len(t.Headers) {
+			return report, errors.New("column out of range")
+		}
+	}
+
+	err := c.Transaction(func() error {
+		columns := make([]CSVColumn, len(m.Columns))
+		copy(columns, m.Columns)
+
+		for i := range columns {
+			if columns[i].AttributeType != 0 {
+				if _, ok := c.AttributeTypes[columns[i].AttributeType]; !ok {
+					return errors.New("unknown attribute type")
+				}
+				continue
+			}
+
+			id, err := c.AddAttributeType(strings.TrimSpace(t.Headers[columns[i].Column]), columns[i].Datatype)
+			if err != nil {
+				return err
+			}
+			columns[i].AttributeType = id
+			report.attributeType(c.AttributeTypes[id].Name)
+		}
+
+		for _, column := range columns {
+			if column.Key && !c.AttributeTypes[column.AttributeType].Key {
+				err := c.SetAttributeTypeKey(column.AttributeType, true)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// Rows are matched on the first column marked as key, or else the
+		// first column holding a unique key
+		keyColumn := slices.IndexFunc(columns, func(column CSVColumn) bool {
+			return column.Key
+		})
+		if keyColumn < 0 {
+			keyColumn = slices.IndexFunc(columns, func(column CSVColumn) bool {
+				return c.AttributeTypes[column.AttributeType].Key
+			})
+		}
+		var index map[string][]*Entity
+		if keyColumn >= 0 {
+			var err error
+			index, err = c.entityIndex(columns[keyColumn].AttributeType)
+			if err != nil {
+				return err
+			}
+		}
+
+		placer := c.newImportPlacer()
+	rows:
+		for line, row := range t.Rows {
+			name := strings.TrimSpace(row[m.NameColumn])
+			if name == "" {
+				report.drop("line %d without a name", line+2)
+				continue
+			}
+
+			values := make([]any, len(columns))
+			for i, column := range columns {
+				cell := row[column.Column]
+				if strings.TrimSpace(cell) == "" {
+					continue
+				}
+
+				value, err := csvValue(c.AttributeTypes[column.AttributeType].Type, cell)
+				if err != nil {
+					report.drop("line %d: value %q of %q is not a number", line+2, cell, t.Headers[column.Column])
+					if i == keyColumn {
+						continue rows
+					}
+					continue
+				}
+				values[i] = value
+			}
+
+			key := ""
+			if keyColumn >= 0 && values[keyColumn] != nil {
+				key = keyString(values[keyColumn])
+
+				matches := index[key]
+				if len(matches) > 1 {
+					report.drop("line %d: %d entities match key %q", line+2, len(matches), key)
+					continue
+				} else if len(matches) == 1 {
+					u, err := matches[0].newAttributeUpdater()
+					if err != nil {
+						return err
+					}
+
+					err = u.rename(name)
+					if err != nil {
+						return err
+					}
+					for i, value := range values {
+						if value == nil {
+							continue
+						}
+						err := u.set(columns[i].AttributeType, value)
+						if err != nil {
+							return err
+						}
+					}
+
+					report.entity(u.action(), "line %d: entity %q", line+2, name)
+					continue
+				}
+			}
+
+			e := Entity{ID: uuid.New(), Name: name}
+			e.X, e.Y = placer.next()
+			_, err := c.insertEntity(&e)
+			if err != nil {
+				return err
+			}
+			report.entity(ImportCreated, "line %d: entity %q", line+2, name)
+
+			if key != "" {
+				index[key] = append(index[key], &e)
+			}
+
+			for i, value := range values {
+				if value == nil {
+					continue
+				}
+				_, err := e.addAttributeValue(columns[i].AttributeType, value)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return report, nil
+}
+
+// Find entities by the value of an attribute, or by name when the attribute
+// type is 0
+func (c *Conatho) entityIndex(attributeTypeID int64) (map[string][]*Entity, error) {
+	index := make(map[string][]*Entity)
+
+	if attributeTypeID == 0 {
+		for _, k := range c.EntitiesKeys {
+			e := c.Entities[k]
+			index[e.Name] = append(index[e.Name], e)
+		}
+		return index, nil
+	}
+
+	rows, err := c.db().Query(`
+		SELECT entity, num, str
+		FROM attributes
+		WHERE type = ?`, attributeTypeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var num *int64
+		var str *string
+		err := rows.Scan(&id, &num, &str)
+		if err != nil {
+			return nil, err
+		}
+
+		e, ok := c.Entities[id]
+		if !ok {
+			continue
+		}
+
+		if num != nil {
+			key := strconv.FormatInt(*num, 10)
+			index[key] = append(index[key], e)
+		} else if str != nil {
+			index[*str] = append(index[*str], e)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// ImportCSVConnections creates a connection for every row of an edge list in
+// a single transaction
+func (c *Conatho) ImportCSVConnections(t CSVTable, m CSVConnectionMapping) (ImportReport, error) {
+	var report ImportReport
+
+	for _, column := range []int{m.SuperiorColumn, m.InferiorColumn} {
+		if column < 0 || column >= len(t.Headers) {
+			return report, errors.New("column out of range")
+		}
+	}
+	if m.NameColumn >= len(t.Headers) {
+		return report, errors.New("name column out of range")
+	}
+	if _, ok := c.AttributeTypes[m.MatchAttribute]; m.MatchAttribute != 0 && !ok {
+		return report, errors.New("unknown attribute type")
+	}
+
+	err := c.Transaction(func() error {
+		index, err := c.entityIndex(m.MatchAttribute)
+		if err != nil {
+			return err
+		}
+
+		find := func(line int, key string) *Entity {
+			key = strings.TrimSpace(key)
+			entities := index[key]
+			if len(entities) == 0 {
+				report.drop("line %d: no entity %q", line+2, key)
+				return nil
+			} else if len(entities) > 1 {
+				report.drop("line %d: %d entities match %q", line+2, len(entities), key)
+				return nil
+			}
+			return entities[0]
+		}
+
+		for line, row := range t.Rows {
+			superior := find(line, row[m.SuperiorColumn])
+			inferior := find(line, row[m.InferiorColumn])
+			if superior == nil || inferior == nil {
+				continue
+			}
+
+			name := ""
+			if m.NameColumn >= 0 {
+				name = strings.TrimSpace(row[m.NameColumn])
+			}
+
+			if c.connected(superior, inferior, name) {
+				report.connection(ImportUnchanged, "line %d: connection %q from %q to %q", line+2, name, superior.Name, inferior.Name)
+				continue
+			}
+
+			err := superior.ConnectTo(inferior, name)
+			if errors.Is(err, ErrConnectToItself) {
+				report.drop("line %d: connects %q to itself", line+2, superior.Name)
+				continue
+			} else if err != nil {
+				return err
+			}
+			report.connection(ImportCreated, "line %d: connection %q from %q to %q", line+2, name, superior.Name, inferior.Name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,72 @@
+package conatho
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCSVDetectDatatype(t *testing.T) {
+	table, err := ReadCSV(strings.NewReader(`name,age,year,phone,city,empty,short
+Alice,42,1980,+31 20 123,Paris,,1
+Bob, 7 ,-300,020-123,,,
+Carol,,+12,0612,London,
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for header, want := range map[string]Datatype{
+		"name":  DatatypeString,
+		"age":   DatatypeNumber,
+		"year":  DatatypeNumber,
+		"phone": DatatypeString,
+		"city":  DatatypeString,
+		"empty": DatatypeString,
+		"short": DatatypeNumber,
+	} {
+		column, ok := table.Column(header)
+		if !ok {
+			t.Fatalf("no column %q", header)
+		}
+		if got := table.DetectDatatype(column); got != want {
+			t.Errorf("column %q detected as %s, want %s", header, got, want)
+		}
+	}
+}
+
+func TestImportCSVEntitiesDatatypes(t *testing.T) {
+	c := testConatho(t)
+
+	table, err := ReadCSV(strings.NewReader("Name,Age,Zip\nAlice,42,01234\nBob,,1234AB\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := c.ImportCSVEntities(table, table.DefaultEntityMapping(c, table.NameColumn()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entities != 2 || report.AttributeTypes != 2 || len(report.Dropped) > 0 {
+		t.Errorf("report:\n%s", report)
+	}
+
+	for name, want := range map[string]Datatype{"Age": DatatypeNumber, "Zip": DatatypeString} {
+		id, ok := c.AttributeTypeByName(name)
+		if !ok {
+			t.Fatalf("no attribute type %q", name)
+		}
+		if got := c.AttributeTypes[id].Type; got != want {
+			t.Errorf("attribute type %q is %s, want %s", name, got, want)
+		}
+	}
+
+	// Leading zeros are kept in text columns
+	alice := attributeValues(t, entityByName(t, c, "Alice"))
+	if alice["Age"] != int64(42) || alice["Zip"] != "01234" {
+		t.Errorf("attributes of Alice: %v", alice)
+	}
+	bob := attributeValues(t, entityByName(t, c, "Bob"))
+	if _, ok := bob["Age"]; ok || bob["Zip"] != "1234AB" {
+		t.Errorf("attributes of Bob: %v", bob)
+	}
+}
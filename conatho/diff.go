@@ -0,0 +1,355 @@
+package conatho
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type ChangeKind int
+
+const (
+	ChangeAdded ChangeKind = iota + 1
+	ChangeRemoved
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	}
+	return strconv.Itoa(int(k))
+}
+
+// Symbol the kind of change is shown with
+func (k ChangeKind) symbol() string {
+	switch k {
+	case ChangeAdded:
+		return "+"
+	case ChangeRemoved:
+		return "-"
+	}
+	return "~"
+}
+
+// FieldChange is a change of a single property of a modified item, the values
+// are formatted for display
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// Values of absent items and attributes without a value
+const (
+	diffNone   = "none"
+	diffNotSet = "not set"
+)
+
+type AttributeTypeChange struct {
+	Kind    ChangeKind
+	Old     *DocumentAttributeType // nil when added
+	New     *DocumentAttributeType // nil when removed
+	Changes []FieldChange
+}
+
+type EntityChange struct {
+	Kind    ChangeKind
+	Old     *DocumentEntity
+	New     *DocumentEntity
+	Changes []FieldChange
+}
+
+type ConnectionChange struct {
+	Kind    ChangeKind
+	Old     *DocumentConnection
+	New     *DocumentConnection
+	Changes []FieldChange
+}
+
+// Changes are the differences between two files, attribute types are sorted
+// by name, entities and connections by ID
+type Changes struct {
+	AttributeTypes []AttributeTypeChange
+	Entities       []EntityChange
+	Connections    []ConnectionChange
+}
+
+func (c Changes) Empty() bool {
+	return len(c.AttributeTypes) == 0 && len(c.Entities) == 0 && len(c.Connections) == 0
+}
+
+// Diff reports what changed from file a to file b. Entities and connections
+// are matched by UUID, attribute types by name.
+func Diff(a, b *Conatho) (Changes, error) {
+	docA, err := a.Document()
+	if err != nil {
+		return Changes{}, err
+	}
+
+	docB, err := b.Document()
+	if err != nil {
+		return Changes{}, err
+	}
+
+	return DiffDocuments(docA, docB), nil
+}
+
+// Match up the items of two sorted lists by their key, missing items are nil
+func matchItems[T any, K any](a, b []T, key func(T) K, compare func(K, K) int, fn func(a, b *T)) {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && compare(key(a[i]), key(b[j])) < 0):
+			fn(&a[i], nil)
+			i++
+		case i == len(a) || compare(key(a[i]), key(b[j])) > 0:
+			fn(nil, &b[j])
+			j++
+		default:
+			fn(&a[i], &b[j])
+			i++
+			j++
+		}
+	}
+}
+
+// DiffDocuments reports what changed from document a to document b, the
+// documents must be sorted like the ones returned by Document
+func DiffDocuments(a, b Document) Changes {
+	var changes Changes
+
+	// The IDs of attribute types differ between files, like merging they are
+	// matched by name
+	aNames := attributeTypeNames(&a)
+	bNames := attributeTypeNames(&b)
+	byName := func(types []DocumentAttributeType) []DocumentAttributeType {
+		types = slices.Clone(types)
+		slices.SortFunc(types, func(x, y DocumentAttributeType) int {
+			return strings.Compare(x.Name, y.Name)
+		})
+		return types
+	}
+
+	entityNames := make(map[uuid.UUID]string)
+	for _, de := range a.Entities {
+		entityNames[de.ID] = de.Name
+	}
+	for _, de := range b.Entities {
+		entityNames[de.ID] = de.Name
+	}
+
+	matchItems(byName(a.AttributeTypes), byName(b.AttributeTypes), func(dt DocumentAttributeType) string { return dt.Name }, strings.Compare, func(from, to *DocumentAttributeType) {
+		change := AttributeTypeChange{Old: from, New: to}
+		switch {
+		case from == nil:
+			change.Kind = ChangeAdded
+		case to == nil:
+			change.Kind = ChangeRemoved
+		default:
+			change.Kind = ChangeModified
+			change.Changes = diffFields(
+				FieldChange{"datatype", from.Datatype.String(), to.Datatype.String()},
+				FieldChange{"key", strconv.FormatBool(from.Key), strconv.FormatBool(to.Key)},
+			)
+			if len(change.Changes) == 0 {
+				return
+			}
+		}
+		changes.AttributeTypes = append(changes.AttributeTypes, change)
+	})
+
+	matchItems(a.Entities, b.Entities, func(de DocumentEntity) uuid.UUID { return de.ID }, compareUUID, func(from, to *DocumentEntity) {
+		change := EntityChange{Old: from, New: to}
+		switch {
+		case from == nil:
+			change.Kind = ChangeAdded
+		case to == nil:
+			change.Kind = ChangeRemoved
+		default:
+			change.Kind = ChangeModified
+			change.Changes = diffFields(
+				FieldChange{"name", strconv.Quote(from.Name), strconv.Quote(to.Name)},
+				FieldChange{"position", formatPosition(from.X, from.Y), formatPosition(to.X, to.Y)},
+			)
+			change.Changes = append(change.Changes, diffImages(from.Images, to.Images)...)
+			change.Changes = append(change.Changes, diffAttributes(from.Attributes, to.Attributes, aNames, bNames)...)
+			if len(change.Changes) == 0 {
+				return
+			}
+		}
+		changes.Entities = append(changes.Entities, change)
+	})
+
+	matchItems(a.Connections, b.Connections, func(dc DocumentConnection) uuid.UUID { return dc.ID }, compareUUID, func(from, to *DocumentConnection) {
+		change := ConnectionChange{Old: from, New: to}
+		switch {
+		case from == nil:
+			change.Kind = ChangeAdded
+		case to == nil:
+			change.Kind = ChangeRemoved
+		default:
+			change.Kind = ChangeModified
+			change.Changes = diffFields(
+				FieldChange{"name", strconv.Quote(from.Name), strconv.Quote(to.Name)},
+				FieldChange{"superior", strconv.Quote(entityNames[from.Superior]), strconv.Quote(entityNames[to.Superior])},
+				FieldChange{"inferior", strconv.Quote(entityNames[from.Inferior]), strconv.Quote(entityNames[to.Inferior])},
+			)
+			// Entities with the same name are told apart by their ID
+			if from.Superior != to.Superior && entityNames[from.Superior] == entityNames[to.Superior] {
+				change.Changes = append(change.Changes, FieldChange{"superior", from.Superior.String(), to.Superior.String()})
+			}
+			if from.Inferior != to.Inferior && entityNames[from.Inferior] == entityNames[to.Inferior] {
+				change.Changes = append(change.Changes, FieldChange{"inferior", from.Inferior.String(), to.Inferior.String()})
+			}
+			if len(change.Changes) == 0 {
+				return
+			}
+		}
+		changes.Connections = append(changes.Connections, change)
+	})
+
+	return changes
+}
+
+// The fields that have a different value
+func diffFields(fields ...FieldChange) []FieldChange {
+	var changes []FieldChange
+	for _, field := range fields {
+		if field.Old != field.New {
+			changes = append(changes, field)
+		}
+	}
+	return changes
+}
+
+// Attributes are matched by the name of their type, the n-th attribute of a
+// type with the n-th attribute of that type
+func diffAttributes(from, to []DocumentAttribute, fromNames, toNames map[int64]string) []FieldChange {
+	oldGroups := groupAttributes(from, fromNames)
+	newGroups := groupAttributes(to, toNames)
+
+	// Types in the order they first appear
+	order := oldGroups.order
+	for _, name := range newGroups.order {
+		if _, ok := oldGroups.byName[name]; !ok {
+			order = append(order, name)
+		}
+	}
+
+	var changes []FieldChange
+	for _, name := range order {
+		oldValues, newValues := oldGroups.byName[name], newGroups.byName[name]
+		for i := range max(len(oldValues), len(newValues)) {
+			field := FieldChange{Field: "attribute " + strconv.Quote(name), Old: diffNone, New: diffNone}
+			if i < len(oldValues) {
+				field.Old = formatAttribute(oldValues[i])
+			}
+			if i < len(newValues) {
+				field.New = formatAttribute(newValues[i])
+			}
+			if field.Old != field.New {
+				changes = append(changes, field)
+			}
+		}
+	}
+	return changes
+}
+
+// Images are matched by their position
+func diffImages(from, to []DocumentImage) []FieldChange {
+	var changes []FieldChange
+	for i := range max(len(from), len(to)) {
+		field := FieldChange{Field: "image " + strconv.Itoa(i+1), Old: diffNone, New: diffNone}
+		if i < len(from) {
+			field.Old = formatImage(from[i])
+		}
+		if i < len(to) {
+			field.New = formatImage(to[i])
+		}
+		if field.Old != field.New {
+			changes = append(changes, field)
+		}
+	}
+	return changes
+}
+
+func formatPosition(x, y int32) string {
+	return fmt.Sprintf("%d, %d", x, y)
+}
+
+func formatImage(di DocumentImage) string {
+	s := fmt.Sprintf("%s, %d bytes, sha256 %.12s", di.MIMEType, len(di.Data), blobHash(di.Data))
+	if di.Primary {
+		s += ", primary"
+	}
+	if edit := di.edit(); !edit.IsZero() {
+		s += ", " + edit.String()
+	}
+	if di.Caption != "" {
+		s += ", " + strconv.Quote(di.Caption)
+	}
+	return s
+}
+
+func formatAttribute(da DocumentAttribute) string {
+	switch {
+	case da.Number != nil:
+		return strconv.FormatInt(*da.Number, 10)
+	case da.String != nil:
+		return strconv.Quote(*da.String)
+	case da.Data != nil:
+		return fmt.Sprintf("%d bytes, sha256 %.12s", len(da.Data.Data), blobHash(da.Data.Data))
+	}
+	return diffNotSet
+}
+
+func writeFieldChanges(sb *strings.Builder, changes []FieldChange) {
+	for _, change := range changes {
+		fmt.Fprintf(sb, "\t%s: %s -> %s\n", change.Field, change.Old, change.New)
+	}
+}
+
+// String lists the changes, one item per line with the changed fields below
+// it. Added items are prefixed with +, removed items with - and modified ones
+// with ~.
+func (c Changes) String() string {
+	var sb strings.Builder
+
+	for _, change := range c.AttributeTypes {
+		dt := change.New
+		if dt == nil {
+			dt = change.Old
+		}
+		fmt.Fprintf(&sb, "%s attribute type %s (%s)\n", change.Kind.symbol(), strconv.Quote(dt.Name), dt.Datatype)
+		writeFieldChanges(&sb, change.Changes)
+	}
+
+	for _, change := range c.Entities {
+		de := change.New
+		if de == nil {
+			de = change.Old
+		}
+		fmt.Fprintf(&sb, "%s entity %s %s\n", change.Kind.symbol(), strconv.Quote(de.Name), de.ID)
+		writeFieldChanges(&sb, change.Changes)
+	}
+
+	for _, change := range c.Connections {
+		dc := change.New
+		if dc == nil {
+			dc = change.Old
+		}
+		fmt.Fprintf(&sb, "%s connection %s %s\n", change.Kind.symbol(), strconv.Quote(dc.Name), dc.ID)
+		writeFieldChanges(&sb, change.Changes)
+	}
+
+	return sb.String()
+}
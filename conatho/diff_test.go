@@ -0,0 +1,77 @@
+package conatho
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDiffDocumentsTypesByName(t *testing.T) {
+	id := uuid.New()
+
+	// The same types with swapped IDs
+	a := testDocument([]DocumentAttributeType{
+		{ID: 1, Name: "Age", Datatype: DatatypeString},
+		{ID: 2, Name: "Role", Datatype: DatatypeString},
+	}, DocumentEntity{ID: id, Name: "Alice", Attributes: []DocumentAttribute{
+		stringAttribute(1, 1, "42"),
+		stringAttribute(2, 2, "Manager"),
+	}})
+	b := testDocument([]DocumentAttributeType{
+		{ID: 1, Name: "Role", Datatype: DatatypeString},
+		{ID: 2, Name: "Age", Datatype: DatatypeString},
+	}, DocumentEntity{ID: id, Name: "Alice", Attributes: []DocumentAttribute{
+		stringAttribute(1, 2, "42"),
+		stringAttribute(2, 1, "Director"),
+	}})
+
+	changes := DiffDocuments(a, b)
+	if len(changes.AttributeTypes) != 0 {
+		t.Errorf("attribute types changed: %s", changes)
+	}
+	if len(changes.Entities) != 1 {
+		t.Fatalf("got %d changed entities, want 1:\n%s", len(changes.Entities), changes)
+	}
+
+	want := FieldChange{Field: `attribute "Role"`, Old: `"Manager"`, New: `"Director"`}
+	if got := changes.Entities[0].Changes; len(got) != 1 || got[0] != want {
+		t.Errorf("changes %v, want %v", got, want)
+	}
+}
+
+func TestDiffDocumentsTypeChanges(t *testing.T) {
+	a := testDocument([]DocumentAttributeType{
+		{ID: 1, Name: "Age", Datatype: DatatypeNumber},
+		{ID: 2, Name: "Old", Datatype: DatatypeString},
+	})
+	b := testDocument([]DocumentAttributeType{
+		{ID: 1, Name: "New", Datatype: DatatypeString},
+		{ID: 2, Name: "Age", Datatype: DatatypeNumber, Key: true},
+	})
+
+	changes := DiffDocuments(a, b)
+	if len(changes.AttributeTypes) != 3 {
+		t.Fatalf("got %d changed attribute types, want 3:\n%s", len(changes.AttributeTypes), changes)
+	}
+
+	for i, want := range []struct {
+		kind ChangeKind
+		name string
+	}{
+		{ChangeModified, "Age"},
+		{ChangeAdded, "New"},
+		{ChangeRemoved, "Old"},
+	} {
+		change := changes.AttributeTypes[i]
+		dt := change.New
+		if dt == nil {
+			dt = change.Old
+		}
+		if change.Kind != want.kind || dt.Name != want.name {
+			t.Errorf("change %d: %s %q, want %s %q", i, change.Kind, dt.Name, want.kind, want.name)
+		}
+	}
+	if got := changes.AttributeTypes[0].Changes; len(got) != 1 || got[0].Field != "key" {
+		t.Errorf("changes of Age: %v", got)
+	}
+}
@@ -0,0 +1,842 @@
+package conatho
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xfmoulet/qoi"
+)
+
+// DocumentFormat identifies a JSON document as a conatho document
+const DocumentFormat = "conatho"
+
+// DocumentVersion is the version of the document format written by Export,
+// it is increased whenever the format changes in an incompatible way
+const DocumentVersion = 2
+
+// DocumentSchema is the JSON schema describing the document format
+//
+//go:embed schema.json
+var DocumentSchema []byte
+
+var ErrUnknownDocument = errors.New("not a conatho document")
+var ErrNewerDocument = errors.New("document was created by a newer version")
+
+// Document is the complete contents of a file, without view state
+type Document struct {
+	Format         string                  `json:"format"`
+	Version        int                     `json:"version"`
+	AttributeTypes []DocumentAttributeType `json:"attribute_types"`
+	Entities       []DocumentEntity        `json:"entities"`
+	Connections    []DocumentConnection    `json:"connections"`
+}
+
+type DocumentAttributeType struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Datatype Datatype `json:"datatype"`
+	Key      bool     `json:"key,omitempty"`
+}
+
+type DocumentEntity struct {
+	ID         uuid.UUID           `json:"id"`
+	Name       string              `json:"name"`
+	X          int32               `json:"x"`
+	Y          int32               `json:"y"`
+	Images     []DocumentImage     `json:"images,omitempty"`
+	Attributes []DocumentAttribute `json:"attributes"`
+	CreatedAt  time.Time           `json:"created_at,omitzero"`
+	UpdatedAt  time.Time           `json:"updated_at,omitzero"`
+
+	// Image is the single image of version 1 documents, ReadDocument moves it
+	// to Images
+	Image *DocumentFile `json:"image,omitempty"`
+}
+
+// DocumentImage is one of the images of an entity, in their order. The image
+// is shown turned clockwise by Rotation degrees, then flipped and cropped, see
+// ImageEdit.
+type DocumentImage struct {
+	DocumentFile
+	Caption  string        `json:"caption,omitempty"`
+	Primary  bool          `json:"primary,omitempty"`
+	Rotation int           `json:"rotation,omitempty"`
+	Flip     bool          `json:"flip,omitempty"`
+	Crop     *DocumentCrop `json:"crop,omitempty"`
+}
+
+type DocumentCrop struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// DocumentAttribute holds one of the values, depending on the datatype of its
+// type. No value means the attribute has not been set.
+type DocumentAttribute struct {
+	ID     int64         `json:"id"`
+	Type   int64         `json:"type"`
+	Number *int64        `json:"number,omitempty"`
+	String *string       `json:"string,omitempty"`
+	Data   *DocumentFile `json:"data,omitempty"`
+}
+
+type DocumentConnection struct {
+	ID        uuid.UUID `json:"id"`
+	Superior  uuid.UUID `json:"superior"`
+	Inferior  uuid.UUID `json:"inferior"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
+
+// DocumentFile is binary content, either embedded or stored in a file
+// relative to the document
+type DocumentFile struct {
+	MIMEType string `json:"mime_type,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	File     string `json:"file,omitempty"`
+}
+
+// Content of the file, never nil so empty content is not taken for an unset
+// attribute after the empty data was left out of JSON
+func (f *DocumentFile) content() []byte {
+	if f.Data == nil {
+		return []byte{}
+	}
+	return f.Data
+}
+
+var datatypeNames = map[Datatype]string{
+	DatatypeNumber: "number",
+	DatatypeString: "string",
+	DatatypeData:   "data",
+}
+
+func (d Datatype) String() string {
+	name, ok := datatypeNames[d]
+	if !ok {
+		return strconv.Itoa(int(d))
+	}
+	return name
+}
+
+func ParseDatatype(s string) (Datatype, error) {
+	for datatype, name := range datatypeNames {
+		if name == s {
+			return datatype, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown datatype %q", s)
+}
+
+func (d Datatype) MarshalText() ([]byte, error) {
+	if _, ok := datatypeNames[d]; !ok {
+		return nil, fmt.Errorf("unknown datatype %d", d)
+	}
+	return []byte(d.String()), nil
+}
+
+func (d *Datatype) UnmarshalText(text []byte) error {
+	datatype, err := ParseDatatype(string(text))
+	if err != nil {
+		return err
+	}
+	*d = datatype
+	return nil
+}
+
+// File extension for a MIME type
+func mimeExtension(mimeType string) string {
+	switch mimeType {
+	case "image/qoi":
+		return ".qoi"
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/bmp":
+		return ".bmp"
+	case "image/tiff":
+		return ".tiff"
+	}
+	return ".bin"
+}
+
+// Document returns the contents of the file, binary content is embedded
+func (c *Conatho) Document() (Document, error) {
+	doc := Document{
+		Format:         DocumentFormat,
+		Version:        DocumentVersion,
+		AttributeTypes: []DocumentAttributeType{},
+		Entities:       []DocumentEntity{},
+		Connections:    []DocumentConnection{},
+	}
+
+	for _, id := range sortedKeys(c.AttributeTypes) {
+		attributeType := c.AttributeTypes[id]
+		doc.AttributeTypes = append(doc.AttributeTypes, DocumentAttributeType{
+			ID:       id,
+			Name:     attributeType.Name,
+			Datatype: attributeType.Type,
+			Key:      attributeType.Key,
+		})
+	}
+
+	for _, k := range c.sortedEntitiesKeys() {
+		e := c.Entities[k]
+		de := DocumentEntity{
+			ID:         e.ID,
+			Name:       e.Name,
+			X:          e.X,
+			Y:          e.Y,
+			Attributes: []DocumentAttribute{},
+			CreatedAt:  e.CreatedAt.UTC(),
+			UpdatedAt:  e.UpdatedAt.UTC(),
+		}
+
+		if e.Image {
+			images, err := e.GetImages()
+			if err != nil {
+				return doc, err
+			}
+
+			for _, ei := range images {
+				img, err := e.GetImageData(ei.ID)
+				if err != nil {
+					return doc, err
+				}
+				di := DocumentImage{
+					DocumentFile: DocumentFile{MIMEType: ei.MIMEType, Data: img},
+					Caption:      ei.Caption,
+					Primary:      ei.Primary,
+				}
+				di.setEdit(ei.Edit)
+				de.Images = append(de.Images, di)
+			}
+		}
+
+		attributes, err := e.GetAttributes()
+		if err != nil {
+			return doc, err
+		}
+
+		for _, attribute := range attributes {
+			da := DocumentAttribute{ID: attribute.ID, Type: attribute.TypeID}
+			if !attribute.Null {
+				switch attribute.Type {
+				case DatatypeNumber:
+					da.Number = &attribute.Number
+				case DatatypeString:
+					da.String = &attribute.String
+				case DatatypeData:
+					da.Data = &DocumentFile{Data: attribute.Data}
+				}
+			}
+			de.Attributes = append(de.Attributes, da)
+		}
+
+		doc.Entities = append(doc.Entities, de)
+	}
+
+	for _, k := range c.sortedConnectionsKeys() {
+		connection := c.Connections[k]
+		doc.Connections = append(doc.Connections, DocumentConnection{
+			ID:        connection.ID,
+			Superior:  connection.Superior,
+			Inferior:  connection.Inferior,
+			Name:      connection.Name,
+			CreatedAt: connection.CreatedAt.UTC(),
+			UpdatedAt: connection.UpdatedAt.UTC(),
+		})
+	}
+
+	return doc, nil
+}
+
+// Files returns all binary content of the document
+func (doc *Document) Files() []*DocumentFile {
+	var files []*DocumentFile
+	for i := range doc.Entities {
+		e := &doc.Entities[i]
+		for j := range e.Images {
+			files = append(files, &e.Images[j].DocumentFile)
+		}
+		for j := range e.Attributes {
+			if e.Attributes[j].Data != nil {
+				files = append(files, e.Attributes[j].Data)
+			}
+		}
+	}
+	return files
+}
+
+// Externalize moves the embedded binary content out of the document. Images
+// are named images/<entity id>-<number><extension> and data attributes
+// data/<attribute id>.bin. QOI images, which few programs can open, are
+// written as PNG.
+func (doc *Document) Externalize(write func(name string, data []byte) error) error {
+	for i := range doc.Entities {
+		e := &doc.Entities[i]
+		for j := range e.Images {
+			img := &e.Images[j].DocumentFile
+			if img.File == "" {
+				data, ext := img.Data, mimeExtension(img.MIMEType)
+				if img.MIMEType == "image/qoi" {
+					var err error
+					data, err = qoiToPNG(img.Data)
+					if err != nil {
+						return err
+					}
+					ext = ".png"
+				}
+
+				img.File = "images/" + e.ID.String() + "-" + strconv.Itoa(j+1) + ext
+				err := write(img.File, data)
+				if err != nil {
+					return err
+				}
+				img.Data = nil
+			}
+		}
+
+		for j := range e.Attributes {
+			data := e.Attributes[j].Data
+			if data != nil && data.File == "" {
+				data.File = "data/" + strconv.FormatInt(e.Attributes[j].ID, 10) + ".bin"
+				err := write(data.File, data.Data)
+				if err != nil {
+					return err
+				}
+				data.Data = nil
+			}
+		}
+	}
+	return nil
+}
+
+// Internalize embeds all binary content stored in files, QOI images written
+// as PNG by Externalize are turned back into QOI
+func (doc *Document) Internalize(read func(name string) ([]byte, error)) error {
+	for _, f := range doc.Files() {
+		if f.File == "" {
+			continue
+		}
+
+		data, err := read(f.File)
+		if err != nil {
+			return err
+		}
+		if f.MIMEType == "image/qoi" && path.Ext(f.File) == ".png" {
+			data, err = pngToQOI(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.File, err)
+			}
+		}
+		f.Data = data
+		f.File = ""
+	}
+	return nil
+}
+
+// PNG and QOI are both lossless, converting between them keeps every pixel
+func qoiToPNG(data []byte) ([]byte, error) {
+	img, err := qoi.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+func pngToQOI(data []byte) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeQOI(img), nil
+}
+
+func writeDocument(w io.Writer, doc Document) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(doc)
+}
+
+// Export writes the file as a JSON document with binary content embedded as
+// base64
+func (c *Conatho) Export(w io.Writer) error {
+	doc, err := c.Document()
+	if err != nil {
+		return err
+	}
+
+	return writeDocument(w, doc)
+}
+
+// ExportWithFiles writes the file as a JSON document, binary content is
+// written to files in dir
+func (c *Conatho) ExportWithFiles(w io.Writer, dir string) error {
+	doc, err := c.Document()
+	if err != nil {
+		return err
+	}
+
+	err = doc.Externalize(func(name string, data []byte) error {
+		fPath := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(fPath), 0755)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(fPath, data, 0644)
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeDocument(w, doc)
+}
+
+// ReadDocument reads and checks a JSON document
+func ReadDocument(r io.Reader) (Document, error) {
+	var doc Document
+
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return doc, err
+	}
+
+	if doc.Format != DocumentFormat {
+		return doc, ErrUnknownDocument
+	}
+	if doc.Version > DocumentVersion {
+		return doc, ErrNewerDocument
+	}
+
+	doc.upgradeImages()
+
+	return doc, nil
+}
+
+// Version 1 documents have at most one image per entity
+func (doc *Document) upgradeImages() {
+	for i := range doc.Entities {
+		de := &doc.Entities[i]
+		if de.Image != nil {
+			de.Images = append([]DocumentImage{{DocumentFile: *de.Image, Primary: true}}, de.Images...)
+			de.Image = nil
+		}
+	}
+}
+
+// Import adds the contents of a JSON document to the file
+func (c *Conatho) Import(r io.Reader) (ImportReport, error) {
+	doc, err := ReadDocument(r)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	err = doc.Internalize(func(name string) ([]byte, error) {
+		return nil, fmt.Errorf("document refers to external file %q", name)
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return c.ImportDocument(doc)
+}
+
+// ImportWithFiles adds the contents of a JSON document to the file, binary
+// content may be stored in files relative to dir
+func (c *Conatho) ImportWithFiles(r io.Reader, dir string) (ImportReport, error) {
+	doc, err := ReadDocument(r)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	err = doc.Internalize(func(name string) ([]byte, error) {
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return nil, fmt.Errorf("document refers to file %q outside of %q", name, dir)
+		}
+		return os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return c.ImportDocument(doc)
+}
+
+// Value of a document attribute, nil when it has not been set
+func (da DocumentAttribute) value() any {
+	switch {
+	case da.Number != nil:
+		return *da.Number
+	case da.String != nil:
+		return *da.String
+	case da.Data != nil:
+		return da.Data.content()
+	}
+	return nil
+}
+
+// ImportDocument adds the contents of a document to the file. Attribute types
+// are matched by name, IDs are kept when they are not in use yet. Entities
+// with the value of a unique key matching an existing entity update that
+// entity instead.
+func (c *Conatho) ImportDocument(doc Document) (ImportReport, error) {
+	return c.importDocument(doc, true)
+}
+
+// Import a document, entities are only matched on unique keys with matchKeys
+func (c *Conatho) importDocument(doc Document, matchKeys bool) (ImportReport, error) {
+	var report ImportReport
+
+	err := c.Transaction(func() error {
+		// Document attribute type ID to ID in this file
+		attributeTypes := make(map[int64]int64)
+
+		for _, dt := range doc.AttributeTypes {
+			id, ok := c.AttributeTypeByName(dt.Name)
+			if ok {
+				if c.AttributeTypes[id].Type != dt.Datatype {
+					report.drop("attribute type %q, it exists as %s instead of %s", dt.Name, c.AttributeTypes[id].Type, dt.Datatype)
+					continue
+				}
+			} else {
+				var err error
+				id, err = c.insertAttributeType(dt.ID, dt.Name, dt.Datatype)
+				if err != nil {
+					return err
+				}
+				report.attributeType(dt.Name)
+			}
+			attributeTypes[dt.ID] = id
+
+			if dt.Key && !c.AttributeTypes[id].Key {
+				if dt.Datatype == DatatypeData {
+					report.drop("key of attribute type %q, data can not be used as a key", dt.Name)
+					continue
+				}
+				err := c.SetAttributeTypeKey(id, true)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// Entities by the value of each unique key
+		indexes := make(map[int64]map[string][]*Entity)
+		for id, attributeType := range c.AttributeTypes {
+			if !matchKeys || !attributeType.Key {
+				continue
+			}
+			index, err := c.entityIndex(id)
+			if err != nil {
+				return err
+			}
+			indexes[id] = index
+		}
+
+		// Document entity ID to the entity it was imported as
+		entities := make(map[uuid.UUID]*Entity)
+
+		for _, de := range doc.Entities {
+			// Entities are matched on the first attribute holding a key
+			var keyType int64
+			key := ""
+			for _, da := range de.Attributes {
+				typeID := attributeTypes[da.Type]
+				if _, ok := indexes[typeID]; ok && da.value() != nil {
+					keyType = typeID
+					key = keyString(da.value())
+					break
+				}
+			}
+
+			if keyType != 0 {
+				matches := indexes[keyType][key]
+				if len(matches) > 1 {
+					report.drop("entity %q, %d entities match key %q", de.Name, len(matches), key)
+					continue
+				} else if len(matches) == 1 {
+					err := c.updateDocumentEntity(matches[0], de, attributeTypes, &report)
+					if err != nil {
+						return err
+					}
+					entities[de.ID] = matches[0]
+					continue
+				}
+			}
+
+			if _, ok := c.Entities[de.ID]; ok {
+				report.drop("entity %q, its ID is already in use", de.Name)
+				continue
+			}
+
+			e := Entity{ID: de.ID, Name: de.Name, X: de.X, Y: de.Y}
+			restored, err := c.insertEntity(&e)
+			if err != nil {
+				return err
+			}
+			report.entity(importAction(restored), "entity %q", de.Name)
+			entities[de.ID] = &e
+
+			if keyType != 0 {
+				indexes[keyType][key] = append(indexes[keyType][key], &e)
+			}
+
+			for _, di := range de.Images {
+				err = e.addDocumentImage(di)
+				if err != nil {
+					report.drop("image of entity %q: %s", de.Name, err)
+				}
+			}
+
+			for _, da := range de.Attributes {
+				typeID, ok := attributeTypes[da.Type]
+				if !ok {
+					report.drop("attribute %d of entity %q with unknown type", da.ID, de.Name)
+					continue
+				}
+
+				var data []byte
+				if da.Data != nil {
+					data = da.Data.content()
+				}
+
+				_, err := e.insertAttribute(da.ID, typeID, da.Number, da.String, data)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Adding the images and attributes changed the modification time
+			err = c.setTimes("entities", e.ID, &e.CreatedAt, &e.UpdatedAt, de.CreatedAt, de.UpdatedAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Connections may also refer to entities that were already in the file
+		entity := func(id uuid.UUID) (*Entity, bool) {
+			if e, ok := entities[id]; ok {
+				return e, true
+			}
+			e, ok := c.Entities[id]
+			return e, ok
+		}
+
+		for _, dc := range doc.Connections {
+			superior, ok := entity(dc.Superior)
+			if !ok {
+				report.drop("connection %q with unknown superior", dc.ID)
+				continue
+			}
+			inferior, ok := entity(dc.Inferior)
+			if !ok {
+				report.drop("connection %q with unknown inferior", dc.ID)
+				continue
+			}
+
+			if c.connected(superior, inferior, dc.Name) {
+				report.connection(ImportUnchanged, "connection %q from %q to %q", dc.Name, superior.Name, inferior.Name)
+				continue
+			}
+			if _, ok := c.Connections[dc.ID]; ok {
+				report.drop("connection %q, its ID is already in use", dc.ID)
+				continue
+			}
+
+			restored, err := superior.connectTo(inferior, dc.Name, dc.ID)
+			if errors.Is(err, ErrConnectToItself) {
+				report.drop("connection %q connecting an entity to itself", dc.ID)
+				continue
+			} else if err != nil {
+				return err
+			}
+			connection := c.Connections[dc.ID]
+			err = c.setTimes("connections", dc.ID, &connection.CreatedAt, &connection.UpdatedAt, dc.CreatedAt, dc.UpdatedAt)
+			if err != nil {
+				return err
+			}
+			report.connection(importAction(restored), "connection %q from %q to %q", dc.Name, superior.Name, inferior.Name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return report, nil
+}
+
+// Give an imported entity or connection the creation and modification times
+// of the document, times the document does not have are left as they are
+func (c *Conatho) setTimes(table string, id uuid.UUID, createdAt, updatedAt *time.Time, docCreatedAt, docUpdatedAt time.Time) error {
+	for _, t := range []struct {
+		column string
+		field  *time.Time
+		value  time.Time
+	}{
+		{"created_at", createdAt, docCreatedAt},
+		{"updated_at", updatedAt, docUpdatedAt},
+	} {
+		if t.value.IsZero() {
+			continue
+		}
+		_, err := c.db().Exec("UPDATE "+table+" SET "+t.column+" = ? WHERE id = ?", t.value.Unix(), id[:])
+		if err != nil {
+			return err
+		}
+		*t.field = unixTime(t.value.Unix())
+	}
+	return nil
+}
+
+// Replace replaces the contents of the file with the document, IDs are kept.
+// The view state, bookmarks and trash are not changed, attribute types still
+// used by trashed entities are kept. Trashed connections to entities that are
+// not in the document are deleted.
+func (c *Conatho) Replace(doc Document) (ImportReport, error) {
+	return c.replace(doc, AuditReplace, "")
+}
+
+// Replace the contents of the file, the items that changed are recorded in the
+// audit trail with the operation instead of as new items. name is recorded
+// with the operation, like the name of a restored snapshot.
+func (c *Conatho) replace(doc Document, op AuditOperation, name string) (ImportReport, error) {
+	var report ImportReport
+	err := c.Transaction(func() error {
+		before, err := c.Document()
+		if err != nil {
+			return err
+		}
+
+		live := "entity IN (SELECT id FROM entities WHERE deleted_at IS NULL)"
+
+		_, err = c.db().Exec("DELETE FROM attributes WHERE " + live)
+		if err != nil {
+			return err
+		}
+
+		err = c.deleteImages(live)
+		if err != nil {
+			return err
+		}
+
+		_, err = c.db().Exec(`
+			DELETE FROM connections WHERE deleted_at IS NULL;
+			DELETE FROM entities WHERE deleted_at IS NULL;
+			DELETE FROM attribute_types WHERE id NOT IN (SELECT type FROM attributes);`)
+		if err != nil {
+			return err
+		}
+
+		c.Entities = make(map[uuid.UUID]*Entity)
+		c.EntitiesKeys = nil
+		c.Connections = make(map[uuid.UUID]*Connection)
+		c.ConnectionsKeys = nil
+		err = c.GetAttributeTypes()
+		if err != nil {
+			return err
+		}
+
+		c.unaudited = true
+		report, err = c.importDocument(doc, false)
+		c.unaudited = false
+		if err != nil {
+			return err
+		}
+
+		after, err := c.Document()
+		if err != nil {
+			return err
+		}
+		err = c.auditReplace(op, name, before, after)
+		if err != nil {
+			return err
+		}
+
+		// Trashed connections are kept with the entities that are still there,
+		// the ones to entities that are gone could never be restored
+		_, err = c.purgeConnections("(superior NOT IN (SELECT id FROM entities) OR inferior NOT IN (SELECT id FROM entities))")
+		return err
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return report, nil
+}
+
+// Update an existing entity with the name, images and attributes of a document
+// entity, its position is kept. The images are replaced when they differ.
+func (c *Conatho) updateDocumentEntity(e *Entity, de DocumentEntity, attributeTypes map[int64]int64, report *ImportReport) error {
+	u, err := e.newAttributeUpdater()
+	if err != nil {
+		return err
+	}
+
+	err = u.rename(de.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(de.Images) > 0 {
+		same, err := e.sameImages(de.Images)
+		if err != nil {
+			return err
+		}
+
+		if !same {
+			err = e.replaceImages(de, report)
+			if err != nil {
+				return err
+			}
+			u.changed = true
+		}
+	}
+
+	for _, da := range de.Attributes {
+		typeID, ok := attributeTypes[da.Type]
+		if !ok {
+			report.drop("attribute %d of entity %q with unknown type", da.ID, de.Name)
+			continue
+		}
+
+		value := da.value()
+		if value == nil {
+			continue
+		}
+
+		err := u.set(typeID, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	report.entity(u.action(), "entity %q", de.Name)
+
+	return nil
+}
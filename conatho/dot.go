@@ -0,0 +1,137 @@
+package conatho
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type DOTOptions struct {
+	// Names of the attribute types to add to the node labels
+	Attributes []string
+	// Directory the thumbnails are written to, thumbnails are left out when
+	// this is empty
+	ThumbnailDir string
+}
+
+// Escape a string so it can be used as a quoted ID in DOT
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// Format an attribute value as readable text
+func (a Attribute) Value() string {
+	switch a.Type {
+	case DatatypeNumber:
+		return strconv.FormatInt(a.Number, 10)
+	case DatatypeString:
+		return a.String
+	case DatatypeData:
+		return fmt.Sprintf("<%d bytes>", len(a.Data))
+	}
+	return ""
+}
+
+// EntityGetThumbnailPNG returns the thumbnail of the entity encoded as PNG
+func (e *Entity) EntityGetThumbnailPNG() ([]byte, error) {
+	img, err := e.thumbnailImage()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Write the thumbnail of the entity to a PNG file
+func (e *Entity) writeThumbnailPNG(fPath string) error {
+	img, err := e.thumbnailImage()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(fPath)
+	if err != nil {
+		return err
+	}
+
+	err = png.Encode(f, img)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ExportDOT writes the graph in the Graphviz DOT format
+func (c *Conatho) ExportDOT(w io.Writer, opts DOTOptions) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph conatho {")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+
+	if opts.ThumbnailDir != "" {
+		err := os.MkdirAll(opts.ThumbnailDir, 0755)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "\timagepath=%s;\n", dotQuote(opts.ThumbnailDir))
+	}
+
+	for _, k := range c.sortedEntitiesKeys() {
+		e := c.Entities[k]
+
+		label := e.Name
+		if len(opts.Attributes) > 0 {
+			attributes, err := e.GetAttributes()
+			if err != nil {
+				return err
+			}
+
+			for _, attribute := range attributes {
+				if slices.Contains(opts.Attributes, attribute.Name) {
+					label += "\n" + attribute.Name + ": " + attribute.Value()
+				}
+			}
+		}
+
+		fmt.Fprintf(bw, "\t%s [label=%s", dotQuote(e.ID.String()), dotQuote(label))
+
+		if opts.ThumbnailDir != "" && e.Image {
+			thumbnailName := e.ID.String() + ".png"
+			err := e.writeThumbnailPNG(filepath.Join(opts.ThumbnailDir, thumbnailName))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(bw, ", image=%s, labelloc=b", dotQuote(thumbnailName))
+		}
+
+		fmt.Fprintln(bw, "];")
+	}
+
+	for _, k := range c.sortedConnectionsKeys() {
+		connection := c.Connections[k]
+		fmt.Fprintf(bw, "\t%s -> %s [label=%s];\n",
+			dotQuote(connection.Superior.String()),
+			dotQuote(connection.Inferior.String()),
+			dotQuote(connection.Name))
+	}
+
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
@@ -0,0 +1,395 @@
+package conatho
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+var ErrUnknownImage = errors.New("unknown image")
+
+// EntityImage is one of the images of an entity, the primary image is shown on
+// the card
+type EntityImage struct {
+	ID       int64
+	Position int
+	Primary  bool
+	Caption  string
+	MIMEType string
+	// Width and Height of the original image, turned upright
+	Width  int
+	Height int
+	Edit   ImageEdit
+}
+
+// GetImages returns the images of the entity in their order
+func (e *Entity) GetImages() ([]EntityImage, error) {
+	id, err := e.ID.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	images := []EntityImage{}
+
+	rows, err := e.c.db().Query(`
+		SELECT id, position, is_primary, caption, mime_type, width, height, `+imageEditColumns+`
+		FROM images JOIN image_blobs USING (hash)
+		WHERE entity = ?
+		ORDER BY position, id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ei EntityImage
+		ei.Edit, err = scanImageEdit(rows.Scan, &ei.ID, &ei.Position, &ei.Primary, &ei.Caption, &ei.MIMEType, &ei.Width, &ei.Height)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, ei)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// AddImage adds an image after the other images of the entity, the first
+// image becomes the primary image
+func (e *Entity) AddImage(imageReader io.Reader, caption string) (int64, error) {
+	si, err := readImage(imageReader)
+	if err != nil {
+		return 0, err
+	}
+
+	return e.insertImage(si, caption, false, ImageEdit{})
+}
+
+// Add an image after the other images, as primary image when primary is set
+// or the entity has no images yet
+func (e *Entity) insertImage(si storedImage, caption string, primary bool, edit ImageEdit) (int64, error) {
+	id, err := e.ID.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	edit = edit.normalize()
+	bounds := si.img.Bounds()
+	err = edit.validate(bounds.Dx(), bounds.Dy())
+	if err != nil {
+		return 0, err
+	}
+
+	thumbnail, err := makeThumbnail(edit.Apply(si.img), e.c.thumbnailSize())
+	if err != nil {
+		return 0, err
+	}
+
+	var imageID int64
+	err = e.c.Transaction(func() error {
+		var position int
+		var count int
+		row := e.c.db().QueryRow("SELECT COALESCE(MAX(position) + 1, 0), COUNT(*) FROM images WHERE entity = ?", id)
+		err := row.Scan(&position, &count)
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			primary = true
+		} else if primary {
+			_, err = e.c.db().Exec("UPDATE images SET is_primary = FALSE WHERE entity = ?", id)
+			if err != nil {
+				return err
+			}
+		}
+
+		hash, err := e.c.acquireImageBlob(si)
+		if err != nil {
+			return err
+		}
+
+		row = e.c.db().QueryRow(`
+			INSERT INTO images (entity, position, is_primary, caption, hash, thumbnail, `+imageEditColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+			append([]any{id, position, primary, caption, hash, thumbnail}, imageEditValues(edit)...)...)
+		err = row.Scan(&imageID)
+		if err != nil {
+			return err
+		}
+
+		_, err = e.c.db().Exec("UPDATE entities SET image = TRUE WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+
+		return e.changed(AuditImage, caption, "", fmt.Sprintf("%d bytes", len(si.data)))
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	e.Image = true
+
+	return imageID, nil
+}
+
+// Store an image from a document as it is, the MIME type is taken from the
+// content
+func (e *Entity) addDocumentImage(di DocumentImage) error {
+	si, err := readImage(bytes.NewReader(di.Data))
+	if err != nil {
+		return err
+	}
+
+	_, err = e.insertImage(si, di.Caption, di.Primary, di.edit())
+	return err
+}
+
+// The caption, position and whether the image is the primary image
+func (e *Entity) imageInfo(imageID int64) (EntityImage, error) {
+	id, err := e.ID.MarshalBinary()
+	if err != nil {
+		return EntityImage{}, err
+	}
+
+	ei := EntityImage{ID: imageID}
+	row := e.c.db().QueryRow("SELECT position, is_primary, caption FROM images WHERE entity = ? AND id = ?", id, imageID)
+	err = row.Scan(&ei.Position, &ei.Primary, &ei.Caption)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ei, ErrUnknownImage
+	}
+	return ei, err
+}
+
+// GetImageData returns the image in its original format
+func (e *Entity) GetImageData(imageID int64) ([]byte, error) {
+	return e.imageColumn("SELECT data FROM images JOIN image_blobs USING (hash) WHERE entity = ? AND id = ?", imageID)
+}
+
+// GetImageThumbnail returns the thumbnail of the image, encoded as QOI
+func (e *Entity) GetImageThumbnail(imageID int64) ([]byte, error) {
+	return e.imageColumn("SELECT thumbnail FROM images WHERE entity = ? AND id = ?", imageID)
+}
+
+func (e *Entity) imageColumn(query string, imageID int64) ([]byte, error) {
+	id, err := e.ID.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	row := e.c.db().QueryRow(query, id, imageID)
+	err = row.Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnknownImage
+	}
+	return data, err
+}
+
+// RemoveImage deletes an image, when it was the primary image the first of
+// the remaining images becomes the primary image
+func (e *Entity) RemoveImage(imageID int64) error {
+	id, err := e.ID.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	ei, err := e.imageInfo(imageID)
+	if err != nil {
+		return err
+	}
+
+	var remaining int
+	err = e.c.Transaction(func() error {
+		var size int64
+		row := e.c.db().QueryRow("SELECT length(data) FROM images JOIN image_blobs USING (hash) WHERE id = ?", imageID)
+		err := row.Scan(&size)
+		if err != nil {
+			return err
+		}
+
+		err = e.c.deleteImages("id = ?", imageID)
+		if err != nil {
+			return err
+		}
+
+		images, err := e.GetImages()
+		if err != nil {
+			return err
+		}
+		remaining = len(images)
+
+		err = e.setImageOrder(images)
+		if err != nil {
+			return err
+		}
+
+		if remaining == 0 {
+			_, err = e.c.db().Exec("UPDATE entities SET image = FALSE WHERE id = ?", id)
+		} else if ei.Primary {
+			_, err = e.c.db().Exec("UPDATE images SET is_primary = TRUE WHERE id = ?", images[0].ID)
+		}
+		if err != nil {
+			return err
+		}
+
+		return e.changed(AuditImage, ei.Caption, fmt.Sprintf("%d bytes", size), "")
+	})
+	if err != nil {
+		return err
+	}
+
+	e.Image = remaining > 0
+
+	return nil
+}
+
+// Number the images in the order given
+func (e *Entity) setImageOrder(images []EntityImage) error {
+	for i, ei := range images {
+		if ei.Position == i {
+			continue
+		}
+		_, err := e.c.db().Exec("UPDATE images SET position = ? WHERE id = ?", i, ei.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveImage moves an image to another position in the order of the images,
+// positions start at 0
+func (e *Entity) MoveImage(imageID int64, position int) error {
+	return e.c.Transaction(func() error {
+		images, err := e.GetImages()
+		if err != nil {
+			return err
+		}
+
+		i := slices.IndexFunc(images, func(ei EntityImage) bool {
+			return ei.ID == imageID
+		})
+		if i < 0 {
+			return ErrUnknownImage
+		}
+		position = min(max(position, 0), len(images)-1)
+		if i == position {
+			return nil
+		}
+
+		ei := images[i]
+		images = slices.Insert(slices.Delete(images, i, i+1), position, ei)
+		err = e.setImageOrder(images)
+		if err != nil {
+			return err
+		}
+
+		return e.changed(AuditImage, ei.Caption, "position "+strconv.Itoa(i+1), "position "+strconv.Itoa(position+1))
+	})
+}
+
+// SetPrimaryImage chooses the image shown on the card
+func (e *Entity) SetPrimaryImage(imageID int64) error {
+	id, err := e.ID.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	ei, err := e.imageInfo(imageID)
+	if err != nil {
+		return err
+	}
+	if ei.Primary {
+		return nil
+	}
+
+	return e.c.Transaction(func() error {
+		_, err := e.c.db().Exec("UPDATE images SET is_primary = (id = ?) WHERE entity = ?", imageID, id)
+		if err != nil {
+			return err
+		}
+
+		return e.changed(AuditImage, ei.Caption, "", "primary")
+	})
+}
+
+func (e *Entity) SetImageCaption(imageID int64, caption string) error {
+	ei, err := e.imageInfo(imageID)
+	if err != nil {
+		return err
+	}
+	if ei.Caption == caption {
+		return nil
+	}
+
+	return e.c.Transaction(func() error {
+		_, err := e.c.db().Exec("UPDATE images SET caption = ? WHERE id = ?", caption, imageID)
+		if err != nil {
+			return err
+		}
+
+		return e.changed(AuditImage, "caption", strconv.Quote(ei.Caption), strconv.Quote(caption))
+	})
+}
+
+// Whether the images are the same as the images of a document entity, in the
+// same order
+func (e *Entity) sameImages(images []DocumentImage) (bool, error) {
+	current, err := e.GetImages()
+	if err != nil {
+		return false, err
+	}
+	if len(current) != len(images) {
+		return false, nil
+	}
+
+	for i, ei := range current {
+		di := images[i]
+		if ei.Caption != di.Caption || ei.Primary != di.Primary || ei.Edit != di.edit() {
+			return false, nil
+		}
+
+		data, err := e.GetImageData(ei.ID)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(data, di.Data) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Replace all images with the images of a document entity
+func (e *Entity) replaceImages(de DocumentEntity, report *ImportReport) error {
+	current, err := e.GetImages()
+	if err != nil {
+		return err
+	}
+
+	for _, ei := range current {
+		err := e.RemoveImage(ei.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, di := range de.Images {
+		err := e.addDocumentImage(di)
+		if err != nil {
+			report.drop("image of entity %q: %s", de.Name, err)
+		}
+	}
+
+	return nil
+}
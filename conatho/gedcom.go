@@ -0,0 +1,802 @@
+package conatho
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Attribute types individuals are mapped to, all of them hold strings. The
+// GEDCOM ID together with the source, the program and file name in the header,
+// is matched so importing a file again updates the entities. Individuals of
+// another file with the same GEDCOM IDs become new entities.
+const (
+	GEDCOMAttributeID         = "GEDCOM ID"
+	GEDCOMAttributeSource     = "GEDCOM source"
+	GEDCOMAttributeSurname    = "Surname"
+	GEDCOMAttributeSex        = "Sex"
+	GEDCOMAttributeBirthDate  = "Birth date"
+	GEDCOMAttributeBirthPlace = "Birth place"
+	GEDCOMAttributeDeathDate  = "Death date"
+	GEDCOMAttributeDeathPlace = "Death place"
+)
+
+// Names of the connections from a parent to a child
+const (
+	GEDCOMFatherOf = "Father of"
+	GEDCOMMotherOf = "Mother of"
+	GEDCOMParentOf = "Parent of"
+)
+
+var gedcomAttributes = []string{
+	GEDCOMAttributeID,
+	GEDCOMAttributeSource,
+	GEDCOMAttributeSurname,
+	GEDCOMAttributeSex,
+	GEDCOMAttributeBirthDate,
+	GEDCOMAttributeBirthPlace,
+	GEDCOMAttributeDeathDate,
+	GEDCOMAttributeDeathPlace,
+}
+
+// Events of an individual with their date and place attributes
+var gedcomEvents = []struct {
+	tag   string
+	date  string
+	place string
+}{
+	{"BIRT", GEDCOMAttributeBirthDate, GEDCOMAttributeBirthPlace},
+	{"DEAT", GEDCOMAttributeDeathDate, GEDCOMAttributeDeathPlace},
+}
+
+// Longer values are split over CONC lines when exporting
+const gedcomMaxValue = 200
+
+type gedcomLine struct {
+	level    int
+	xref     string
+	tag      string
+	value    string
+	children []*gedcomLine
+}
+
+// First child with the tag
+func (l *gedcomLine) child(tag string) *gedcomLine {
+	for _, child := range l.children {
+		if child.tag == tag {
+			return child
+		}
+	}
+	return nil
+}
+
+// Value of the first child with the tag
+func (l *gedcomLine) childValue(tag string) string {
+	if child := l.child(tag); child != nil {
+		return strings.TrimSpace(child.value)
+	}
+	return ""
+}
+
+// Cross reference a value points to
+func gedcomPointer(value string) string {
+	return strings.Trim(strings.TrimSpace(value), "@")
+}
+
+func parseGEDCOMLine(text string) (*gedcomLine, error) {
+	levelText, rest, _ := strings.Cut(text, " ")
+	level, err := strconv.Atoi(levelText)
+	if err != nil || level < 0 {
+		return nil, fmt.Errorf("invalid level %q", levelText)
+	}
+
+	line := gedcomLine{level: level}
+
+	rest = strings.TrimLeft(rest, " ")
+	if strings.HasPrefix(rest, "@") {
+		line.xref, rest, _ = strings.Cut(rest, " ")
+		line.xref = strings.Trim(line.xref, "@")
+		rest = strings.TrimLeft(rest, " ")
+	}
+
+	line.tag, line.value, _ = strings.Cut(rest, " ")
+	if line.tag == "" {
+		return nil, errors.New("no tag")
+	}
+	line.tag = strings.ToUpper(line.tag)
+
+	return &line, nil
+}
+
+// Read the records of a GEDCOM file, CONC and CONT lines are joined with the
+// value they continue
+func readGEDCOM(r io.Reader) ([]*gedcomLine, error) {
+	var records []*gedcomLine
+	var stack []*gedcomLine
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	n := 0
+	for scanner.Scan() {
+		n++
+		// Only the indentation is trimmed, trailing spaces are part of the
+		// value and matter on CONC lines
+		text := scanner.Text()
+		if n == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		text = strings.TrimLeft(text, " \t")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		line, err := parseGEDCOMLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if line.level > len(stack) {
+			return nil, fmt.Errorf("line %d: level %d without a parent", n, line.level)
+		}
+		stack = stack[:line.level]
+
+		if line.level == 0 {
+			records = append(records, line)
+			stack = append(stack, line)
+			continue
+		}
+
+		parent := stack[line.level-1]
+		switch line.tag {
+		case "CONC":
+			parent.value += line.value
+			continue
+		case "CONT":
+			parent.value += "\n" + line.value
+			continue
+		}
+
+		parent.children = append(parent.children, line)
+		stack = append(stack, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 || records[0].tag != "HEAD" {
+		return nil, errors.New("not a GEDCOM file")
+	}
+
+	return records, nil
+}
+
+// Program and file name in the header, files without either are never
+// matched with individuals imported before
+func gedcomSource(head *gedcomLine) string {
+	program := head.childValue("SOUR")
+	file := head.childValue("FILE")
+	if program == "" || file == "" {
+		return ""
+	}
+	return program + " " + file
+}
+
+// Entities imported before from the source by GEDCOM ID
+func (c *Conatho) gedcomIndex(idType int64, sourceType int64, source string) (map[string][]*Entity, error) {
+	index := make(map[string][]*Entity)
+	if source == "" {
+		return index, nil
+	}
+
+	ids, err := c.entityIndex(idType)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := c.entityIndex(sourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	fromSource := make(map[*Entity]bool)
+	for _, e := range sources[source] {
+		fromSource[e] = true
+	}
+	for xref, entities := range ids {
+		for _, e := range entities {
+			if fromSource[e] {
+				index[xref] = append(index[xref], e)
+			}
+		}
+	}
+	return index, nil
+}
+
+type gedcomIndividual struct {
+	xref       string
+	name       string
+	attributes map[string]string
+}
+
+type gedcomFamily struct {
+	xref     string
+	parents  []string
+	children []string
+}
+
+// Split a GEDCOM name into the name shown on the card and the surname, which
+// is enclosed in slashes
+func gedcomName(value string) (string, string) {
+	surname := ""
+	if _, rest, ok := strings.Cut(value, "/"); ok {
+		surname, _, _ = strings.Cut(rest, "/")
+		surname = strings.TrimSpace(surname)
+	}
+
+	name := strings.Join(strings.Fields(strings.ReplaceAll(value, "/", " ")), " ")
+	return name, surname
+}
+
+// Count tags that are not imported, they are listed in the report
+func gedcomSkipped(skipped map[string]int, record string, line *gedcomLine, known ...string) {
+	for _, child := range line.children {
+		if !slices.Contains(known, child.tag) {
+			skipped[record+" "+child.tag]++
+		}
+	}
+}
+
+// ImportGEDCOM adds the individuals of a GEDCOM 5.5 file as entities and the
+// families as connections from the parents to their children. Individuals
+// that have been imported before are matched on their GEDCOM ID and updated.
+// New entities are placed in a row per generation.
+func (c *Conatho) ImportGEDCOM(r io.Reader) (ImportReport, error) {
+	var report ImportReport
+
+	records, err := readGEDCOM(r)
+	if err != nil {
+		return report, err
+	}
+
+	var individuals []*gedcomIndividual
+	var families []*gedcomFamily
+	skipped := make(map[string]int)
+	source := ""
+
+	for _, record := range records {
+		switch record.tag {
+		case "HEAD":
+			char := strings.ToUpper(record.childValue("CHAR"))
+			if char != "" && char != "UTF-8" && char != "ASCII" {
+				report.drop("character set %s, the file is read as UTF-8", char)
+			}
+			source = gedcomSource(record)
+		case "TRLR":
+		case "INDI":
+			individual := gedcomIndividual{
+				xref: record.xref,
+				attributes: map[string]string{
+					GEDCOMAttributeID:     record.xref,
+					GEDCOMAttributeSource: source,
+				},
+			}
+
+			if name := record.child("NAME"); name != nil {
+				individual.name, individual.attributes[GEDCOMAttributeSurname] = gedcomName(name.value)
+			}
+			if individual.name == "" {
+				individual.name = record.xref
+			}
+
+			individual.attributes[GEDCOMAttributeSex] = strings.ToUpper(record.childValue("SEX"))
+			for _, event := range gedcomEvents {
+				if line := record.child(event.tag); line != nil {
+					individual.attributes[event.date] = line.childValue("DATE")
+					individual.attributes[event.place] = line.childValue("PLAC")
+					gedcomSkipped(skipped, record.tag+" "+event.tag, line, "DATE", "PLAC")
+				}
+			}
+
+			gedcomSkipped(skipped, record.tag, record, "NAME", "SEX", "BIRT", "DEAT", "FAMC", "FAMS")
+			individuals = append(individuals, &individual)
+		case "FAM":
+			family := gedcomFamily{xref: record.xref}
+			for _, child := range record.children {
+				switch child.tag {
+				case "HUSB", "WIFE":
+					family.parents = append(family.parents, gedcomPointer(child.value))
+				case "CHIL":
+					family.children = append(family.children, gedcomPointer(child.value))
+				}
+			}
+
+			gedcomSkipped(skipped, record.tag, record, "HUSB", "WIFE", "CHIL")
+			families = append(families, &family)
+		default:
+			skipped[record.tag+" record"]++
+		}
+	}
+
+	for _, k := range sortedKeys(skipped) {
+		report.drop("%d %s", skipped[k], k)
+	}
+
+	err = c.Transaction(func() error {
+		attributeTypes := make(map[string]int64)
+		for _, name := range gedcomAttributes {
+			id, ok := c.AttributeTypeByName(name)
+			if !ok {
+				var err error
+				id, err = c.AddAttributeType(name, DatatypeString)
+				if err != nil {
+					return err
+				}
+				report.attributeType(name)
+			} else if c.AttributeTypes[id].Type != DatatypeString {
+				return fmt.Errorf("attribute type %q exists as %s instead of string", name, c.AttributeTypes[id].Type)
+			}
+			attributeTypes[name] = id
+		}
+
+		index, err := c.gedcomIndex(attributeTypes[GEDCOMAttributeID], attributeTypes[GEDCOMAttributeSource], source)
+		if err != nil {
+			return err
+		}
+
+		// New entities are placed in a row per generation
+		generations := gedcomGenerations(families)
+		originY := c.newImportPlacer().originY
+		placed := make(map[int]int32)
+
+		entities := make(map[string]*Entity)
+		sexes := make(map[string]string)
+		for _, individual := range individuals {
+			if _, ok := entities[individual.xref]; ok {
+				report.drop("individual @%s@, the ID is used more than once", individual.xref)
+				continue
+			}
+			sexes[individual.xref] = individual.attributes[GEDCOMAttributeSex]
+
+			matches := index[individual.xref]
+			if len(matches) > 1 {
+				report.drop("individual @%s@, %d entities from this source have this GEDCOM ID", individual.xref, len(matches))
+				continue
+			} else if len(matches) == 1 {
+				e := matches[0]
+				u, err := e.newAttributeUpdater()
+				if err != nil {
+					return err
+				}
+
+				err = u.rename(individual.name)
+				if err != nil {
+					return err
+				}
+				for _, name := range gedcomAttributes {
+					if value := individual.attributes[name]; value != "" {
+						err := u.set(attributeTypes[name], value)
+						if err != nil {
+							return err
+						}
+					}
+				}
+
+				report.entity(u.action(), "individual @%s@ %q", individual.xref, individual.name)
+				entities[individual.xref] = e
+				continue
+			}
+
+			generation := generations[individual.xref]
+			e := Entity{
+				Name: individual.name,
+				X:    placed[generation] * importSpacingX,
+				Y:    originY + int32(generation)*importSpacingY,
+			}
+			placed[generation]++
+
+			e.ID = uuid.New()
+			_, err = c.insertEntity(&e)
+			if err != nil {
+				return err
+			}
+			report.entity(ImportCreated, "individual @%s@ %q", individual.xref, individual.name)
+
+			for _, name := range gedcomAttributes {
+				if value := individual.attributes[name]; value != "" {
+					_, err := e.addAttributeValue(attributeTypes[name], value)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			entities[individual.xref] = &e
+		}
+
+		for _, family := range families {
+			if len(family.children) == 0 {
+				report.drop("family @%s@ without children, only parent and child relationships are imported", family.xref)
+				continue
+			}
+
+			for _, parentXref := range family.parents {
+				parent, ok := entities[parentXref]
+				if !ok {
+					report.drop("parent @%s@ of family @%s@, the individual does not exist", parentXref, family.xref)
+					continue
+				}
+
+				name := GEDCOMParentOf
+				switch sexes[parentXref] {
+				case "M":
+					name = GEDCOMFatherOf
+				case "F":
+					name = GEDCOMMotherOf
+				}
+
+				for _, childXref := range family.children {
+					child, ok := entities[childXref]
+					if !ok {
+						report.drop("child @%s@ of family @%s@, the individual does not exist", childXref, family.xref)
+						continue
+					}
+
+					if c.connected(parent, child, name) {
+						report.connection(ImportUnchanged, "@%s@ %s @%s@", parentXref, name, childXref)
+						continue
+					}
+
+					err := parent.ConnectTo(child, name)
+					if errors.Is(err, ErrConnectToItself) {
+						report.drop("family @%s@ with @%s@ as their own child", family.xref, childXref)
+						continue
+					} else if err != nil {
+						return err
+					}
+					report.connection(ImportCreated, "@%s@ %s @%s@", parentXref, name, childXref)
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return report, nil
+}
+
+// Generation of every child, one more than its youngest parent. Individuals
+// without parents are generation 0.
+func gedcomGenerations(families []*gedcomFamily) map[string]int {
+	parents := make(map[string][]string)
+	for _, family := range families {
+		for _, child := range family.children {
+			parents[child] = append(parents[child], family.parents...)
+		}
+	}
+
+	generations := make(map[string]int)
+	visiting := make(map[string]bool)
+
+	var generation func(xref string) int
+	generation = func(xref string) int {
+		if g, ok := generations[xref]; ok {
+			return g
+		}
+		// Broken files may have an individual as their own ancestor
+		if visiting[xref] {
+			return 0
+		}
+		visiting[xref] = true
+
+		g := 0
+		for _, parent := range parents[xref] {
+			g = max(g, generation(parent)+1)
+		}
+
+		delete(visiting, xref)
+		generations[xref] = g
+		return g
+	}
+
+	for xref := range parents {
+		generation(xref)
+	}
+
+	return generations
+}
+
+type gedcomWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (gw *gedcomWriter) write(level int, xref string, tag string, value string) {
+	if gw.err != nil {
+		return
+	}
+
+	text := strconv.Itoa(level)
+	if xref != "" {
+		text += " @" + xref + "@"
+	}
+	text += " " + tag
+	if value != "" {
+		text += " " + value
+	}
+	_, gw.err = gw.w.WriteString(text + "\r\n")
+}
+
+// Split off the part of a value that fits on a line, not inside a character
+// or next to a space which readers would trim
+func gedcomSplit(value string) (string, string) {
+	if len(value) <= gedcomMaxValue {
+		return value, ""
+	}
+
+	end := gedcomMaxValue
+	for end > 1 && (!utf8.RuneStart(value[end]) || value[end] == ' ' || value[end-1] == ' ') {
+		end--
+	}
+	if end == 1 {
+		// Nothing but spaces, split at the last whole character
+		end = gedcomMaxValue
+		for end > 1 && !utf8.RuneStart(value[end]) {
+			end--
+		}
+	}
+	return value[:end], value[end:]
+}
+
+// Write a line, new lines in the value continue on CONT lines and long values
+// on CONC lines
+func (gw *gedcomWriter) line(level int, xref string, tag string, value string) {
+	for i, part := range strings.Split(value, "\n") {
+		chunk, rest := gedcomSplit(part)
+		if i == 0 {
+			gw.write(level, xref, tag, chunk)
+		} else {
+			gw.write(level+1, "", "CONT", chunk)
+		}
+
+		for rest != "" {
+			chunk, rest = gedcomSplit(rest)
+			gw.write(level+1, "", "CONC", chunk)
+		}
+	}
+}
+
+// A GEDCOM ID can be used as cross reference when it has no spaces or @ signs
+func gedcomValidXref(xref string) bool {
+	return xref != "" && !strings.ContainsAny(xref, "@ \t\r\n") && len(xref) <= 20
+}
+
+// Surname enclosed in slashes, when the name contains it
+func gedcomNameValue(name string, surname string) string {
+	i := strings.LastIndex(name, surname)
+	if surname == "" || i < 0 {
+		return name
+	}
+	return strings.TrimSpace(name[:i] + "/" + surname + "/" + name[i+len(surname):])
+}
+
+// ExportGEDCOM writes every entity as an individual. Connections named
+// "Father of", "Mother of" or "Parent of" become families, other connections
+// and attributes are not exported.
+func (c *Conatho) ExportGEDCOM(w io.Writer) error {
+	keys := c.sortedEntitiesKeys()
+
+	// Values of the GEDCOM attributes of every entity
+	values := make(map[*Entity]map[string]string)
+	for _, k := range keys {
+		e := c.Entities[k]
+		attributes, err := e.GetAttributes()
+		if err != nil {
+			return err
+		}
+
+		values[e] = make(map[string]string)
+		for _, a := range attributes {
+			if a.Type != DatatypeString || a.Null || !slices.Contains(gedcomAttributes, a.Name) {
+				continue
+			}
+			if _, ok := values[e][a.Name]; !ok {
+				values[e][a.Name] = a.String
+			}
+		}
+	}
+
+	// Keep GEDCOM IDs of imported individuals, number the others
+	xrefs := make(map[*Entity]string)
+	used := make(map[string]bool)
+	for _, k := range keys {
+		e := c.Entities[k]
+		xref := values[e][GEDCOMAttributeID]
+		if gedcomValidXref(xref) && !used[xref] {
+			xrefs[e] = xref
+			used[xref] = true
+		}
+	}
+	next := func(prefix string) string {
+		for i := 1; ; i++ {
+			xref := prefix + strconv.Itoa(i)
+			if !used[xref] {
+				used[xref] = true
+				return xref
+			}
+		}
+	}
+	for _, k := range keys {
+		e := c.Entities[k]
+		if _, ok := xrefs[e]; !ok {
+			xrefs[e] = next("I")
+		}
+	}
+
+	// Children with the same parents form a family. GEDCOM families have at
+	// most two parents, children with more get a family per parent.
+	type family struct {
+		xref     string
+		husband  *Entity
+		wife     *Entity
+		children []*Entity
+	}
+	var families []*family
+	familiesByParents := make(map[string]*family)
+	childOf := make(map[*Entity][]*family)
+	spouseOf := make(map[*Entity][]*family)
+
+	for _, k := range keys {
+		child := c.Entities[k]
+
+		type parent struct {
+			e    *Entity
+			role string
+		}
+		var parents []parent
+		for _, id := range child.Connections {
+			connection, ok := c.Connections[id]
+			if !ok || connection.Inferior != child.ID {
+				continue
+			}
+			if connection.Name != GEDCOMFatherOf && connection.Name != GEDCOMMotherOf && connection.Name != GEDCOMParentOf {
+				continue
+			}
+			superior, ok := c.Entities[connection.Superior]
+			if !ok {
+				continue
+			}
+
+			role := connection.Name
+			if role == GEDCOMParentOf {
+				switch values[superior][GEDCOMAttributeSex] {
+				case "M":
+					role = GEDCOMFatherOf
+				case "F":
+					role = GEDCOMMotherOf
+				}
+			}
+			parents = append(parents, parent{superior, role})
+		}
+		if len(parents) == 0 {
+			continue
+		}
+		slices.SortFunc(parents, func(a, b parent) int {
+			return strings.Compare(xrefs[a.e], xrefs[b.e])
+		})
+
+		groups := [][]parent{parents}
+		if len(parents) > 2 {
+			groups = nil
+			for _, p := range parents {
+				groups = append(groups, []parent{p})
+			}
+		}
+
+		for _, group := range groups {
+			var key strings.Builder
+			for _, p := range group {
+				key.WriteString(xrefs[p.e] + "\n")
+			}
+
+			f, ok := familiesByParents[key.String()]
+			if !ok {
+				f = &family{xref: next("F")}
+
+				// The father is the husband and the mother the wife
+				for _, p := range group {
+					if p.role == GEDCOMFatherOf && f.husband == nil {
+						f.husband = p.e
+					} else if p.role == GEDCOMMotherOf && f.wife == nil {
+						f.wife = p.e
+					}
+				}
+				// Parents without a role, or with the same role as the other
+				// parent, take the free slot
+				for _, p := range group {
+					if p.e == f.husband || p.e == f.wife {
+						continue
+					}
+					if f.husband == nil {
+						f.husband = p.e
+					} else {
+						f.wife = p.e
+					}
+				}
+				for _, p := range group {
+					spouseOf[p.e] = append(spouseOf[p.e], f)
+				}
+
+				familiesByParents[key.String()] = f
+				families = append(families, f)
+			}
+
+			f.children = append(f.children, child)
+			childOf[child] = append(childOf[child], f)
+		}
+	}
+
+	gw := gedcomWriter{w: bufio.NewWriter(w)}
+
+	gw.line(0, "", "HEAD", "")
+	gw.line(1, "", "SOUR", "CONNECT-A-THON")
+	gw.line(1, "", "GEDC", "")
+	gw.line(2, "", "VERS", "5.5")
+	gw.line(2, "", "FORM", "LINEAGE-LINKED")
+	gw.line(1, "", "CHAR", "UTF-8")
+
+	for _, k := range keys {
+		e := c.Entities[k]
+		gw.line(0, xrefs[e], "INDI", "")
+		gw.line(1, "", "NAME", gedcomNameValue(e.Name, values[e][GEDCOMAttributeSurname]))
+		if sex := values[e][GEDCOMAttributeSex]; sex != "" {
+			gw.line(1, "", "SEX", sex)
+		}
+		for _, event := range gedcomEvents {
+			date, place := values[e][event.date], values[e][event.place]
+			if date == "" && place == "" {
+				continue
+			}
+			gw.line(1, "", event.tag, "")
+			if date != "" {
+				gw.line(2, "", "DATE", date)
+			}
+			if place != "" {
+				gw.line(2, "", "PLAC", place)
+			}
+		}
+		for _, f := range childOf[e] {
+			gw.line(1, "", "FAMC", "@"+f.xref+"@")
+		}
+		for _, f := range spouseOf[e] {
+			gw.line(1, "", "FAMS", "@"+f.xref+"@")
+		}
+	}
+
+	for _, f := range families {
+		gw.line(0, f.xref, "FAM", "")
+		if f.husband != nil {
+			gw.line(1, "", "HUSB", "@"+xrefs[f.husband]+"@")
+		}
+		if f.wife != nil {
+			gw.line(1, "", "WIFE", "@"+xrefs[f.wife]+"@")
+		}
+		for _, child := range f.children {
+			gw.line(1, "", "CHIL", "@"+xrefs[child]+"@")
+		}
+	}
+
+	gw.line(0, "", "TRLR", "")
+
+	if gw.err != nil {
+		return gw.err
+	}
+	return gw.w.Flush()
+}
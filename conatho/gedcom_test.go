@@ -0,0 +1,197 @@
+package conatho
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const testGEDCOM = "\ufeff0 HEAD\r\n" +
+	"1 CHAR UTF-8\r\n" +
+	"0 @I1@ INDI\r\n" +
+	"1 NAME John /Smith/\r\n" +
+	"1 SEX M\r\n" +
+	"1 BIRT\r\n" +
+	"2 DATE 1 JAN 1900\r\n" +
+	"2 PLAC Saint-\r\n" +
+	"3 CONC Rémy-de-Provence, \r\n" +
+	"3 CONC France\r\n" +
+	"0 @I2@ INDI\r\n" +
+	"1 NAME Mary /Jones/\r\n" +
+	"1 SEX F\r\n" +
+	"1 DEAT\r\n" +
+	"2 PLAC First line\r\n" +
+	"3 CONT second line\r\n" +
+	"0 @I3@ INDI\r\n" +
+	"1 NAME Anne /Smith/\r\n" +
+	"1 NOTE Not imported\r\n" +
+	"0 @F1@ FAM\r\n" +
+	"1 HUSB @I1@\r\n" +
+	"1 WIFE @I2@\r\n" +
+	"1 CHIL @I3@\r\n" +
+	"0 TRLR\r\n"
+
+func TestImportGEDCOM(t *testing.T) {
+	c := testConatho(t)
+
+	report, err := c.ImportGEDCOM(strings.NewReader(testGEDCOM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entities != 3 || report.Connections != 2 {
+		t.Errorf("imported %d entities and %d connections, want 3 and 2", report.Entities, report.Connections)
+	}
+	if !slices.Equal(report.Dropped, []string{"1 INDI NOTE"}) {
+		t.Errorf("dropped %q", report.Dropped)
+	}
+
+	john := attributeValues(t, entityByName(t, c, "John Smith"))
+	if john[GEDCOMAttributeSurname] != "Smith" || john[GEDCOMAttributeBirthDate] != "1 JAN 1900" ||
+		john[GEDCOMAttributeBirthPlace] != "Saint-Rémy-de-Provence, France" {
+		t.Errorf("attributes of John: %q", john)
+	}
+	mary := attributeValues(t, entityByName(t, c, "Mary Jones"))
+	if mary[GEDCOMAttributeDeathPlace] != "First line\nsecond line" {
+		t.Errorf("death place of Mary: %q", mary[GEDCOMAttributeDeathPlace])
+	}
+
+	anne := entityByName(t, c, "Anne Smith")
+	var names []string
+	for _, connection := range c.Connections {
+		if connection.Inferior == anne.ID {
+			names = append(names, c.Entities[connection.Superior].Name+" "+connection.Name)
+		}
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, []string{"John Smith " + GEDCOMFatherOf, "Mary Jones " + GEDCOMMotherOf}) {
+		t.Errorf("parents of Anne: %q", names)
+	}
+}
+
+func TestGEDCOMRoundTrip(t *testing.T) {
+	c := testConatho(t)
+
+	surname, _ := c.AddAttributeType(GEDCOMAttributeSurname, DatatypeString)
+	place, _ := c.AddAttributeType(GEDCOMAttributeBirthPlace, DatatypeString)
+
+	// Long values are split on CONC lines, not inside a character or next to
+	// a space, new lines become CONT lines
+	long := strings.Repeat("Ünïcödé ", 60) + "\n" + strings.Repeat("é", 300) + "\n\n" + strings.Repeat(" ", 250) + "end"
+
+	created, err := c.CreateEntity(0, 0, "Jane Doe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := c.Entities[created.ID]
+	for typeID, value := range map[int64]string{surname: "Doe", place: long} {
+		_, err := e.addAttributeValue(typeID, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	err = c.ExportGEDCOM(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := buf.String()
+
+	tags := make(map[string]int)
+	scanner := bufio.NewScanner(strings.NewReader(exported))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !utf8.ValidString(line) {
+			t.Errorf("line split inside a character: %q", line)
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) == 3 && len(fields[2]) > gedcomMaxValue {
+			t.Errorf("value of %d bytes: %q", len(fields[2]), line)
+		}
+		if len(fields) > 1 {
+			tags[fields[1]]++
+		}
+	}
+	if tags["CONC"] == 0 || tags["CONT"] != 3 {
+		t.Errorf("%d CONC and %d CONT lines, want some and 3", tags["CONC"], tags["CONT"])
+	}
+	if !strings.Contains(exported, "1 NAME Jane /Doe/\r\n") {
+		t.Errorf("no name with surname in:\n%s", exported)
+	}
+
+	imported := testConatho(t)
+	report, err := imported.ImportGEDCOM(strings.NewReader(exported))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Dropped) > 0 {
+		t.Errorf("dropped %q", report.Dropped)
+	}
+
+	values := attributeValues(t, entityByName(t, imported, "Jane Doe"))
+	if values[GEDCOMAttributeSurname] != "Doe" {
+		t.Errorf("surname %q", values[GEDCOMAttributeSurname])
+	}
+	if values[GEDCOMAttributeBirthPlace] != long {
+		t.Errorf("birth place changed:\n%q\n%q", values[GEDCOMAttributeBirthPlace], long)
+	}
+}
+
+func testGEDCOMFile(file string, names ...string) string {
+	var sb strings.Builder
+	sb.WriteString("0 HEAD\n1 SOUR GRAMPS\n")
+	if file != "" {
+		sb.WriteString("1 FILE " + file + "\n")
+	}
+	for i, name := range names {
+		fmt.Fprintf(&sb, "0 @I%d@ INDI\n1 NAME %s\n", i+1, name)
+	}
+	sb.WriteString("0 TRLR\n")
+	return sb.String()
+}
+
+func TestImportGEDCOMSources(t *testing.T) {
+	c := testConatho(t)
+
+	for _, test := range []struct {
+		file                        string
+		names                       []string
+		created, updated, unchanged int
+	}{
+		{"smith.ged", []string{"John /Smith/", "Mary /Smith/"}, 2, 0, 0},
+		// Another tree using the same IDs
+		{"jones.ged", []string{"Tom /Jones/", "Ann /Jones/"}, 2, 0, 0},
+		// The first tree again with a changed name
+		{"smith.ged", []string{"John /Smith/", "Mary /Brown/"}, 0, 1, 1},
+		// Without a file name individuals are not matched
+		{"", []string{"Tom /Jones/"}, 1, 0, 0},
+	} {
+		report, err := c.ImportGEDCOM(strings.NewReader(testGEDCOMFile(test.file, test.names...)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Entities != test.created || report.Updated != test.updated || report.Unchanged != test.unchanged {
+			t.Errorf("%q: created %d, updated %d and kept %d entities, want %d, %d and %d", test.file,
+				report.Entities, report.Updated, report.Unchanged, test.created, test.updated, test.unchanged)
+		}
+	}
+
+	var names []string
+	for _, e := range c.Entities {
+		names = append(names, e.Name)
+	}
+	slices.Sort(names)
+	want := []string{"Ann Jones", "John Smith", "Mary Brown", "Tom Jones", "Tom Jones"}
+	if !slices.Equal(names, want) {
+		t.Errorf("entities %q, want %q", names, want)
+	}
+
+	id, _ := c.AttributeTypeByName(GEDCOMAttributeID)
+	if c.AttributeTypes[id].Key {
+		t.Errorf("%q is made a unique key", GEDCOMAttributeID)
+	}
+}
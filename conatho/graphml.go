@@ -0,0 +1,578 @@
+package conatho
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+// Keys used for the entity and connection fields, attribute types use "a<id>"
+const (
+	graphMLKeyName      = "name"
+	graphMLKeyX         = "x"
+	graphMLKeyY         = "y"
+	graphMLKeyEdgeLabel = "label"
+)
+
+// Description of keys holding base64 encoded data attributes
+const graphMLDescBase64 = "base64"
+
+type graphML struct {
+	XMLName xml.Name       `xml:"graphml"`
+	XMLNS   string         `xml:"xmlns,attr,omitempty"`
+	Keys    []graphMLKey   `xml:"key"`
+	Graphs  []graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID         string  `xml:"id,attr"`
+	For        string  `xml:"for,attr,omitempty"`
+	Name       string  `xml:"attr.name,attr,omitempty"`
+	Type       string  `xml:"attr.type,attr,omitempty"`
+	YFilesType string  `xml:"yfiles.type,attr,omitempty"`
+	Desc       string  `xml:"desc,omitempty"`
+	Default    *string `xml:"default"`
+}
+
+type graphMLGraph struct {
+	ID          string           `xml:"id,attr,omitempty"`
+	EdgeDefault string           `xml:"edgedefault,attr"`
+	Data        []graphMLData    `xml:"data"`
+	Nodes       []graphMLNode    `xml:"node"`
+	Edges       []graphMLEdge    `xml:"edge"`
+	Hyperedges  []graphMLElement `xml:"hyperedge"`
+}
+
+type graphMLNode struct {
+	ID     string           `xml:"id,attr"`
+	Data   []graphMLData    `xml:"data"`
+	Ports  []graphMLElement `xml:"port"`
+	Graphs []graphMLGraph   `xml:"graph"`
+}
+
+type graphMLEdge struct {
+	ID       string        `xml:"id,attr,omitempty"`
+	Source   string        `xml:"source,attr"`
+	Target   string        `xml:"target,attr"`
+	Directed string        `xml:"directed,attr,omitempty"`
+	Data     []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",innerxml"`
+}
+
+// Elements that are not supported, only counted
+type graphMLElement struct{}
+
+// Name of the key for reports
+func (k graphMLKey) label() string {
+	if k.Name != "" {
+		return k.Name
+	}
+	return k.ID
+}
+
+// Type used by GraphML for a datatype
+func graphMLType(datatype Datatype) string {
+	if datatype == DatatypeNumber {
+		return "long"
+	}
+	return "string"
+}
+
+func graphMLEscape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+// ExportGraphML writes the graph as GraphML. Attribute types become typed
+// keys, data attributes are base64 encoded. GraphML allows a single value per
+// key, so only the first attribute of each type is exported for an entity.
+// Images are not exported.
+func (c *Conatho) ExportGraphML(w io.Writer) error {
+	doc := graphML{
+		XMLNS: graphMLNamespace,
+		Keys: []graphMLKey{
+			{ID: graphMLKeyName, For: "node", Name: "label", Type: "string"},
+			{ID: graphMLKeyX, For: "node", Name: "x", Type: "double"},
+			{ID: graphMLKeyY, For: "node", Name: "y", Type: "double"},
+		},
+	}
+
+	for _, id := range sortedKeys(c.AttributeTypes) {
+		attributeType := c.AttributeTypes[id]
+		key := graphMLKey{
+			ID:   "a" + strconv.FormatInt(id, 10),
+			For:  "node",
+			Name: attributeType.Name,
+			Type: graphMLType(attributeType.Type),
+		}
+		if attributeType.Type == DatatypeData {
+			key.Desc = graphMLDescBase64
+		}
+		doc.Keys = append(doc.Keys, key)
+	}
+	doc.Keys = append(doc.Keys, graphMLKey{ID: graphMLKeyEdgeLabel, For: "edge", Name: "label", Type: "string"})
+
+	graph := graphMLGraph{ID: "G", EdgeDefault: "directed"}
+
+	for _, k := range c.sortedEntitiesKeys() {
+		e := c.Entities[k]
+		node := graphMLNode{
+			ID: e.ID.String(),
+			Data: []graphMLData{
+				{Key: graphMLKeyName, Value: graphMLEscape(e.Name)},
+				{Key: graphMLKeyX, Value: strconv.FormatInt(int64(e.X), 10)},
+				{Key: graphMLKeyY, Value: strconv.FormatInt(int64(e.Y), 10)},
+			},
+		}
+
+		attributes, err := e.GetAttributes()
+		if err != nil {
+			return err
+		}
+
+		exported := make(map[int64]bool)
+		for _, attribute := range attributes {
+			if exported[attribute.TypeID] || attribute.Null {
+				continue
+			}
+			exported[attribute.TypeID] = true
+
+			var value string
+			switch attribute.Type {
+			case DatatypeNumber:
+				value = strconv.FormatInt(attribute.Number, 10)
+			case DatatypeString:
+				value = attribute.String
+			case DatatypeData:
+				value = base64.StdEncoding.EncodeToString(attribute.Data)
+			}
+
+			node.Data = append(node.Data, graphMLData{
+				Key:   "a" + strconv.FormatInt(attribute.TypeID, 10),
+				Value: graphMLEscape(value),
+			})
+		}
+
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	for _, k := range c.sortedConnectionsKeys() {
+		connection := c.Connections[k]
+		edge := graphMLEdge{
+			ID:     connection.ID.String(),
+			Source: connection.Superior.String(),
+			Target: connection.Inferior.String(),
+		}
+		if connection.Name != "" {
+			edge.Data = []graphMLData{{Key: graphMLKeyEdgeLabel, Value: graphMLEscape(connection.Name)}}
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+
+	doc.Graphs = []graphMLGraph{graph}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(bw)
+	encoder.Indent("", "  ")
+	err := encoder.Encode(doc)
+	if err != nil {
+		return err
+	}
+	bw.WriteString("\n")
+
+	return bw.Flush()
+}
+
+// What a GraphML key is imported as
+type graphMLRole int
+
+const (
+	graphMLRoleDrop graphMLRole = iota
+	graphMLRoleName
+	graphMLRoleX
+	graphMLRoleY
+	graphMLRoleAttribute
+	graphMLRoleNodeGraphics
+	graphMLRoleEdgeLabel
+	graphMLRoleEdgeGraphics
+)
+
+type graphMLImportKey struct {
+	key             graphMLKey
+	role            graphMLRole
+	attributeTypeID int64
+	base64          bool
+}
+
+// Text of the data element, with XML entities resolved
+func (d graphMLData) text() string {
+	var sb strings.Builder
+	decoder := xml.NewDecoder(strings.NewReader(d.Value))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		if charData, ok := token.(xml.CharData); ok {
+			sb.Write(charData)
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// Label and position stored by yEd in its graphics elements
+func (d graphMLData) yFilesGraphics() (label string, x, y float64, hasPosition bool) {
+	decoder := xml.NewDecoder(strings.NewReader(d.Value))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "Geometry":
+			if hasPosition {
+				continue
+			}
+			for _, attr := range start.Attr {
+				switch attr.Name.Local {
+				case "x":
+					x, _ = strconv.ParseFloat(attr.Value, 64)
+					hasPosition = true
+				case "y":
+					y, _ = strconv.ParseFloat(attr.Value, 64)
+				}
+			}
+		case "NodeLabel", "EdgeLabel":
+			if label != "" {
+				continue
+			}
+			var text string
+			if decoder.DecodeElement(&text, &start) == nil {
+				label = strings.TrimSpace(text)
+			}
+		}
+	}
+	return label, x, y, hasPosition
+}
+
+// Prepare the keys of the file, creating attribute types for unknown keys
+func (c *Conatho) graphMLImportKeys(keys []graphMLKey, report *ImportReport) (map[string]*graphMLImportKey, map[string]*graphMLImportKey, error) {
+	nodeKeys := make(map[string]*graphMLImportKey)
+	edgeKeys := make(map[string]*graphMLImportKey)
+
+	// Prefer a key named label for the name, fall back to name
+	nameKey := ""
+	for _, key := range keys {
+		if key.For != "node" && key.For != "all" && key.For != "" {
+			continue
+		}
+		name := strings.ToLower(key.Name)
+		if name == "label" || (name == "name" && nameKey == "") {
+			nameKey = key.ID
+		}
+	}
+
+	for _, key := range keys {
+		if key.For == "" {
+			key.For = "all"
+		}
+		forNode := key.For == "node" || key.For == "all"
+		forEdge := key.For == "edge" || key.For == "all"
+
+		if !forNode && !forEdge {
+			report.drop("%s key %q", key.For, key.label())
+			continue
+		}
+
+		if forNode {
+			k := &graphMLImportKey{key: key}
+			switch {
+			case key.YFilesType == "nodegraphics":
+				k.role = graphMLRoleNodeGraphics
+			case key.ID == nameKey:
+				k.role = graphMLRoleName
+			case strings.ToLower(key.Name) == "x":
+				k.role = graphMLRoleX
+			case strings.ToLower(key.Name) == "y":
+				k.role = graphMLRoleY
+			case key.YFilesType != "" || key.Name == "":
+				report.drop("node key %q", key.ID)
+			default:
+				datatype := DatatypeString
+				switch key.Type {
+				case "int", "long":
+					datatype = DatatypeNumber
+				case "string":
+					if key.Desc == graphMLDescBase64 {
+						datatype = DatatypeData
+					}
+				}
+
+				id, ok := c.AttributeTypeByName(key.Name)
+				if !ok {
+					var err error
+					id, err = c.AddAttributeType(key.Name, datatype)
+					if err != nil {
+						return nil, nil, err
+					}
+					report.attributeType(key.Name)
+				}
+
+				k.role = graphMLRoleAttribute
+				k.attributeTypeID = id
+				k.base64 = key.Desc == graphMLDescBase64
+			}
+			nodeKeys[key.ID] = k
+		}
+
+		if forEdge {
+			k := &graphMLImportKey{key: key}
+			switch {
+			case key.YFilesType == "edgegraphics":
+				k.role = graphMLRoleEdgeGraphics
+			case strings.ToLower(key.Name) == "label" || strings.ToLower(key.Name) == "name":
+				k.role = graphMLRoleEdgeLabel
+			default:
+				if key.For == "edge" {
+					report.drop("edge key %q", key.label())
+				}
+			}
+			edgeKeys[key.ID] = k
+		}
+	}
+
+	return nodeKeys, edgeKeys, nil
+}
+
+// Convert the value of a data element to the datatype of the attribute type
+func (c *Conatho) graphMLValue(k *graphMLImportKey, value string) (any, error) {
+	switch c.AttributeTypes[k.attributeTypeID].Type {
+	case DatatypeNumber:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f != math.Trunc(f) {
+			return nil, errors.New("not a whole number")
+		}
+		return int64(f), nil
+	case DatatypeData:
+		if k.base64 {
+			return base64.StdEncoding.DecodeString(value)
+		}
+		return []byte(value), nil
+	}
+	return value, nil
+}
+
+// ImportGraphML adds the nodes and edges of a GraphML file to the file.
+// Node IDs that are UUIDs not yet in use are kept. Everything that could not
+// be imported is listed in the report.
+func (c *Conatho) ImportGraphML(r io.Reader) (ImportReport, error) {
+	var report ImportReport
+
+	var doc graphML
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return report, err
+	}
+	if len(doc.Graphs) == 0 {
+		return report, errors.New("no graph found")
+	}
+
+	err = c.Transaction(func() error {
+		nodeKeys, edgeKeys, err := c.graphMLImportKeys(doc.Keys, &report)
+		if err != nil {
+			return err
+		}
+
+		entities := make(map[string]*Entity)
+		placer := c.newImportPlacer()
+
+		for _, graph := range doc.Graphs {
+			if len(graph.Data) > 0 {
+				report.drop("%d data values of graph %q", len(graph.Data), graph.ID)
+			}
+			if len(graph.Hyperedges) > 0 {
+				report.drop("%d hyperedges of graph %q", len(graph.Hyperedges), graph.ID)
+			}
+
+			for _, node := range graph.Nodes {
+				if _, ok := entities[node.ID]; ok {
+					report.drop("duplicate node %q", node.ID)
+					continue
+				}
+				if len(node.Graphs) > 0 {
+					report.drop("nested graph of node %q", node.ID)
+				}
+				if len(node.Ports) > 0 {
+					report.drop("%d ports of node %q", len(node.Ports), node.ID)
+				}
+
+				e := Entity{ID: uuid.New(), Name: node.ID}
+				if id, err := uuid.Parse(node.ID); err == nil {
+					if _, ok := c.Entities[id]; !ok {
+						e.ID = id
+					}
+				}
+				e.X, e.Y = placer.next()
+
+				data := make(map[string]string)
+				for _, d := range node.Data {
+					data[d.Key] = d.Value
+				}
+
+				var attributes []graphMLData
+				for _, key := range doc.Keys {
+					k, ok := nodeKeys[key.ID]
+					if !ok {
+						continue
+					}
+
+					value, ok := data[key.ID]
+					if !ok {
+						if key.Default == nil {
+							continue
+						}
+						value = graphMLEscape(*key.Default)
+					}
+					d := graphMLData{Key: key.ID, Value: value}
+
+					switch k.role {
+					case graphMLRoleName:
+						e.Name = d.text()
+					case graphMLRoleX:
+						if x, err := strconv.ParseFloat(d.text(), 64); err == nil {
+							e.X = int32(math.Round(x))
+						}
+					case graphMLRoleY:
+						if y, err := strconv.ParseFloat(d.text(), 64); err == nil {
+							e.Y = int32(math.Round(y))
+						}
+					case graphMLRoleNodeGraphics:
+						label, x, y, ok := d.yFilesGraphics()
+						if label != "" {
+							e.Name = label
+						}
+						if ok {
+							e.X = int32(math.Round(x))
+							e.Y = int32(math.Round(y))
+						}
+					case graphMLRoleAttribute:
+						attributes = append(attributes, d)
+					}
+				}
+				for _, d := range node.Data {
+					if _, ok := nodeKeys[d.Key]; !ok {
+						report.drop("value for unknown key %q of node %q", d.Key, node.ID)
+					}
+				}
+
+				restored, err := c.insertEntity(&e)
+				if err != nil {
+					return err
+				}
+				entities[node.ID] = &e
+				report.entity(importAction(restored), "node %q", node.ID)
+
+				for _, d := range attributes {
+					k := nodeKeys[d.Key]
+					value, err := c.graphMLValue(k, d.text())
+					if err != nil {
+						report.drop("value %q of %q for node %q: %s", d.text(), k.key.Name, node.ID, err)
+						continue
+					}
+
+					_, err = e.addAttributeValue(k.attributeTypeID, value)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			undirected := 0
+			for _, edge := range graph.Edges {
+				superior, ok := entities[edge.Source]
+				if !ok {
+					report.drop("edge %q with unknown source %q", edge.ID, edge.Source)
+					continue
+				}
+				inferior, ok := entities[edge.Target]
+				if !ok {
+					report.drop("edge %q with unknown target %q", edge.ID, edge.Target)
+					continue
+				}
+
+				name := ""
+				for _, d := range edge.Data {
+					k, ok := edgeKeys[d.Key]
+					if !ok {
+						report.drop("value for unknown key %q of edge %q", d.Key, edge.ID)
+						continue
+					}
+					switch k.role {
+					case graphMLRoleEdgeLabel:
+						name = d.text()
+					case graphMLRoleEdgeGraphics:
+						if label, _, _, _ := d.yFilesGraphics(); label != "" && name == "" {
+							name = label
+						}
+					}
+				}
+
+				id := uuid.New()
+				if parsed, err := uuid.Parse(edge.ID); err == nil {
+					if _, ok := c.Connections[parsed]; !ok {
+						id = parsed
+					}
+				}
+
+				restored, err := superior.connectTo(inferior, name, id)
+				if errors.Is(err, ErrConnectToItself) {
+					report.drop("edge %q connecting node %q to itself", edge.ID, edge.Source)
+					continue
+				} else if err != nil {
+					return err
+				}
+				report.connection(importAction(restored), "edge %q from %q to %q", edge.ID, edge.Source, edge.Target)
+
+				if edge.Directed == "false" || (edge.Directed == "" && graph.EdgeDefault == "undirected") {
+					undirected++
+				}
+			}
+
+			if undirected > 0 {
+				report.drop("direction of %d undirected edges, imported from source to target", undirected)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,189 @@
+package conatho
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testConatho(t *testing.T) *Conatho {
+	t.Helper()
+	c, err := New(filepath.Join(t.TempDir(), "test.conatho"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return &c
+}
+
+func entityByName(t *testing.T, c *Conatho, name string) *Entity {
+	t.Helper()
+	for _, e := range c.Entities {
+		if e.Name == name {
+			return e
+		}
+	}
+	t.Fatalf("no entity named %q", name)
+	return nil
+}
+
+// Values of the attributes of the entity by type name
+func attributeValues(t *testing.T, e *Entity) map[string]any {
+	t.Helper()
+	attributes, err := e.GetAttributes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]any)
+	for _, a := range attributes {
+		switch {
+		case a.Null:
+			values[a.Name] = nil
+		case a.Type == DatatypeNumber:
+			values[a.Name] = a.Number
+		case a.Type == DatatypeString:
+			values[a.Name] = a.String
+		case a.Type == DatatypeData:
+			values[a.Name] = string(a.Data)
+		}
+	}
+	return values
+}
+
+const testGraphML = `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+	<key id="d0" for="node" attr.name="label" attr.type="string"/>
+	<key id="d1" for="node" attr.name="age" attr.type="int"/>
+	<key id="d2" for="node" attr.name="city" attr.type="string">
+		<default>Nowhere</default>
+	</key>
+	<key id="d3" for="graph" attr.name="title" attr.type="string"/>
+	<key id="d4" for="edge" attr.name="label" attr.type="string"/>
+	<key id="d5" for="edge" attr.name="weight" attr.type="double"/>
+	<graph id="G" edgedefault="directed">
+		<data key="d3">Family</data>
+		<node id="n0">
+			<data key="d0">Alice</data>
+			<data key="d1">42</data>
+			<data key="d2">Paris</data>
+		</node>
+		<node id="n1">
+			<data key="d0">Bob</data>
+			<data key="d1">4.5</data>
+			<data key="d9">unknown</data>
+			<port name="p0"/>
+		</node>
+		<node id="n1">
+			<data key="d0">Bob again</data>
+		</node>
+		<edge id="e0" source="n0" target="n1">
+			<data key="d4">Parent</data>
+			<data key="d5">1.0</data>
+		</edge>
+		<edge id="e1" source="n0" target="n7"/>
+		<edge id="e2" source="n1" target="n1"/>
+		<hyperedge>
+			<endpoint node="n0"/>
+			<endpoint node="n1"/>
+		</hyperedge>
+	</graph>
+</graphml>`
+
+func TestImportGraphMLDrops(t *testing.T) {
+	c := testConatho(t)
+
+	report, err := c.ImportGraphML(strings.NewReader(testGraphML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entities != 2 || report.Connections != 1 || report.AttributeTypes != 2 {
+		t.Errorf("imported %d entities, %d connections and %d attribute types, want 2, 1 and 2",
+			report.Entities, report.Connections, report.AttributeTypes)
+	}
+
+	for _, want := range []string{
+		`graph key "title"`,
+		`edge key "weight"`,
+		`1 data values of graph "G"`,
+		`1 hyperedges of graph "G"`,
+		`duplicate node "n1"`,
+		`1 ports of node "n1"`,
+		`value for unknown key "d9" of node "n1"`,
+		`value "4.5" of "age" for node "n1": not a whole number`,
+		`edge "e1" with unknown target "n7"`,
+		`edge "e2" connecting node "n1" to itself`,
+	} {
+		if !slices.Contains(report.Dropped, want) {
+			t.Errorf("%s not dropped", want)
+		}
+	}
+	if len(report.Dropped) != 10 {
+		t.Errorf("dropped %d items, want 10:\n%s", len(report.Dropped), strings.Join(report.Dropped, "\n"))
+	}
+
+	alice := attributeValues(t, entityByName(t, c, "Alice"))
+	if alice["age"] != int64(42) || alice["city"] != "Paris" {
+		t.Errorf("attributes of Alice: %v", alice)
+	}
+	bob := attributeValues(t, entityByName(t, c, "Bob"))
+	if _, ok := bob["age"]; ok || bob["city"] != "Nowhere" {
+		t.Errorf("attributes of Bob: %v", bob)
+	}
+
+	var names []string
+	for _, connection := range c.Connections {
+		names = append(names, connection.Name)
+	}
+	if !slices.Equal(names, []string{"Parent"}) {
+		t.Errorf("connections %q, want [\"Parent\"]", names)
+	}
+}
+
+func TestGraphMLRoundTrip(t *testing.T) {
+	c := testConatho(t)
+
+	number, _ := c.AddAttributeType("Number", DatatypeNumber)
+	text, _ := c.AddAttributeType("Text", DatatypeString)
+	data, _ := c.AddAttributeType("Data", DatatypeData)
+
+	created, err := c.CreateEntity(10, 20, "Entity <1>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := c.Entities[created.ID]
+	for typeID, value := range map[int64]any{number: int64(-7), text: "a & b", data: []byte{0, 1, 2, 255}} {
+		_, err := e.addAttributeValue(typeID, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	err = c.ExportGraphML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported := testConatho(t)
+	report, err := imported.ImportGraphML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Dropped) > 0 {
+		t.Errorf("dropped %q", report.Dropped)
+	}
+
+	got := imported.Entities[e.ID]
+	if got == nil {
+		t.Fatal("entity ID not kept")
+	}
+	if got.Name != e.Name || got.X != e.X || got.Y != e.Y {
+		t.Errorf("got %q at %d,%d, want %q at %d,%d", got.Name, got.X, got.Y, e.Name, e.X, e.Y)
+	}
+	values := attributeValues(t, got)
+	if values["Number"] != int64(-7) || values["Text"] != "a & b" || values["Data"] != "\x00\x01\x02\xff" {
+		t.Errorf("attributes %q", values)
+	}
+}
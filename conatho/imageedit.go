@@ -0,0 +1,252 @@
+package conatho
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+)
+
+var ErrInvalidEdit = errors.New("invalid image edit")
+
+// ImageEdit describes how an image is shown: turned clockwise by Rotation
+// degrees, then flipped horizontally, then cropped. The crop is in the
+// coordinates of the turned image, an empty crop shows the whole image. The
+// original image is kept, so an edit can always be changed again.
+type ImageEdit struct {
+	Rotation int
+	Flip     bool
+	Crop     image.Rectangle
+}
+
+func (ed ImageEdit) IsZero() bool {
+	return ed.Rotation == 0 && !ed.Flip && ed.Crop.Empty()
+}
+
+func (ed ImageEdit) String() string {
+	var parts []string
+	if ed.Rotation != 0 {
+		parts = append(parts, fmt.Sprintf("rotated %d", ed.Rotation))
+	}
+	if ed.Flip {
+		parts = append(parts, "flipped")
+	}
+	if !ed.Crop.Empty() {
+		parts = append(parts, fmt.Sprintf("cropped to %d,%d %dx%d", ed.Crop.Min.X, ed.Crop.Min.Y, ed.Crop.Dx(), ed.Crop.Dy()))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Size returns the size of an image of width by height after it is turned,
+// before it is cropped
+func (ed ImageEdit) Size(width, height int) (int, int) {
+	if ed.Rotation == 90 || ed.Rotation == 270 {
+		return height, width
+	}
+	return width, height
+}
+
+// CenteredSquare returns the largest square crop in the middle of an image of
+// width by height after it is turned
+func (ed ImageEdit) CenteredSquare(width, height int) image.Rectangle {
+	width, height = ed.Size(width, height)
+	size := min(width, height)
+	x := (width - size) / 2
+	y := (height - size) / 2
+	return image.Rect(x, y, x+size, y+size)
+}
+
+// RotateRight turns the image as it is shown a quarter clockwise, width and
+// height are the size of the upright original. The crop turns along.
+func (ed ImageEdit) RotateRight(width, height int) ImageEdit {
+	_, h := ed.Size(width, height)
+
+	// Turning a flipped image clockwise is the same as flipping an image
+	// turned counterclockwise
+	if ed.Flip {
+		ed.Rotation = (ed.Rotation + 270) % 360
+	} else {
+		ed.Rotation = (ed.Rotation + 90) % 360
+	}
+
+	if !ed.Crop.Empty() {
+		c := ed.Crop
+		ed.Crop = image.Rect(h-c.Max.Y, c.Min.X, h-c.Min.Y, c.Max.X)
+	}
+	return ed
+}
+
+// RotateLeft turns the image as it is shown a quarter counterclockwise
+func (ed ImageEdit) RotateLeft(width, height int) ImageEdit {
+	for range 3 {
+		ed = ed.RotateRight(width, height)
+	}
+	return ed
+}
+
+// ToggleFlip flips the image as it is shown horizontally, the crop flips along
+func (ed ImageEdit) ToggleFlip(width, height int) ImageEdit {
+	w, _ := ed.Size(width, height)
+	ed.Flip = !ed.Flip
+
+	if !ed.Crop.Empty() {
+		c := ed.Crop
+		ed.Crop = image.Rect(w-c.Max.X, c.Min.Y, w-c.Min.X, c.Max.Y)
+	}
+	return ed
+}
+
+// The same edit with any empty crop as the zero rectangle, so edits can be
+// compared
+func (ed ImageEdit) normalize() ImageEdit {
+	if ed.Crop.Empty() {
+		ed.Crop = image.Rectangle{}
+	}
+	return ed
+}
+
+// Check the edit against an image of width by height
+func (ed ImageEdit) validate(width, height int) error {
+	switch ed.Rotation {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("%w: rotation must be 0, 90, 180 or 270", ErrInvalidEdit)
+	}
+
+	if !ed.Crop.Empty() {
+		width, height = ed.Size(width, height)
+		if !ed.Crop.In(image.Rect(0, 0, width, height)) {
+			return fmt.Errorf("%w: crop is outside of the image", ErrInvalidEdit)
+		}
+	}
+	return nil
+}
+
+// Apply turns and crops the image
+func (ed ImageEdit) Apply(img image.Image) image.Image {
+	switch ed.Rotation {
+	case 90:
+		img = orient(img, orientationRotate90)
+	case 180:
+		img = orient(img, orientationRotate180)
+	case 270:
+		img = orient(img, orientationRotate270)
+	}
+	if ed.Flip {
+		img = orient(img, orientationFlipH)
+	}
+
+	if ed.Crop.Empty() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	crop := ed.Crop.Add(bounds.Min).Intersect(bounds)
+	if crop.Empty() {
+		return img
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, crop.Min, draw.Src)
+	return dst
+}
+
+// DecodeImage decodes an image in any of the supported formats and turns it
+// upright according to its EXIF orientation
+func DecodeImage(data []byte) (image.Image, error) {
+	img, _, err := decodeImage(data)
+	return img, err
+}
+
+// ImageEditPreview returns the image with the edit applied as it would be
+// shown on a card, size pixels wide and high, encoded as QOI
+func ImageEditPreview(img image.Image, edit ImageEdit, size int) ([]byte, error) {
+	return makeThumbnail(edit.Apply(img), size)
+}
+
+// Columns of the images table holding the edit
+const imageEditColumns = "rotation, flip, crop_x, crop_y, crop_width, crop_height"
+
+func scanImageEdit(scan func(dest ...any) error, dest ...any) (ImageEdit, error) {
+	var ed ImageEdit
+	var x, y, w, h int
+	err := scan(append(dest, &ed.Rotation, &ed.Flip, &x, &y, &w, &h)...)
+	ed.Crop = image.Rect(x, y, x+w, y+h)
+	return ed.normalize(), err
+}
+
+func imageEditValues(ed ImageEdit) []any {
+	return []any{ed.Rotation, ed.Flip, ed.Crop.Min.X, ed.Crop.Min.Y, ed.Crop.Dx(), ed.Crop.Dy()}
+}
+
+// SetImageEdit changes how the image is turned and cropped, the thumbnail is
+// made again from the original image
+func (e *Entity) SetImageEdit(imageID int64, edit ImageEdit) error {
+	id, err := e.ID.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	edit = edit.normalize()
+
+	var caption string
+	var data []byte
+	row := e.c.db().QueryRow(`
+		SELECT caption, data, `+imageEditColumns+`
+		FROM images JOIN image_blobs USING (hash)
+		WHERE entity = ? AND id = ?`, id, imageID)
+	old, err := scanImageEdit(row.Scan, &caption, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUnknownImage
+	} else if err != nil {
+		return err
+	}
+	if old == edit {
+		return nil
+	}
+
+	img, _, err := decodeImage(data)
+	if err != nil {
+		return err
+	}
+	bounds := img.Bounds()
+	err = edit.validate(bounds.Dx(), bounds.Dy())
+	if err != nil {
+		return err
+	}
+
+	thumbnail, err := makeThumbnail(edit.Apply(img), e.c.thumbnailSize())
+	if err != nil {
+		return err
+	}
+
+	return e.c.Transaction(func() error {
+		_, err := e.c.db().Exec(`
+			UPDATE images SET rotation = ?, flip = ?, crop_x = ?, crop_y = ?, crop_width = ?, crop_height = ?, thumbnail = ?
+			WHERE id = ?`,
+			append(imageEditValues(edit), thumbnail, imageID)...)
+		if err != nil {
+			return err
+		}
+
+		return e.changed(AuditImage, caption, old.String(), edit.String())
+	})
+}
+
+// Edit of a document image
+func (di DocumentImage) edit() ImageEdit {
+	ed := ImageEdit{Rotation: di.Rotation, Flip: di.Flip}
+	if di.Crop != nil {
+		ed.Crop = image.Rect(di.Crop.X, di.Crop.Y, di.Crop.X+di.Crop.Width, di.Crop.Y+di.Crop.Height)
+	}
+	return ed.normalize()
+}
+
+func (di *DocumentImage) setEdit(ed ImageEdit) {
+	di.Rotation = ed.Rotation
+	di.Flip = ed.Flip
+	di.Crop = nil
+	if !ed.Crop.Empty() {
+		di.Crop = &DocumentCrop{X: ed.Crop.Min.X, Y: ed.Crop.Min.Y, Width: ed.Crop.Dx(), Height: ed.Crop.Dy()}
+	}
+}
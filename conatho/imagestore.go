@@ -0,0 +1,179 @@
+package conatho
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInTransaction = errors.New("not possible during a transaction")
+
+// Images are stored once in image_blobs, keyed by the SHA-256 hash of their
+// data. Every image of an entity holds a reference, blobs are deleted when
+// their last reference is.
+
+// Store the image data unless it is stored already, and take a reference to
+// it. Returns the hash the image is referred to by.
+func (c *Conatho) acquireImageBlob(si storedImage) (string, error) {
+	hash := blobHash(si.data)
+	bounds := si.img.Bounds()
+
+	_, err := c.db().Exec(`
+		INSERT INTO image_blobs (hash, data, mime_type, width, height, refs)
+		VALUES (?, ?, ?, ?, ?, 1)
+		ON CONFLICT (hash) DO UPDATE SET refs = refs + 1`,
+		hash, si.data, si.mimeType, bounds.Dx(), bounds.Dy())
+	if err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// Give up a reference to the image data, it is deleted with the last one
+func (c *Conatho) releaseImageBlob(hash string) error {
+	_, err := c.db().Exec("UPDATE image_blobs SET refs = refs - 1 WHERE hash = ?", hash)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db().Exec("DELETE FROM image_blobs WHERE hash = ? AND refs <= 0", hash)
+	return err
+}
+
+// Delete the images matching the condition and release their blobs, blobs
+// without references are deleted
+func (c *Conatho) deleteImages(condition string, args ...any) error {
+	_, err := c.db().Exec(`
+		UPDATE image_blobs SET refs = refs - (
+			SELECT COUNT(*) FROM images WHERE images.hash = image_blobs.hash AND (`+condition+`))
+		WHERE hash IN (SELECT hash FROM images WHERE `+condition+`)`,
+		append(args, args...)...)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db().Exec("DELETE FROM images WHERE "+condition, args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db().Exec("DELETE FROM image_blobs WHERE refs <= 0")
+	return err
+}
+
+// CompactReport tells what Compact cleaned up
+type CompactReport struct {
+	// Blobs is the number of image blobs deleted
+	Blobs int64
+	// SizeBefore and SizeAfter are the size of the file in bytes
+	SizeBefore int64
+	SizeAfter  int64
+}
+
+func (r CompactReport) String() string {
+	return fmt.Sprintf("Deleted %d unused images, %d bytes before and %d bytes after", r.Blobs, r.SizeBefore, r.SizeAfter)
+}
+
+// Compact counts the references to all image blobs again, deletes the blobs
+// that are no longer used and gives the free space back to the file system.
+// It can not be called during a transaction.
+func (c *Conatho) Compact() (CompactReport, error) {
+	var report CompactReport
+	if c.tx != nil {
+		return report, ErrInTransaction
+	}
+
+	size, err := c.fileSize()
+	if err != nil {
+		return report, err
+	}
+	report.SizeBefore = size
+
+	err = c.Transaction(func() error {
+		_, err := c.db().Exec("UPDATE image_blobs SET refs = (SELECT COUNT(*) FROM images WHERE images.hash = image_blobs.hash)")
+		if err != nil {
+			return err
+		}
+
+		result, err := c.db().Exec("DELETE FROM image_blobs WHERE refs = 0")
+		if err != nil {
+			return err
+		}
+		report.Blobs, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return report, err
+	}
+
+	_, err = c.sql.Exec("VACUUM")
+	if err != nil {
+		return report, err
+	}
+
+	report.SizeAfter, err = c.fileSize()
+	return report, err
+}
+
+// Size of the database in bytes
+func (c *Conatho) fileSize() (int64, error) {
+	var pageCount, pageSize int64
+	row := c.db().QueryRow("SELECT page_count, page_size FROM pragma_page_count(), pragma_page_size()")
+	err := row.Scan(&pageCount, &pageSize)
+	return pageCount * pageSize, err
+}
+
+// RegenerateThumbnails makes the thumbnails of all images again from the
+// original data and their edits, at the current thumbnail size. Returns the
+// number of thumbnails made.
+func (c *Conatho) RegenerateThumbnails() (int, error) {
+	var ids []int64
+	rows, err := c.db().Query("SELECT id FROM images")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	err = c.Transaction(func() error {
+		// One image at a time, the images of a file may not fit in memory
+		for _, id := range ids {
+			var data []byte
+			row := c.db().QueryRow("SELECT data, "+imageEditColumns+" FROM images JOIN image_blobs USING (hash) WHERE id = ?", id)
+			edit, err := scanImageEdit(row.Scan, &data)
+			if err != nil {
+				return err
+			}
+
+			img, _, err := decodeImage(data)
+			if err != nil {
+				return err
+			}
+			thumbnail, err := makeThumbnail(edit.Apply(img), c.thumbnailSize())
+			if err != nil {
+				return err
+			}
+
+			_, err = c.db().Exec("UPDATE images SET thumbnail = ? WHERE id = ?", thumbnail, id)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
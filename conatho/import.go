@@ -0,0 +1,310 @@
+package conatho
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ImportAction is what an import did with an item of the imported file
+type ImportAction int
+
+const (
+	ImportCreated ImportAction = iota
+	ImportUpdated
+	ImportUnchanged
+	// An item with the same ID was in the trash and is taken out of it
+	ImportRestored
+)
+
+func (a ImportAction) String() string {
+	switch a {
+	case ImportCreated:
+		return "create"
+	case ImportUpdated:
+		return "update"
+	case ImportRestored:
+		return "restore"
+	}
+	return "keep"
+}
+
+// ImportItem is the decision an import made for a row or record
+type ImportItem struct {
+	Action ImportAction
+	Item   string
+}
+
+// ImportReport summarises what an import has done
+type ImportReport struct {
+	Entities       int
+	Connections    int
+	AttributeTypes int
+
+	// Existing entities matched on a unique key, and entities or connections
+	// that were already up to date
+	Updated   int
+	Unchanged int
+
+	// Entities and connections in the trash with the ID of an imported item,
+	// they are restored with the imported contents
+	Restored int
+
+	// Nothing has been changed, the report shows what an import would do
+	DryRun bool
+
+	// Everything that could not be imported
+	Dropped []string
+
+	// Decision for every row or record, in the order of the file
+	Items []ImportItem
+}
+
+// Action for a new item, which may have been taken out of the trash
+func importAction(restored bool) ImportAction {
+	if restored {
+		return ImportRestored
+	}
+	return ImportCreated
+}
+
+func (r *ImportReport) drop(format string, a ...any) {
+	r.Dropped = append(r.Dropped, fmt.Sprintf(format, a...))
+}
+
+func (r *ImportReport) item(action ImportAction, format string, a ...any) {
+	r.Items = append(r.Items, ImportItem{Action: action, Item: fmt.Sprintf(format, a...)})
+}
+
+// Count an entity that was created, updated or already up to date
+func (r *ImportReport) entity(action ImportAction, format string, a ...any) {
+	switch action {
+	case ImportCreated:
+		r.Entities++
+	case ImportUpdated:
+		r.Updated++
+	case ImportUnchanged:
+		r.Unchanged++
+	case ImportRestored:
+		r.Restored++
+	}
+	r.item(action, format, a...)
+}
+
+// Count a connection that was created or already existed
+func (r *ImportReport) connection(action ImportAction, format string, a ...any) {
+	switch action {
+	case ImportCreated:
+		r.Connections++
+	case ImportRestored:
+		r.Restored++
+	default:
+		r.Unchanged++
+	}
+	r.item(action, format, a...)
+}
+
+func (r *ImportReport) attributeType(name string) {
+	r.AttributeTypes++
+	r.item(ImportCreated, "attribute type %q", name)
+}
+
+func (r ImportReport) String() string {
+	var sb strings.Builder
+	if r.DryRun {
+		fmt.Fprintf(&sb, "Dry run, nothing has been changed\n")
+	}
+	fmt.Fprintf(&sb, "Imported %d entities, %d connections and %d attribute types\n", r.Entities, r.Connections, r.AttributeTypes)
+	if r.Updated > 0 || r.Unchanged > 0 {
+		fmt.Fprintf(&sb, "Updated %d entities, %d items were already up to date\n", r.Updated, r.Unchanged)
+	}
+	if r.Restored > 0 {
+		fmt.Fprintf(&sb, "Restored %d items from the trash with the imported contents\n", r.Restored)
+	}
+	if len(r.Dropped) > 0 {
+		fmt.Fprintf(&sb, "Dropped %d items:\n", len(r.Dropped))
+		for _, d := range r.Dropped {
+			fmt.Fprintf(&sb, "  %s\n", d)
+		}
+	}
+	// A dry run shows what would happen to every item
+	if r.DryRun && len(r.Items) > 0 {
+		fmt.Fprintf(&sb, "Decisions:\n")
+		for _, item := range r.Items {
+			fmt.Fprintf(&sb, "  %s %s\n", item.Action, item.Item)
+		}
+	}
+	return sb.String()
+}
+
+var errDryRun = errors.New("dry run")
+
+// DryRun runs an import and rolls it back afterwards, the report shows what
+// the import would have done
+func (c *Conatho) DryRun(importer func() (ImportReport, error)) (ImportReport, error) {
+	if c.tx != nil {
+		return ImportReport{}, errors.New("dry run inside a transaction")
+	}
+
+	var report ImportReport
+	err := c.Transaction(func() error {
+		var err error
+		report, err = importer()
+		if err != nil {
+			return err
+		}
+		return errDryRun
+	})
+	if !errors.Is(err, errDryRun) {
+		return ImportReport{}, err
+	}
+
+	report.DryRun = true
+	return report, nil
+}
+
+// Imported entities without a position are placed in a grid below the
+// existing entities
+const (
+	importColumns  = 10
+	importSpacingX = 200
+	importSpacingY = 250
+)
+
+type importPlacer struct {
+	originY int32
+	i       int
+}
+
+func (c *Conatho) newImportPlacer() *importPlacer {
+	p := importPlacer{}
+	for i, k := range c.EntitiesKeys {
+		e := c.Entities[k]
+		if i == 0 || e.Y+importSpacingY > p.originY {
+			p.originY = e.Y + importSpacingY
+		}
+	}
+	return &p
+}
+
+func (p *importPlacer) next() (int32, int32) {
+	x := int32(p.i%importColumns) * importSpacingX
+	y := p.originY + int32(p.i/importColumns)*importSpacingY
+	p.i++
+	return x, y
+}
+
+// Add an attribute to the entity and set its value
+func (e *Entity) addAttributeValue(attributeTypeID int64, value any) (int64, error) {
+	attributeID, err := e.AddAttribute(attributeTypeID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = e.UpdateAttribute(attributeID, value)
+	if err != nil {
+		return 0, err
+	}
+
+	return attributeID, nil
+}
+
+// Value of a unique key as it is matched on
+func keyString(value any) string {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return v
+	}
+	return ""
+}
+
+func (a Attribute) equal(value any) bool {
+	if a.Null {
+		return false
+	}
+
+	switch v := value.(type) {
+	case int64:
+		return a.Type == DatatypeNumber && a.Number == v
+	case string:
+		return a.Type == DatatypeString && a.String == v
+	case []byte:
+		return a.Type == DatatypeData && bytes.Equal(a.Data, v)
+	}
+	return false
+}
+
+// attributeUpdater sets the values of an existing entity, the n-th value of a
+// type is stored in the n-th attribute of that type
+type attributeUpdater struct {
+	e        *Entity
+	existing map[int64][]Attribute
+	seen     map[int64]int
+	changed  bool
+}
+
+func (e *Entity) newAttributeUpdater() (*attributeUpdater, error) {
+	attributes, err := e.GetAttributes()
+	if err != nil {
+		return nil, err
+	}
+
+	u := attributeUpdater{
+		e:        e,
+		existing: make(map[int64][]Attribute),
+		seen:     make(map[int64]int),
+	}
+	for _, a := range attributes {
+		u.existing[a.TypeID] = append(u.existing[a.TypeID], a)
+	}
+
+	return &u, nil
+}
+
+func (u *attributeUpdater) set(attributeTypeID int64, value any) error {
+	n := u.seen[attributeTypeID]
+	u.seen[attributeTypeID]++
+
+	if n < len(u.existing[attributeTypeID]) {
+		a := u.existing[attributeTypeID][n]
+		if a.equal(value) {
+			return nil
+		}
+		u.changed = true
+		return u.e.UpdateAttribute(a.ID, value)
+	}
+
+	u.changed = true
+	_, err := u.e.addAttributeValue(attributeTypeID, value)
+	return err
+}
+
+func (u *attributeUpdater) rename(name string) error {
+	if u.e.Name == name {
+		return nil
+	}
+	u.changed = true
+	return u.e.Rename(name)
+}
+
+func (u *attributeUpdater) action() ImportAction {
+	if u.changed {
+		return ImportUpdated
+	}
+	return ImportUnchanged
+}
+
+// Whether the entities are already connected with the name
+func (c *Conatho) connected(superior, inferior *Entity, name string) bool {
+	for _, id := range superior.Connections {
+		connection, ok := c.Connections[id]
+		if ok && connection.Superior == superior.ID && connection.Inferior == inferior.ID && connection.Name == name {
+			return true
+		}
+	}
+	return false
+}
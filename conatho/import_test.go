@@ -0,0 +1,71 @@
+package conatho
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	c := testConatho(t)
+
+	id, _ := c.AddAttributeType("ID", DatatypeString)
+	err := c.SetAttributeTypeKey(id, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, key := range map[string]string{"Alice": "1", "Bob": "2"} {
+		created, err := c.CreateEntity(0, 0, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.Entities[created.ID].addAttributeValue(id, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := entityByName(t, c, "Alice")
+	err = alice.ConnectTo(entityByName(t, c, "Bob"), "Knows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entities, connections := len(c.Entities), len(c.Connections)
+
+	table, err := ReadCSV(strings.NewReader("name,ID,Age\nAlicia,1,42\nBob,2,\nCarol,3,7\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := c.DryRun(func() (ImportReport, error) {
+		return c.ImportCSVEntities(table, table.DefaultEntityMapping(c, table.NameColumn()))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ImportItem{
+		{ImportCreated, `attribute type "Age"`},
+		{ImportUpdated, `line 2: entity "Alicia"`},
+		{ImportUnchanged, `line 3: entity "Bob"`},
+		{ImportCreated, `line 4: entity "Carol"`},
+	}
+	if !report.DryRun || !slices.Equal(report.Items, want) {
+		t.Errorf("items %v, want %v", report.Items, want)
+	}
+	if !strings.Contains(report.String(), "  update line 2: entity \"Alicia\"\n") {
+		t.Errorf("no decisions in report:\n%s", report)
+	}
+
+	// Nothing changed and the entities are still the same
+	if len(c.Entities) != entities || len(c.Connections) != connections || len(c.EntitiesKeys) != entities {
+		t.Errorf("%d entities and %d connections after the dry run, want %d and %d", len(c.Entities), len(c.Connections), entities, connections)
+	}
+	if c.Entities[alice.ID] != alice || alice.Name != "Alice" || len(alice.Connections) != 1 {
+		t.Errorf("entity %q with %d connections was not restored", alice.Name, len(alice.Connections))
+	}
+	if _, ok := c.AttributeTypeByName("Age"); ok {
+		t.Error("attribute type created by the dry run is kept")
+	}
+	if values := attributeValues(t, alice); values["ID"] != "1" || len(values) != 1 {
+		t.Errorf("attributes of Alice: %v", values)
+	}
+}
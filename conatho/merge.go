@@ -0,0 +1,548 @@
+package conatho
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type Resolution int
+
+const (
+	KeepOurs Resolution = iota
+	TakeTheirs
+)
+
+// Conflict is an item changed differently in both files, the values are
+// formatted for display
+type Conflict struct {
+	Item       string
+	Field      string
+	Ours       string
+	Theirs     string
+	Resolution Resolution
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s %s: ours %s, theirs %s", c.Item, c.Field, c.Ours, c.Theirs)
+}
+
+// Merge combines the changes made to two copies of a file. Conflicts are
+// resolved by setting their Resolution before getting the Document, they keep
+// our version by default.
+type Merge struct {
+	Conflicts []Conflict
+
+	// Values that could not be merged, like attributes of a type that has a
+	// different datatype in theirs
+	Dropped []string
+
+	base   *Document
+	ours   Document
+	theirs Document
+}
+
+// MergeDocuments merges theirs into ours. Entities and connections are
+// matched by UUID, attribute types by name. base is the document both were
+// copied from, without it every difference is a conflict.
+func MergeDocuments(base *Document, ours, theirs Document) *Merge {
+	m := Merge{base: base, ours: ours, theirs: theirs}
+
+	var mg merger
+	mg.merge(base, ours, theirs)
+	m.Conflicts = mg.conflicts
+	m.Dropped = mg.dropped
+
+	return &m
+}
+
+// Document returns the merged document with the conflicts resolved
+func (m *Merge) Document() Document {
+	mg := merger{resolutions: m.Conflicts}
+	return mg.merge(m.base, m.ours, m.theirs)
+}
+
+// Changes lists what the merge changes in our file
+func (m *Merge) Changes() Changes {
+	return DiffDocuments(m.ours, m.Document())
+}
+
+// PrepareMerge merges the changes made in theirs into the file, base is the
+// file both were copied from and may be nil
+func (c *Conatho) PrepareMerge(theirs, base *Conatho) (*Merge, error) {
+	ours, err := c.Document()
+	if err != nil {
+		return nil, err
+	}
+
+	theirsDoc, err := theirs.Document()
+	if err != nil {
+		return nil, err
+	}
+
+	var baseDoc *Document
+	if base != nil {
+		doc, err := base.Document()
+		if err != nil {
+			return nil, err
+		}
+		baseDoc = &doc
+	}
+
+	return MergeDocuments(baseDoc, ours, theirsDoc), nil
+}
+
+// ApplyMerge replaces the contents of the file with the merged document
+func (c *Conatho) ApplyMerge(m *Merge) (ImportReport, error) {
+	return c.replace(m.Document(), AuditMerge, "")
+}
+
+// A value of a field, compared by key
+type mergeValue struct {
+	key  string
+	text string
+}
+
+// Merging is run again with the chosen resolutions to get the document,
+// conflicts are found in the same order every time
+type merger struct {
+	conflicts   []Conflict
+	resolutions []Conflict
+	dropped     []string
+}
+
+func (mg *merger) conflict(c Conflict) Resolution {
+	i := len(mg.conflicts)
+	if i < len(mg.resolutions) {
+		c.Resolution = mg.resolutions[i].Resolution
+	}
+	mg.conflicts = append(mg.conflicts, c)
+	return c.Resolution
+}
+
+// Whether the value of theirs is taken. A value changed in only one file is
+// taken from that file, base is nil when the item is not in a base document.
+func (mg *merger) pick(item, field string, ours, theirs mergeValue, base *mergeValue) bool {
+	switch {
+	case ours.key == theirs.key:
+		return false
+	case base != nil && base.key == ours.key:
+		return true
+	case base != nil && base.key == theirs.key:
+		return false
+	}
+	return mg.conflict(Conflict{Item: item, Field: field, Ours: ours.text, Theirs: theirs.text}) == TakeTheirs
+}
+
+// Whether an item deleted in one file and edited in the other is kept
+func (mg *merger) keepEdited(item string, deletedInOurs bool) bool {
+	c := Conflict{Item: item, Field: "deleted", Ours: "edited", Theirs: "deleted"}
+	if deletedInOurs {
+		c.Ours, c.Theirs = "deleted", "edited"
+	}
+	resolution := mg.conflict(c)
+	return (resolution == TakeTheirs) == deletedInOurs
+}
+
+func (mg *merger) drop(format string, a ...any) {
+	mg.dropped = append(mg.dropped, fmt.Sprintf(format, a...))
+}
+
+// Attributes of an entity grouped by the name of their type
+type attributeGroups struct {
+	byName map[string][]DocumentAttribute
+	order  []string
+}
+
+func groupAttributes(attributes []DocumentAttribute, typeNames map[int64]string) attributeGroups {
+	groups := attributeGroups{byName: make(map[string][]DocumentAttribute)}
+	for _, da := range attributes {
+		name := typeNames[da.Type]
+		if _, ok := groups.byName[name]; !ok {
+			groups.order = append(groups.order, name)
+		}
+		groups.byName[name] = append(groups.byName[name], da)
+	}
+	return groups
+}
+
+// Values of the attributes of a type, compared in order
+func attributesValue(attributes []DocumentAttribute) mergeValue {
+	if len(attributes) == 0 {
+		return mergeValue{text: diffNone}
+	}
+
+	keys := make([]string, len(attributes))
+	texts := make([]string, len(attributes))
+	for i, da := range attributes {
+		texts[i] = formatAttribute(da)
+		keys[i] = texts[i]
+		if da.Data != nil {
+			keys[i] = "data " + blobHash(da.Data.Data)
+		}
+	}
+	return mergeValue{key: strings.Join(keys, "\x00"), text: strings.Join(texts, ", ")}
+}
+
+// All images of an entity, they are merged as a whole
+func imageValue(images []DocumentImage) mergeValue {
+	if len(images) == 0 {
+		return mergeValue{text: diffNone}
+	}
+	keys := make([]string, len(images))
+	texts := make([]string, len(images))
+	for i, di := range images {
+		keys[i] = fmt.Sprintf("%s %s %t %s %s", di.MIMEType, blobHash(di.Data), di.Primary, di.edit(), di.Caption)
+		texts[i] = formatImage(di)
+	}
+	return mergeValue{key: strings.Join(keys, "\x00"), text: strings.Join(texts, "; ")}
+}
+
+func entityValues(de *DocumentEntity, typeNames map[int64]string) (name, position, image mergeValue, attributes attributeGroups) {
+	name = mergeValue{de.Name, strconv.Quote(de.Name)}
+	position = mergeValue{formatPosition(de.X, de.Y), formatPosition(de.X, de.Y)}
+	image = imageValue(de.Images)
+	attributes = groupAttributes(de.Attributes, typeNames)
+	return
+}
+
+// Whether the entity is the same in both documents
+func entitiesEqual(a *DocumentEntity, aNames map[int64]string, b *DocumentEntity, bNames map[int64]string) bool {
+	aName, aPosition, aImage, aAttributes := entityValues(a, aNames)
+	bName, bPosition, bImage, bAttributes := entityValues(b, bNames)
+	if aName != bName || aPosition != bPosition || aImage.key != bImage.key {
+		return false
+	}
+	if len(aAttributes.byName) != len(bAttributes.byName) {
+		return false
+	}
+	for name, attributes := range aAttributes.byName {
+		if attributesValue(attributes).key != attributesValue(bAttributes.byName[name]).key {
+			return false
+		}
+	}
+	return true
+}
+
+func connectionsEqual(a, b *DocumentConnection) bool {
+	return a.Name == b.Name && a.Superior == b.Superior && a.Inferior == b.Inferior
+}
+
+// Whether an entity the connection connects is missing from the entities
+func withDeletedEntity(dc *DocumentConnection, entities map[uuid.UUID]*DocumentEntity) bool {
+	return entities[dc.Superior] == nil || entities[dc.Inferior] == nil
+}
+
+func attributeTypeNames(doc *Document) map[int64]string {
+	names := make(map[int64]string)
+	if doc != nil {
+		for _, dt := range doc.AttributeTypes {
+			names[dt.ID] = dt.Name
+		}
+	}
+	return names
+}
+
+func entitiesByID(doc *Document) map[uuid.UUID]*DocumentEntity {
+	entities := make(map[uuid.UUID]*DocumentEntity)
+	if doc != nil {
+		for i := range doc.Entities {
+			entities[doc.Entities[i].ID] = &doc.Entities[i]
+		}
+	}
+	return entities
+}
+
+func connectionsByID(doc *Document) map[uuid.UUID]*DocumentConnection {
+	connections := make(map[uuid.UUID]*DocumentConnection)
+	if doc != nil {
+		for i := range doc.Connections {
+			connections[doc.Connections[i].ID] = &doc.Connections[i]
+		}
+	}
+	return connections
+}
+
+// IDs of all maps sorted
+func unionIDs[V any](ms ...map[uuid.UUID]V) []uuid.UUID {
+	ids := make(map[uuid.UUID]bool)
+	for _, m := range ms {
+		for id := range m {
+			ids[id] = true
+		}
+	}
+	return slices.SortedFunc(maps.Keys(ids), compareUUID)
+}
+
+func (mg *merger) merge(base *Document, ours, theirs Document) Document {
+	result := Document{
+		Format:         DocumentFormat,
+		Version:        DocumentVersion,
+		AttributeTypes: []DocumentAttributeType{},
+		Entities:       []DocumentEntity{},
+		Connections:    []DocumentConnection{},
+	}
+
+	oursNames := attributeTypeNames(&ours)
+	theirsNames := attributeTypeNames(&theirs)
+	baseNames := attributeTypeNames(base)
+
+	// Attribute types of ours are kept, the ones only in theirs are added
+	typeIDs := make(map[string]int64)
+	typeIndexes := make(map[string]int)
+	// IDs given to the types of the result so far
+	usedTypeIDs := make(map[int64]bool)
+	var maxTypeID int64
+	for _, dt := range ours.AttributeTypes {
+		typeIDs[dt.Name] = dt.ID
+		usedTypeIDs[dt.ID] = true
+		typeIndexes[dt.Name] = len(result.AttributeTypes)
+		result.AttributeTypes = append(result.AttributeTypes, dt)
+		maxTypeID = max(maxTypeID, dt.ID)
+	}
+
+	baseTypes := make(map[string]DocumentAttributeType)
+	if base != nil {
+		for _, dt := range base.AttributeTypes {
+			baseTypes[dt.Name] = dt
+		}
+	}
+
+	// Types of theirs whose values are not merged
+	droppedTypes := make(map[string]bool)
+
+	for _, dt := range theirs.AttributeTypes {
+		i, ok := typeIndexes[dt.Name]
+		if !ok {
+			id := dt.ID
+			if usedTypeIDs[id] {
+				id = maxTypeID + 1
+			}
+			usedTypeIDs[id] = true
+			maxTypeID = max(maxTypeID, id)
+
+			typeIDs[dt.Name] = id
+			typeIndexes[dt.Name] = len(result.AttributeTypes)
+			result.AttributeTypes = append(result.AttributeTypes, DocumentAttributeType{ID: id, Name: dt.Name, Datatype: dt.Datatype, Key: dt.Key})
+			continue
+		}
+
+		rt := &result.AttributeTypes[i]
+		if rt.Datatype != dt.Datatype {
+			mg.drop("values of attribute type %q, it is %s in ours and %s in theirs", dt.Name, rt.Datatype, dt.Datatype)
+			droppedTypes[dt.Name] = true
+			continue
+		}
+
+		// Without a base a key is kept when it was set in either
+		bt, inBase := baseTypes[dt.Name]
+		if inBase && bt.Key == rt.Key {
+			rt.Key = dt.Key
+		} else if !inBase {
+			rt.Key = rt.Key || dt.Key
+		}
+	}
+	slices.SortFunc(result.AttributeTypes, func(a, b DocumentAttributeType) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	// Attribute IDs of ours are kept, the ones of theirs when not in use
+	usedAttributeIDs := make(map[int64]bool)
+	for _, de := range ours.Entities {
+		for _, da := range de.Attributes {
+			usedAttributeIDs[da.ID] = true
+		}
+	}
+
+	// Attributes of theirs with the type IDs of the result
+	theirsAttributes := func(attributes []DocumentAttribute, freed []DocumentAttribute) []DocumentAttribute {
+		var converted []DocumentAttribute
+		for _, da := range attributes {
+			name := theirsNames[da.Type]
+			if droppedTypes[name] {
+				continue
+			}
+
+			da.Type = typeIDs[name]
+			isFreed := slices.ContainsFunc(freed, func(freed DocumentAttribute) bool {
+				return freed.ID == da.ID
+			})
+			if usedAttributeIDs[da.ID] && !isFreed {
+				da.ID = 0
+			}
+			converted = append(converted, da)
+		}
+		return converted
+	}
+
+	oursEntities := entitiesByID(&ours)
+	theirsEntities := entitiesByID(&theirs)
+	baseEntities := entitiesByID(base)
+
+	for _, id := range unionIDs(oursEntities, theirsEntities) {
+		o, t, b := oursEntities[id], theirsEntities[id], baseEntities[id]
+
+		switch {
+		case t == nil:
+			// Added in ours, or deleted in theirs
+			if b != nil && (entitiesEqual(o, oursNames, b, baseNames) || !mg.keepEdited("entity "+strconv.Quote(o.Name), false)) {
+				continue
+			}
+			result.Entities = append(result.Entities, *o)
+			continue
+
+		case o == nil:
+			// Added in theirs, or deleted in ours
+			if b != nil && (entitiesEqual(t, theirsNames, b, baseNames) || !mg.keepEdited("entity "+strconv.Quote(t.Name), true)) {
+				continue
+			}
+			de := *t
+			de.Attributes = theirsAttributes(t.Attributes, nil)
+			if de.Attributes == nil {
+				de.Attributes = []DocumentAttribute{}
+			}
+			result.Entities = append(result.Entities, de)
+			continue
+		}
+
+		item := "entity " + strconv.Quote(o.Name)
+		oName, oPosition, oImage, oAttributes := entityValues(o, oursNames)
+		tName, tPosition, tImage, tAttributes := entityValues(t, theirsNames)
+
+		var bName, bPosition, bImage *mergeValue
+		var bAttributes attributeGroups
+		if b != nil {
+			name, position, image, attributes := entityValues(b, baseNames)
+			bName, bPosition, bImage, bAttributes = &name, &position, &image, attributes
+		}
+
+		de := *o
+		// Whether anything of theirs is taken over
+		changed := false
+		if mg.pick(item, "name", oName, tName, bName) {
+			de.Name = t.Name
+			changed = true
+		}
+		if mg.pick(item, "position", oPosition, tPosition, bPosition) {
+			de.X, de.Y = t.X, t.Y
+			changed = true
+		}
+		if mg.pick(item, "image", oImage, tImage, bImage) {
+			de.Images = t.Images
+			changed = true
+		}
+
+		order := oAttributes.order
+		for _, name := range tAttributes.order {
+			if !slices.Contains(order, name) {
+				order = append(order, name)
+			}
+		}
+
+		de.Attributes = []DocumentAttribute{}
+		for _, name := range order {
+			oursValues := oAttributes.byName[name]
+			if droppedTypes[name] {
+				de.Attributes = append(de.Attributes, oursValues...)
+				continue
+			}
+
+			var baseValue *mergeValue
+			if b != nil {
+				value := attributesValue(bAttributes.byName[name])
+				baseValue = &value
+			}
+
+			theirsValues := tAttributes.byName[name]
+			if mg.pick(item, "attribute "+strconv.Quote(name), attributesValue(oursValues), attributesValue(theirsValues), baseValue) {
+				de.Attributes = append(de.Attributes, theirsAttributes(theirsValues, oursValues)...)
+				changed = true
+			} else {
+				de.Attributes = append(de.Attributes, oursValues...)
+			}
+		}
+
+		if changed && t.UpdatedAt.After(de.UpdatedAt) {
+			de.UpdatedAt = t.UpdatedAt
+		}
+		result.Entities = append(result.Entities, de)
+	}
+
+	// Names to show connections with
+	entityNames := make(map[uuid.UUID]string)
+	for _, de := range result.Entities {
+		entityNames[de.ID] = de.Name
+	}
+	entityValue := func(id uuid.UUID) mergeValue {
+		name, ok := entityNames[id]
+		if !ok {
+			name = id.String()
+		}
+		return mergeValue{id.String(), strconv.Quote(name)}
+	}
+
+	oursConnections := connectionsByID(&ours)
+	theirsConnections := connectionsByID(&theirs)
+	baseConnections := connectionsByID(base)
+
+	for _, id := range unionIDs(oursConnections, theirsConnections) {
+		o, t, b := oursConnections[id], theirsConnections[id], baseConnections[id]
+
+		var dc DocumentConnection
+		switch {
+		case t == nil:
+			// Connections deleted along with an entity that is kept are kept
+			if b != nil && !withDeletedEntity(o, theirsEntities) && (connectionsEqual(o, b) || !mg.keepEdited("connection "+strconv.Quote(o.Name), false)) {
+				continue
+			}
+			dc = *o
+
+		case o == nil:
+			if b != nil && !withDeletedEntity(t, oursEntities) && (connectionsEqual(t, b) || !mg.keepEdited("connection "+strconv.Quote(t.Name), true)) {
+				continue
+			}
+			dc = *t
+
+		default:
+			item := "connection " + strconv.Quote(o.Name)
+			var bName, bSuperior, bInferior *mergeValue
+			if b != nil {
+				name, superior, inferior := mergeValue{b.Name, strconv.Quote(b.Name)}, entityValue(b.Superior), entityValue(b.Inferior)
+				bName, bSuperior, bInferior = &name, &superior, &inferior
+			}
+
+			dc = *o
+			changed := false
+			if mg.pick(item, "name", mergeValue{o.Name, strconv.Quote(o.Name)}, mergeValue{t.Name, strconv.Quote(t.Name)}, bName) {
+				dc.Name = t.Name
+				changed = true
+			}
+			if mg.pick(item, "superior", entityValue(o.Superior), entityValue(t.Superior), bSuperior) {
+				dc.Superior = t.Superior
+				changed = true
+			}
+			if mg.pick(item, "inferior", entityValue(o.Inferior), entityValue(t.Inferior), bInferior) {
+				dc.Inferior = t.Inferior
+				changed = true
+			}
+			if changed && t.UpdatedAt.After(dc.UpdatedAt) {
+				dc.UpdatedAt = t.UpdatedAt
+			}
+		}
+
+		_, superior := entityNames[dc.Superior]
+		_, inferior := entityNames[dc.Inferior]
+		if !superior || !inferior {
+			mg.drop("connection %q, an entity it connects was deleted", dc.Name)
+			continue
+		}
+		result.Connections = append(result.Connections, dc)
+	}
+
+	return result
+}
@@ -0,0 +1,110 @@
+package conatho
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func testDocument(types []DocumentAttributeType, entities ...DocumentEntity) Document {
+	if entities == nil {
+		entities = []DocumentEntity{}
+	}
+	return Document{
+		Format:         DocumentFormat,
+		Version:        DocumentVersion,
+		AttributeTypes: types,
+		Entities:       entities,
+		Connections:    []DocumentConnection{},
+	}
+}
+
+func stringAttribute(id, typeID int64, value string) DocumentAttribute {
+	return DocumentAttribute{ID: id, Type: typeID, String: &value}
+}
+
+func TestMergeDocumentsNewTypeIDs(t *testing.T) {
+	ours := testDocument([]DocumentAttributeType{
+		{ID: 1, Name: "A", Datatype: DatatypeString},
+		{ID: 2, Name: "B", Datatype: DatatypeString},
+	})
+
+	entity := DocumentEntity{
+		ID:   uuid.New(),
+		Name: "Entity",
+		Attributes: []DocumentAttribute{
+			stringAttribute(1, 2, "x"),
+			stringAttribute(2, 3, "y"),
+		},
+	}
+	theirs := testDocument([]DocumentAttributeType{
+		{ID: 2, Name: "X", Datatype: DatatypeString},
+		{ID: 3, Name: "Y", Datatype: DatatypeNumber},
+	}, entity)
+
+	m := MergeDocuments(nil, ours, theirs)
+	if len(m.Conflicts) != 0 {
+		t.Fatalf("conflicts: %v", m.Conflicts)
+	}
+	doc := m.Document()
+
+	names := make(map[int64]string)
+	for _, dt := range doc.AttributeTypes {
+		if other, ok := names[dt.ID]; ok {
+			t.Fatalf("types %q and %q both have ID %d", other, dt.Name, dt.ID)
+		}
+		names[dt.ID] = dt.Name
+	}
+	if len(names) != 4 {
+		t.Fatalf("got %d attribute types, want 4", len(names))
+	}
+
+	if len(doc.Entities) != 1 {
+		t.Fatalf("got %d entities, want 1", len(doc.Entities))
+	}
+	values := make(map[string]string)
+	for _, da := range doc.Entities[0].Attributes {
+		values[names[da.Type]] = *da.String
+	}
+	if values["X"] != "x" || values["Y"] != "y" {
+		t.Errorf("values by type: %v", values)
+	}
+}
+
+func TestMergeDocumentsChanges(t *testing.T) {
+	id := uuid.New()
+	base := testDocument([]DocumentAttributeType{}, DocumentEntity{ID: id, Name: "Old", Attributes: []DocumentAttribute{}})
+	ours := testDocument([]DocumentAttributeType{}, DocumentEntity{ID: id, Name: "New", Attributes: []DocumentAttribute{}})
+	theirs := testDocument([]DocumentAttributeType{}, DocumentEntity{ID: id, Name: "Old", X: 10, Y: 20, Attributes: []DocumentAttribute{}})
+
+	m := MergeDocuments(&base, ours, theirs)
+	if len(m.Conflicts) != 0 {
+		t.Fatalf("conflicts: %v", m.Conflicts)
+	}
+
+	de := m.Document().Entities[0]
+	if de.Name != "New" || de.X != 10 || de.Y != 20 {
+		t.Errorf("got %q at %d,%d, want \"New\" at 10,20", de.Name, de.X, de.Y)
+	}
+}
+
+func TestMergeDocumentsConflict(t *testing.T) {
+	id := uuid.New()
+	base := testDocument([]DocumentAttributeType{}, DocumentEntity{ID: id, Name: "Old", Attributes: []DocumentAttribute{}})
+	ours := testDocument([]DocumentAttributeType{}, DocumentEntity{ID: id, Name: "Ours", Attributes: []DocumentAttribute{}})
+	theirs := testDocument([]DocumentAttributeType{}, DocumentEntity{ID: id, Name: "Theirs", Attributes: []DocumentAttribute{}})
+
+	m := MergeDocuments(&base, ours, theirs)
+	if len(m.Conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1", len(m.Conflicts))
+	}
+
+	if name := m.Document().Entities[0].Name; name != "Ours" {
+		t.Errorf("got %q by default, want \"Ours\"", name)
+	}
+
+	m.Conflicts[0].Resolution = TakeTheirs
+	if name := m.Document().Entities[0].Name; name != "Theirs" {
+		t.Errorf("got %q when taking theirs, want \"Theirs\"", name)
+	}
+}
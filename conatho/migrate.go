@@ -0,0 +1,288 @@
+package conatho
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"image"
+
+	"github.com/xfmoulet/qoi"
+)
+
+var ErrNewerVersion = errors.New("file was created by a newer version")
+
+type migration func(tx *sql.Tx) error
+
+// Each migration upgrades a file from the version at its index to the next
+// version. New migrations should only ever be appended.
+var migrations = []migration{
+	// 0 -> 1: View state and bookmarks
+	execMigration(`
+		CREATE TABLE "view_state" (
+			"id"		INTEGER PRIMARY KEY CHECK ("id" = 0),
+			"posx"		BIGINT NOT NULL DEFAULT 0,
+			"posy"		BIGINT NOT NULL DEFAULT 0,
+			"zoom"		REAL NOT NULL DEFAULT 1,
+			"selected"	BLOB,
+			"panel"		TEXT NOT NULL DEFAULT ""
+		);
+		CREATE TABLE "bookmarks" (
+			"id"	INTEGER PRIMARY KEY AUTOINCREMENT,
+			"name"	TEXT NOT NULL UNIQUE,
+			"posx"	BIGINT NOT NULL,
+			"posy"	BIGINT NOT NULL,
+			"zoom"	REAL NOT NULL DEFAULT 1
+		);
+	`),
+	// 1 -> 2: Attribute types marked as unique external key
+	execMigration(`
+		ALTER TABLE "attribute_types" ADD COLUMN "unique_key" BOOLEAN NOT NULL DEFAULT 0;
+	`),
+	// 2 -> 3: Snapshots, their images and data are stored once in snapshot_blobs
+	execMigration(`
+		CREATE TABLE "snapshots" (
+			"id"		INTEGER PRIMARY KEY AUTOINCREMENT,
+			"name"		TEXT NOT NULL,
+			"created"	BIGINT NOT NULL,
+			"document"	BLOB NOT NULL
+		);
+		CREATE TABLE "snapshot_blobs" (
+			"hash"	TEXT PRIMARY KEY,
+			"data"	BLOB NOT NULL
+		);
+		CREATE TABLE "snapshot_blob_refs" (
+			"snapshot"	INTEGER NOT NULL,
+			"hash"		TEXT NOT NULL,
+			PRIMARY KEY("snapshot", "hash"),
+			FOREIGN KEY("snapshot") REFERENCES "snapshots"("id"),
+			FOREIGN KEY("hash") REFERENCES "snapshot_blobs"("hash")
+		);
+	`),
+	// 3 -> 4: Trash, deleted_with is the entity a connection was deleted with
+	execMigration(`
+		ALTER TABLE "entities" ADD COLUMN "deleted_at" BIGINT;
+		ALTER TABLE "connections" ADD COLUMN "deleted_at" BIGINT;
+		ALTER TABLE "connections" ADD COLUMN "deleted_with" BLOB;
+	`),
+	// 4 -> 5: Audit trail of all changes
+	execMigration(`
+		CREATE TABLE "audit" (
+			"id"		INTEGER PRIMARY KEY AUTOINCREMENT,
+			"time"		BIGINT NOT NULL,
+			"author"	TEXT NOT NULL,
+			"operation"	TEXT NOT NULL,
+			"entity"	BLOB,
+			"related"	BLOB,
+			"field"		TEXT NOT NULL DEFAULT "",
+			"old"		TEXT NOT NULL DEFAULT "",
+			"new"		TEXT NOT NULL DEFAULT ""
+		);
+		CREATE INDEX "audit_entity" ON "audit" ("entity");
+		CREATE INDEX "audit_related" ON "audit" ("related");
+	`),
+	// 5 -> 6: Creation and modification times, 0 for existing rows
+	execMigration(`
+		ALTER TABLE "entities" ADD COLUMN "created_at" BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE "entities" ADD COLUMN "updated_at" BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE "connections" ADD COLUMN "created_at" BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE "connections" ADD COLUMN "updated_at" BIGINT NOT NULL DEFAULT 0;
+	`),
+	// 6 -> 7: Several images per entity, the existing image becomes the primary
+	// image shown on the card
+	execMigration(`
+		CREATE TABLE "entity_images" (
+			"id"			INTEGER PRIMARY KEY AUTOINCREMENT,
+			"entity"		BLOB NOT NULL,
+			"position"		INT NOT NULL,
+			"is_primary"	BOOLEAN NOT NULL DEFAULT 0,
+			"caption"		TEXT NOT NULL DEFAULT "",
+			"image"			BLOB NOT NULL,
+			"thumbnail"		BLOB NOT NULL
+		);
+		INSERT INTO "entity_images" ("entity", "position", "is_primary", "image", "thumbnail")
+			SELECT "id", 0, 1, "image", "thumbnail" FROM "images";
+		DROP TABLE "images";
+		ALTER TABLE "entity_images" RENAME TO "images";
+		CREATE INDEX "images_entity" ON "images" ("entity");
+	`),
+	// 7 -> 8: Images are stored in their original format, the existing images
+	// have been converted to QOI
+	migrateImageFormats,
+	// 8 -> 9: Image data is stored once in image_blobs, keyed by its SHA-256
+	// hash
+	migrateImageBlobs,
+	// 9 -> 10: Images can be turned, flipped and cropped without changing the
+	// original
+	execMigration(`
+		ALTER TABLE "images" ADD COLUMN "rotation" INT NOT NULL DEFAULT 0;
+		ALTER TABLE "images" ADD COLUMN "flip" BOOLEAN NOT NULL DEFAULT 0;
+		ALTER TABLE "images" ADD COLUMN "crop_x" INT NOT NULL DEFAULT 0;
+		ALTER TABLE "images" ADD COLUMN "crop_y" INT NOT NULL DEFAULT 0;
+		ALTER TABLE "images" ADD COLUMN "crop_width" INT NOT NULL DEFAULT 0;
+		ALTER TABLE "images" ADD COLUMN "crop_height" INT NOT NULL DEFAULT 0;
+	`),
+}
+
+func migrateImageFormats(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE "images" ADD COLUMN "mime_type" TEXT NOT NULL DEFAULT "image/qoi";
+		ALTER TABLE "images" ADD COLUMN "width" INT NOT NULL DEFAULT 0;
+		ALTER TABLE "images" ADD COLUMN "height" INT NOT NULL DEFAULT 0;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// The dimensions are in the header of the QOI images
+	type dimensions struct {
+		id     int64
+		config image.Config
+	}
+	var images []dimensions
+
+	rows, err := tx.Query(`SELECT "id", substr("image", 1, 14) FROM "images"`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d dimensions
+		var header []byte
+		err := rows.Scan(&d.id, &header)
+		if err != nil {
+			return err
+		}
+		d.config, err = qoi.DecodeConfig(bytes.NewReader(header))
+		if err != nil {
+			return err
+		}
+		images = append(images, d)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range images {
+		_, err := tx.Exec(`UPDATE "images" SET "width" = ?, "height" = ? WHERE "id" = ?`, d.config.Width, d.config.Height, d.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func migrateImageBlobs(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE "image_blobs" (
+			"hash"		TEXT PRIMARY KEY,
+			"data"		BLOB NOT NULL,
+			"mime_type"	TEXT NOT NULL,
+			"width"		INT NOT NULL,
+			"height"	INT NOT NULL,
+			"refs"		INT NOT NULL
+		);
+		ALTER TABLE "images" ADD COLUMN "hash" TEXT NOT NULL DEFAULT "";
+	`)
+	if err != nil {
+		return err
+	}
+
+	var ids []int64
+	rows, err := tx.Query(`SELECT "id" FROM "images"`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	// One image at a time, the images of a file may not fit in memory
+	for _, id := range ids {
+		var data []byte
+		row := tx.QueryRow(`SELECT "image" FROM "images" WHERE "id" = ?`, id)
+		if err := row.Scan(&data); err != nil {
+			return err
+		}
+		hash := blobHash(data)
+
+		_, err := tx.Exec(`
+			INSERT INTO "image_blobs" ("hash", "data", "mime_type", "width", "height", "refs")
+			SELECT ?, "image", "mime_type", "width", "height", 1 FROM "images" WHERE "id" = ?
+			ON CONFLICT ("hash") DO UPDATE SET "refs" = "refs" + 1`,
+			hash, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE "images" SET "hash" = ? WHERE "id" = ?`, hash, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		ALTER TABLE "images" DROP COLUMN "image";
+		ALTER TABLE "images" DROP COLUMN "mime_type";
+		ALTER TABLE "images" DROP COLUMN "width";
+		ALTER TABLE "images" DROP COLUMN "height";
+		CREATE INDEX "images_hash" ON "images" ("hash");
+	`)
+	return err
+}
+
+func execMigration(query string) migration {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// Bring the file up to the latest version
+func (c *Conatho) migrate() error {
+	var version int64
+	row := c.sql.QueryRow("SELECT version FROM info")
+	if err := row.Scan(&version); err != nil {
+		return err
+	}
+
+	if version > int64(len(migrations)) {
+		return ErrNewerVersion
+	}
+
+	for ; version < int64(len(migrations)); version++ {
+		tx, err := c.sql.Begin()
+		if err != nil {
+			return err
+		}
+
+		err = migrations[version](tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE info SET version = ?", version+1)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
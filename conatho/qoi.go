@@ -0,0 +1,93 @@
+package conatho
+
+import (
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// Encode the pixels of the image as QOI exactly as they are. qoi.Encode
+// premultiplies the colors of translucent pixels, so an image decoded from
+// QOI would not come back the same.
+func encodeQOI(img image.Image) []byte {
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		nrgba = image.NewNRGBA(img.Bounds())
+		draw.Draw(nrgba, nrgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+	bounds := nrgba.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	out := []byte("qoif")
+	out = binary.BigEndian.AppendUint32(out, uint32(width))
+	out = binary.BigEndian.AppendUint32(out, uint32(height))
+	// 4 channels, sRGB with linear alpha
+	out = append(out, 4, 0)
+
+	const (
+		opIndex = 0b00_000000
+		opDiff  = 0b01_000000
+		opLuma  = 0b10_000000
+		opRun   = 0b11_000000
+		opRGB   = 0b1111_1110
+		opRGBA  = 0b1111_1111
+	)
+
+	var index [64][4]byte
+	prev := [4]byte{0, 0, 0, 255}
+	run := 0
+
+	for y := range height {
+		row := nrgba.Pix[y*nrgba.Stride:]
+		for x := range width {
+			var px [4]byte
+			copy(px[:], row[x*4:x*4+4])
+
+			if px == prev {
+				run++
+				if run == 62 || (x == width-1 && y == height-1) {
+					out = append(out, opRun|byte(run-1))
+					run = 0
+				}
+				continue
+			}
+
+			if run > 0 {
+				out = append(out, opRun|byte(run-1))
+				run = 0
+			}
+
+			hash := (px[0]*3 + px[1]*5 + px[2]*7 + px[3]*11) % 64
+			if index[hash] == px {
+				out = append(out, opIndex|hash)
+				prev = px
+				continue
+			}
+			index[hash] = px
+
+			if px[3] != prev[3] {
+				out = append(out, opRGBA, px[0], px[1], px[2], px[3])
+				prev = px
+				continue
+			}
+
+			vr := int8(px[0] - prev[0])
+			vg := int8(px[1] - prev[1])
+			vb := int8(px[2] - prev[2])
+			vgr := vr - vg
+			vgb := vb - vg
+
+			switch {
+			case vr > -3 && vr < 2 && vg > -3 && vg < 2 && vb > -3 && vb < 2:
+				out = append(out, opDiff|byte(vr+2)<<4|byte(vg+2)<<2|byte(vb+2))
+			case vgr > -9 && vgr < 8 && vg > -33 && vg < 32 && vgb > -9 && vgb < 8:
+				out = append(out, opLuma|byte(vg+32), byte(vgr+8)<<4|byte(vgb+8))
+			default:
+				out = append(out, opRGB, px[0], px[1], px[2])
+			}
+			prev = px
+		}
+	}
+
+	return append(out, 0, 0, 0, 0, 0, 0, 0, 1)
+}
@@ -0,0 +1,236 @@
+package conatho
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrUnknownSnapshot = errors.New("unknown snapshot")
+
+// Snapshot is a named copy of the contents of the file at some point in time
+type Snapshot struct {
+	ID      int64
+	Name    string
+	Created time.Time
+}
+
+// CreateSnapshot stores the current contents of the file as a snapshot. The
+// document is stored as gzipped JSON, images and data are stored once for all
+// snapshots.
+func (c *Conatho) CreateSnapshot(name string) (int64, error) {
+	doc, err := c.Document()
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = c.Transaction(func() error {
+		var hashes []string
+		for _, f := range doc.Files() {
+			hash := blobHash(f.Data)
+			_, err := c.db().Exec("INSERT OR IGNORE INTO snapshot_blobs (hash, data) VALUES (?, ?)", hash, f.Data)
+			if err != nil {
+				return err
+			}
+			hashes = append(hashes, hash)
+			f.File = hash
+			f.Data = nil
+		}
+
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		err := writeDocument(zw, doc)
+		if err != nil {
+			return err
+		}
+		err = zw.Close()
+		if err != nil {
+			return err
+		}
+
+		row := c.db().QueryRow("INSERT INTO snapshots (name, created, document) VALUES (?, ?, ?) RETURNING id",
+			name, time.Now().Unix(), buf.Bytes())
+		err = row.Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		for _, hash := range hashes {
+			_, err := c.db().Exec("INSERT OR IGNORE INTO snapshot_blob_refs (snapshot, hash) VALUES (?, ?)", id, hash)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetSnapshots returns all snapshots, the newest first
+func (c *Conatho) GetSnapshots() ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+
+	rows, err := c.db().Query("SELECT id, name, created FROM snapshots ORDER BY created DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Snapshot
+		var created int64
+		err := rows.Scan(&s.ID, &s.Name, &created)
+		if err != nil {
+			return nil, err
+		}
+		s.Created = time.Unix(created, 0)
+
+		snapshots = append(snapshots, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// SnapshotDocument returns the contents of the file when the snapshot was
+// created
+func (c *Conatho) SnapshotDocument(id int64) (Document, error) {
+	var data []byte
+	row := c.db().QueryRow("SELECT document FROM snapshots WHERE id = ?", id)
+	err := row.Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Document{}, ErrUnknownSnapshot
+	} else if err != nil {
+		return Document{}, err
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return Document{}, err
+	}
+
+	doc, err := ReadDocument(zr)
+	if err != nil {
+		return doc, err
+	}
+
+	err = doc.Internalize(func(hash string) ([]byte, error) {
+		var data []byte
+		row := c.db().QueryRow("SELECT data FROM snapshot_blobs WHERE hash = ?", hash)
+		err := row.Scan(&data)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("snapshot %d is missing blob %s", id, hash)
+		}
+		return data, err
+	})
+	if err != nil {
+		return doc, err
+	}
+
+	return doc, nil
+}
+
+// RestoreSnapshot replaces the contents of the file with the snapshot, the
+// snapshot itself is kept
+func (c *Conatho) RestoreSnapshot(id int64) (ImportReport, error) {
+	doc, err := c.SnapshotDocument(id)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	name, err := c.snapshotName(id)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return c.replace(doc, AuditRestoreSnapshot, name)
+}
+
+// SnapshotToFile writes the snapshot to a new file at fPath and opens it, the
+// file must not exist yet or be empty
+func (c *Conatho) SnapshotToFile(id int64, fPath string) (*Conatho, error) {
+	if info, err := os.Stat(fPath); err == nil && info.Size() > 0 {
+		return nil, fmt.Errorf("file %q already exists", fPath)
+	}
+
+	doc, err := c.SnapshotDocument(id)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := c.snapshotName(id)
+	if err != nil {
+		return nil, err
+	}
+
+	branch, err := New(fPath)
+	if err != nil {
+		return nil, err
+	}
+	branch.Author = c.Author
+
+	// The history of the entities in the snapshot comes along
+	entities := make(map[uuid.UUID]bool)
+	for _, de := range doc.Entities {
+		entities[de.ID] = true
+	}
+	err = c.copyAudit(&branch, entities)
+	if err != nil {
+		branch.Close()
+		return nil, err
+	}
+
+	_, err = branch.replace(doc, AuditRestoreSnapshot, name)
+	if err != nil {
+		branch.Close()
+		return nil, err
+	}
+
+	return &branch, nil
+}
+
+func (c *Conatho) snapshotName(id int64) (string, error) {
+	var name string
+	row := c.db().QueryRow("SELECT name FROM snapshots WHERE id = ?", id)
+	err := row.Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrUnknownSnapshot
+	}
+	return name, err
+}
+
+// DeleteSnapshot removes the snapshot and the images and data no other
+// snapshot refers to
+func (c *Conatho) DeleteSnapshot(id int64) error {
+	return c.Transaction(func() error {
+		_, err := c.db().Exec("DELETE FROM snapshot_blob_refs WHERE snapshot = ?", id)
+		if err != nil {
+			return err
+		}
+
+		result, err := c.db().Exec("DELETE FROM snapshots WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return ErrUnknownSnapshot
+		}
+
+		_, err = c.db().Exec("DELETE FROM snapshot_blobs WHERE hash NOT IN (SELECT hash FROM snapshot_blob_refs)")
+		return err
+	})
+}
@@ -0,0 +1,535 @@
+package conatho
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// TextFormat is the first word of a text document, followed by its version
+const TextFormat = "conatho-text"
+
+// TextVersion is the version of the text format written by ExportText
+const TextVersion = 3
+
+var ErrUnknownText = errors.New("not a conatho text document")
+var ErrNewerText = errors.New("text document was created by a newer version")
+
+// TextBlobDir is the directory next to a text document its binary content is
+// stored in, graph.txt stores it in graph.blobs
+func TextBlobDir(fPath string) string {
+	return strings.TrimSuffix(fPath, filepath.Ext(fPath)) + ".blobs"
+}
+
+// Name of binary content stored in a blob directory
+func blobHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func isBlobHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Hash of the file, content read by ReadText is not loaded yet and is named
+// by its hash
+func (f *DocumentFile) hash() string {
+	if f.Data == nil && isBlobHash(f.File) {
+		return f.File
+	}
+	return blobHash(f.Data)
+}
+
+// WriteText writes the document in the text format. Every item is a block of
+// lines, binary content is referred to by the SHA-256 hash of its data.
+//
+//	conatho-text 3
+//
+//	type 1 string "Employee ID" key
+//
+//	entity 5f0c9a3e-8f57-4c1d-9d2b-6c1f4e0d8a11
+//		name "Alice"
+//		position 100 -20
+//		image image/jpeg sha256:<hash> primary rotate=90 crop=0,40,300,300 "Portrait"
+//		image image/qoi sha256:<hash>
+//		attribute 1 1 "E-1001"
+//
+//	connection 0e4b6d8c-1a2f-4f3e-8b7d-2c9e5a6f1b30
+//		superior 5f0c9a3e-8f57-4c1d-9d2b-6c1f4e0d8a11
+//		inferior 9a7d3c1b-2e4f-4a6b-8c0d-1e2f3a4b5c6d
+//		name "Manager of"
+func WriteText(w io.Writer, doc Document) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "%s %d\n", TextFormat, TextVersion)
+
+	if len(doc.AttributeTypes) > 0 {
+		fmt.Fprintln(bw)
+	}
+	for _, dt := range doc.AttributeTypes {
+		fmt.Fprintf(bw, "type %d %s %s", dt.ID, dt.Datatype, strconv.Quote(dt.Name))
+		if dt.Key {
+			fmt.Fprint(bw, " key")
+		}
+		fmt.Fprintln(bw)
+	}
+
+	for _, de := range doc.Entities {
+		fmt.Fprintf(bw, "\nentity %s\n", de.ID)
+		fmt.Fprintf(bw, "\tname %s\n", strconv.Quote(de.Name))
+		fmt.Fprintf(bw, "\tposition %d %d\n", de.X, de.Y)
+		for _, di := range de.Images {
+			fmt.Fprintf(bw, "\timage %s sha256:%s", di.MIMEType, di.hash())
+			if di.Primary {
+				fmt.Fprint(bw, " primary")
+			}
+			if di.Rotation != 0 {
+				fmt.Fprintf(bw, " rotate=%d", di.Rotation)
+			}
+			if di.Flip {
+				fmt.Fprint(bw, " flip")
+			}
+			if di.Crop != nil {
+				fmt.Fprintf(bw, " crop=%d,%d,%d,%d", di.Crop.X, di.Crop.Y, di.Crop.Width, di.Crop.Height)
+			}
+			if di.Caption != "" {
+				fmt.Fprintf(bw, " %s", strconv.Quote(di.Caption))
+			}
+			fmt.Fprintln(bw)
+		}
+
+		for _, da := range de.Attributes {
+			fmt.Fprintf(bw, "\tattribute %d %d", da.ID, da.Type)
+			switch {
+			case da.Number != nil:
+				fmt.Fprintf(bw, " %d", *da.Number)
+			case da.String != nil:
+				fmt.Fprintf(bw, " %s", strconv.Quote(*da.String))
+			case da.Data != nil:
+				fmt.Fprintf(bw, " sha256:%s", da.Data.hash())
+			}
+			fmt.Fprintln(bw)
+		}
+	}
+
+	for _, dc := range doc.Connections {
+		fmt.Fprintf(bw, "\nconnection %s\n", dc.ID)
+		fmt.Fprintf(bw, "\tsuperior %s\n", dc.Superior)
+		fmt.Fprintf(bw, "\tinferior %s\n", dc.Inferior)
+		fmt.Fprintf(bw, "\tname %s\n", strconv.Quote(dc.Name))
+	}
+
+	return bw.Flush()
+}
+
+// ExportText writes the file in the text format, binary content is stored in
+// blobDir named by its hash. Blobs no longer referred to are removed from
+// blobDir.
+func (c *Conatho) ExportText(w io.Writer, blobDir string) error {
+	doc, err := c.Document()
+	if err != nil {
+		return err
+	}
+
+	files := doc.Files()
+	if len(files) > 0 {
+		err = os.MkdirAll(blobDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, f := range files {
+		hash := blobHash(f.Data)
+		if used[hash] {
+			continue
+		}
+		used[hash] = true
+
+		fPath := filepath.Join(blobDir, hash)
+		if _, err := os.Stat(fPath); err == nil {
+			continue
+		}
+		err = os.WriteFile(fPath, f.Data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	blobs, err := os.ReadDir(blobDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, blob := range blobs {
+		if isBlobHash(blob.Name()) && !used[blob.Name()] {
+			err = os.Remove(filepath.Join(blobDir, blob.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return WriteText(w, doc)
+}
+
+// A word of a line, quoted words may contain spaces
+type textField struct {
+	text   string
+	quoted bool
+}
+
+func splitTextLine(line string) ([]textField, error) {
+	var fields []textField
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return fields, nil
+		}
+
+		if line[0] == '"' {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, errors.New("unterminated string")
+			}
+			text, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, textField{text: text, quoted: true})
+			line = line[len(quoted):]
+			continue
+		}
+
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		fields = append(fields, textField{text: line[:end]})
+		line = line[end:]
+	}
+}
+
+// Reference to binary content, the hash is kept as the file name
+func parseBlob(field textField) (*DocumentFile, error) {
+	hash, ok := strings.CutPrefix(field.text, "sha256:")
+	if field.quoted || !ok || !isBlobHash(hash) {
+		return nil, fmt.Errorf("invalid blob %q", field.text)
+	}
+	return &DocumentFile{File: hash}, nil
+}
+
+// Crop of an image as x,y,width,height
+func parseCrop(s string) (*DocumentCrop, error) {
+	values := strings.Split(s, ",")
+	if len(values) != 4 {
+		return nil, errors.New("crop needs x, y, width and height")
+	}
+
+	var numbers [4]int
+	for i, value := range values {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		numbers[i] = n
+	}
+	return &DocumentCrop{X: numbers[0], Y: numbers[1], Width: numbers[2], Height: numbers[3]}, nil
+}
+
+// ReadText reads a document in the text format. Binary content is not read,
+// the hashes are kept as the names of the files, see Internalize.
+func ReadText(r io.Reader) (Document, error) {
+	doc := Document{
+		Format:         DocumentFormat,
+		Version:        DocumentVersion,
+		AttributeTypes: []DocumentAttributeType{},
+		Entities:       []DocumentEntity{},
+		Connections:    []DocumentConnection{},
+	}
+
+	var entity *DocumentEntity
+	var connection *DocumentConnection
+	version := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields, err := splitTextLine(scanner.Text())
+		if err != nil {
+			return doc, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		if lineNumber == 1 {
+			if len(fields) != 2 || fields[0].text != TextFormat {
+				return doc, ErrUnknownText
+			}
+			version, err = strconv.Atoi(fields[1].text)
+			if err != nil {
+				return doc, ErrUnknownText
+			}
+			if version > TextVersion {
+				return doc, ErrNewerText
+			}
+			continue
+		}
+
+		err = readTextLine(&doc, &entity, &connection, fields)
+		if err != nil {
+			return doc, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return doc, err
+	}
+	if lineNumber == 0 {
+		return doc, ErrUnknownText
+	}
+
+	// Version 1 has at most one image per entity
+	if version < 2 {
+		for i := range doc.Entities {
+			if len(doc.Entities[i].Images) > 0 {
+				doc.Entities[i].Images[0].Primary = true
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+// Add a line to the document, entity and connection are the block the line
+// belongs to
+func readTextLine(doc *Document, entity **DocumentEntity, connection **DocumentConnection, fields []textField) error {
+	keyword := fields[0].text
+	args := fields[1:]
+
+	number := func(i int) (int64, error) {
+		if args[i].quoted {
+			return 0, fmt.Errorf("invalid number %q", args[i].text)
+		}
+		return strconv.ParseInt(args[i].text, 10, 64)
+	}
+	coordinate := func(i int) (int32, error) {
+		n, err := strconv.ParseInt(args[i].text, 10, 32)
+		return int32(n), err
+	}
+	argCount := func(least, most int) error {
+		if len(args) < least || len(args) > most {
+			return fmt.Errorf("wrong number of values for %s", keyword)
+		}
+		return nil
+	}
+
+	switch keyword {
+	case "type":
+		if err := argCount(3, 4); err != nil {
+			return err
+		}
+		*entity, *connection = nil, nil
+
+		id, err := number(0)
+		if err != nil {
+			return err
+		}
+		datatype, err := ParseDatatype(args[1].text)
+		if err != nil {
+			return err
+		}
+		dt := DocumentAttributeType{ID: id, Name: args[2].text, Datatype: datatype}
+		if len(args) == 4 {
+			if args[3].text != "key" {
+				return fmt.Errorf("unknown flag %q", args[3].text)
+			}
+			dt.Key = true
+		}
+		doc.AttributeTypes = append(doc.AttributeTypes, dt)
+
+	case "entity":
+		if err := argCount(1, 1); err != nil {
+			return err
+		}
+		id, err := uuid.Parse(args[0].text)
+		if err != nil {
+			return err
+		}
+		doc.Entities = append(doc.Entities, DocumentEntity{ID: id, Attributes: []DocumentAttribute{}})
+		*entity, *connection = &doc.Entities[len(doc.Entities)-1], nil
+
+	case "connection":
+		if err := argCount(1, 1); err != nil {
+			return err
+		}
+		id, err := uuid.Parse(args[0].text)
+		if err != nil {
+			return err
+		}
+		doc.Connections = append(doc.Connections, DocumentConnection{ID: id})
+		*entity, *connection = nil, &doc.Connections[len(doc.Connections)-1]
+
+	case "name":
+		if err := argCount(1, 1); err != nil {
+			return err
+		}
+		switch {
+		case *entity != nil:
+			(*entity).Name = args[0].text
+		case *connection != nil:
+			(*connection).Name = args[0].text
+		default:
+			return errors.New("name outside of an entity or connection")
+		}
+
+	case "position":
+		if err := argCount(2, 2); err != nil {
+			return err
+		}
+		if *entity == nil {
+			return errors.New("position outside of an entity")
+		}
+		x, err := coordinate(0)
+		if err != nil {
+			return err
+		}
+		y, err := coordinate(1)
+		if err != nil {
+			return err
+		}
+		(*entity).X, (*entity).Y = x, y
+
+	case "image":
+		if err := argCount(2, 7); err != nil {
+			return err
+		}
+		if *entity == nil {
+			return errors.New("image outside of an entity")
+		}
+		f, err := parseBlob(args[1])
+		if err != nil {
+			return err
+		}
+		f.MIMEType = args[0].text
+
+		di := DocumentImage{DocumentFile: *f}
+		for _, arg := range args[2:] {
+			switch {
+			case arg.quoted:
+				di.Caption = arg.text
+			case arg.text == "primary":
+				di.Primary = true
+			case arg.text == "flip":
+				di.Flip = true
+			case strings.HasPrefix(arg.text, "rotate="):
+				di.Rotation, err = strconv.Atoi(strings.TrimPrefix(arg.text, "rotate="))
+			case strings.HasPrefix(arg.text, "crop="):
+				di.Crop, err = parseCrop(strings.TrimPrefix(arg.text, "crop="))
+			default:
+				return fmt.Errorf("unknown flag %q", arg.text)
+			}
+			if err != nil {
+				return fmt.Errorf("invalid %q: %w", arg.text, err)
+			}
+		}
+		(*entity).Images = append((*entity).Images, di)
+
+	case "attribute":
+		if err := argCount(2, 3); err != nil {
+			return err
+		}
+		if *entity == nil {
+			return errors.New("attribute outside of an entity")
+		}
+		id, err := number(0)
+		if err != nil {
+			return err
+		}
+		typeID, err := number(1)
+		if err != nil {
+			return err
+		}
+
+		da := DocumentAttribute{ID: id, Type: typeID}
+		if len(args) == 3 {
+			value := args[2]
+			switch {
+			case value.quoted:
+				da.String = &value.text
+			case strings.HasPrefix(value.text, "sha256:"):
+				da.Data, err = parseBlob(value)
+			default:
+				var n int64
+				n, err = number(2)
+				da.Number = &n
+			}
+			if err != nil {
+				return err
+			}
+		}
+		(*entity).Attributes = append((*entity).Attributes, da)
+
+	case "superior", "inferior":
+		if err := argCount(1, 1); err != nil {
+			return err
+		}
+		if *connection == nil {
+			return fmt.Errorf("%s outside of a connection", keyword)
+		}
+		id, err := uuid.Parse(args[0].text)
+		if err != nil {
+			return err
+		}
+		if keyword == "superior" {
+			(*connection).Superior = id
+		} else {
+			(*connection).Inferior = id
+		}
+
+	default:
+		return fmt.Errorf("unknown keyword %q", keyword)
+	}
+
+	return nil
+}
+
+// ImportText adds the contents of a text document to the file, binary content
+// is read from blobDir
+func (c *Conatho) ImportText(r io.Reader, blobDir string) (ImportReport, error) {
+	doc, err := ReadText(r)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	err = doc.Internalize(func(hash string) ([]byte, error) {
+		data, err := os.ReadFile(filepath.Join(blobDir, hash))
+		if err != nil {
+			return nil, err
+		}
+		if blobHash(data) != hash {
+			return nil, fmt.Errorf("blob %s does not match its hash", hash)
+		}
+		return data, nil
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return c.ImportDocument(doc)
+}
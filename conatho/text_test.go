@@ -0,0 +1,150 @@
+package conatho
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		img.Set(x, 0, color.RGBA{R: uint8(x), A: 255})
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// A file using every part of the text format
+func testTextConatho(t *testing.T) *Conatho {
+	t.Helper()
+	c := testConatho(t)
+
+	number, _ := c.AddAttributeType("Number", DatatypeNumber)
+	text, _ := c.AddAttributeType("Employee ID", DatatypeString)
+	data, _ := c.AddAttributeType("Data", DatatypeData)
+	err := c.SetAttributeTypeKey(text, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := c.CreateEntity(100, -20, "Alice \"Al\"\tSmith")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := c.CreateEntity(-300, 400, "Bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := c.Entities[alice.ID], c.Entities[bob.ID]
+
+	err = a.EntityAddImage(bytes.NewReader(testPNG(t, 40, 20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageID, err := a.AddImage(bytes.NewReader(testPNG(t, 30, 30)), "Caption with \"quotes\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.SetImageEdit(imageID, ImageEdit{Rotation: 90, Flip: true, Crop: image.Rect(5, 5, 25, 25)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for typeID, value := range map[int64]any{
+		number: int64(-42),
+		text:   "E-1001\nsecond line",
+		data:   []byte{0, 1, 2},
+	} {
+		_, err := a.addAttributeValue(typeID, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Empty and unset values
+	_, err = b.addAttributeValue(data, []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.AddAttribute(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.ConnectTo(b, "Manager of")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.ConnectTo(a, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	c := testTextConatho(t)
+	blobDir := filepath.Join(t.TempDir(), "graph.blobs")
+
+	var first bytes.Buffer
+	err := c.ExportText(&first, blobDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading and writing the text without a file changes nothing
+	doc, err := ReadText(bytes.NewReader(first.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rewritten bytes.Buffer
+	err = WriteText(&rewritten, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewritten.String() != first.String() {
+		t.Errorf("rewritten text differs:\n%s\nwant:\n%s", rewritten.String(), first.String())
+	}
+
+	imported := testConatho(t)
+	report, err := imported.ImportText(bytes.NewReader(first.Bytes()), blobDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Dropped) > 0 {
+		t.Errorf("dropped %q", report.Dropped)
+	}
+
+	var second bytes.Buffer
+	err = imported.ExportText(&second, blobDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.String() != first.String() {
+		t.Errorf("text after import differs:\n%s\nwant:\n%s", second.String(), first.String())
+	}
+
+	for _, want := range []string{
+		"\ntype 2 string \"Employee ID\" key\n",
+		" primary\n",
+		" rotate=90 flip crop=5,5,20,20 \"Caption with \\\"quotes\\\"\"\n",
+		"\tname \"Alice \\\"Al\\\"\\tSmith\"\n",
+		" \"E-1001\\nsecond line\"\n",
+		" sha256:" + blobHash([]byte{}) + "\n",
+	} {
+		if !strings.Contains(first.String(), want) {
+			t.Errorf("no %q in:\n%s", want, first.String())
+		}
+	}
+}
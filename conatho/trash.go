@@ -0,0 +1,329 @@
+package conatho
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrNotInTrash = errors.New("not in the trash")
+var ErrEntityInTrash = errors.New("connected entity is in the trash")
+
+type TrashedEntity struct {
+	ID        uuid.UUID
+	Name      string
+	DeletedAt time.Time
+}
+
+// TrashedConnection is a connection that was removed by itself, connections
+// deleted along with an entity are restored with it
+type TrashedConnection struct {
+	ID           uuid.UUID
+	Name         string
+	Superior     uuid.UUID
+	Inferior     uuid.UUID
+	SuperiorName string
+	InferiorName string
+	DeletedAt    time.Time
+}
+
+// Trash holds the deleted entities and connections, the most recently deleted
+// first
+type Trash struct {
+	Entities    []TrashedEntity
+	Connections []TrashedConnection
+}
+
+func (t Trash) Empty() bool {
+	return len(t.Entities) == 0 && len(t.Connections) == 0
+}
+
+func (c *Conatho) GetTrash() (Trash, error) {
+	var trash Trash
+
+	rows, err := c.db().Query(`
+		SELECT id, name, deleted_at
+		FROM entities
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, name`)
+	if err != nil {
+		return trash, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var te TrashedEntity
+		var deletedAt int64
+		err := rows.Scan(&te.ID, &te.Name, &deletedAt)
+		if err != nil {
+			return trash, err
+		}
+		te.DeletedAt = time.Unix(deletedAt, 0)
+
+		trash.Entities = append(trash.Entities, te)
+	}
+	if err = rows.Err(); err != nil {
+		return trash, err
+	}
+
+	rows, err = c.db().Query(`
+		SELECT connections.id, connections.name, superior, inferior,
+			COALESCE(s.name, ''), COALESCE(i.name, ''), connections.deleted_at
+		FROM connections
+		LEFT JOIN entities s ON s.id = superior
+		LEFT JOIN entities i ON i.id = inferior
+		WHERE connections.deleted_at IS NOT NULL AND deleted_with IS NULL
+		ORDER BY connections.deleted_at DESC`)
+	if err != nil {
+		return trash, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tc TrashedConnection
+		var deletedAt int64
+		err := rows.Scan(&tc.ID, &tc.Name, &tc.Superior, &tc.Inferior, &tc.SuperiorName, &tc.InferiorName, &deletedAt)
+		if err != nil {
+			return trash, err
+		}
+		tc.DeletedAt = time.Unix(deletedAt, 0)
+
+		trash.Connections = append(trash.Connections, tc)
+	}
+	if err = rows.Err(); err != nil {
+		return trash, err
+	}
+
+	return trash, nil
+}
+
+// RestoreEntity takes the entity out of the trash. The connections deleted
+// along with it come back as soon as the entities on both ends are restored.
+// All entities are loaded again.
+func (c *Conatho) RestoreEntity(id uuid.UUID) error {
+	bid, err := id.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return c.Transaction(func() error {
+		now := time.Now().Unix()
+		result, err := c.db().Exec("UPDATE entities SET deleted_at = NULL, updated_at = ? WHERE id = ? AND deleted_at IS NOT NULL", now, bid)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return ErrNotInTrash
+		}
+
+		_, err = c.db().Exec(`
+			UPDATE connections SET deleted_at = NULL, deleted_with = NULL, updated_at = ?
+			WHERE (superior = ? OR inferior = ?) AND deleted_with IS NOT NULL
+				AND superior IN (SELECT id FROM entities WHERE deleted_at IS NULL)
+				AND inferior IN (SELECT id FROM entities WHERE deleted_at IS NULL)`,
+			now, bid, bid)
+		if err != nil {
+			return err
+		}
+
+		err = c.EntityGetAll()
+		if err != nil {
+			return err
+		}
+
+		return c.audit(AuditRestore, id, uuid.Nil, "", "", strconv.Quote(c.Entities[id].Name))
+	})
+}
+
+// RestoreConnection takes a connection out of the trash, the entities it
+// connects must not be in the trash
+func (c *Conatho) RestoreConnection(id uuid.UUID) error {
+	bid, err := id.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	connection := Connection{ID: id}
+	var createdAt int64
+	row := c.db().QueryRow("SELECT superior, inferior, name, created_at FROM connections WHERE id = ? AND deleted_at IS NOT NULL", bid)
+	err = row.Scan(&connection.Superior, &connection.Inferior, &connection.Name, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotInTrash
+	} else if err != nil {
+		return err
+	}
+
+	connection.CreatedAt = unixTime(createdAt)
+
+	superior, ok := c.Entities[connection.Superior]
+	if !ok {
+		return ErrEntityInTrash
+	}
+	inferior, ok := c.Entities[connection.Inferior]
+	if !ok {
+		return ErrEntityInTrash
+	}
+
+	err = c.Transaction(func() error {
+		now := time.Now().Unix()
+		_, err := c.db().Exec("UPDATE connections SET deleted_at = NULL, deleted_with = NULL, updated_at = ? WHERE id = ?", now, bid)
+		if err != nil {
+			return err
+		}
+		connection.UpdatedAt = unixTime(now)
+
+		return c.audit(AuditRestore, connection.Superior, connection.Inferior, connection.Name, "", c.auditConnection(&connection))
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Connections[connection.ID] = &connection
+	c.ConnectionsKeys = append(c.ConnectionsKeys, connection.ID)
+	superior.Connections = append(superior.Connections, connection.ID)
+	inferior.Connections = append(inferior.Connections, connection.ID)
+
+	return nil
+}
+
+// PurgeTrash permanently deletes what was moved to the trash before the given
+// time and returns the number of entities and connections deleted
+func (c *Conatho) PurgeTrash(before time.Time) (int64, error) {
+	return c.purgeTrash(before.Unix())
+}
+
+// EmptyTrash permanently deletes everything in the trash
+func (c *Conatho) EmptyTrash() (int64, error) {
+	return c.purgeTrash(math.MaxInt64)
+}
+
+func (c *Conatho) purgeTrash(before int64) (int64, error) {
+	var n int64
+	err := c.Transaction(func() error {
+		entities, err := c.purgeEntities("deleted_at < ?", before)
+		if err != nil {
+			return err
+		}
+
+		// Connections deleted with an entity are only purged with the entity
+		connections, err := c.purgeConnections("deleted_with IS NULL AND deleted_at < ?", before)
+		if err != nil {
+			return err
+		}
+
+		n = entities + connections
+		return nil
+	})
+	return n, err
+}
+
+// Permanently delete the trashed entities matching the condition, along with
+// their attributes, images and connections
+func (c *Conatho) purgeEntities(condition string, args ...any) (int64, error) {
+	trashed := "SELECT id FROM entities WHERE deleted_at IS NOT NULL AND " + condition
+
+	err := c.auditPurged(`
+		SELECT id, NULL, '', name, ''
+		FROM entities WHERE deleted_at IS NOT NULL AND `+condition, args...)
+	if err != nil {
+		return 0, err
+	}
+	err = c.auditPurged(connectionsPurged+"superior IN ("+trashed+") OR inferior IN ("+trashed+")",
+		slices.Concat(args, args)...)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = c.db().Exec("DELETE FROM attributes WHERE entity IN ("+trashed+")", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	err = c.deleteImages("entity IN ("+trashed+")", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = c.db().Exec("DELETE FROM connections WHERE superior IN ("+trashed+") OR inferior IN ("+trashed+")",
+		slices.Concat(args, args)...)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := c.db().Exec("DELETE FROM entities WHERE deleted_at IS NOT NULL AND "+condition, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Permanently delete the trashed connections matching the condition
+func (c *Conatho) purgeConnections(condition string, args ...any) (int64, error) {
+	err := c.auditPurged(connectionsPurged+"deleted_at IS NOT NULL AND "+condition, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := c.db().Exec("DELETE FROM connections WHERE deleted_at IS NOT NULL AND "+condition, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// The connections to purge with the names of the entities they connect, for
+// the audit trail
+const connectionsPurged = `
+	SELECT superior, inferior, name,
+		COALESCE((SELECT name FROM entities WHERE id = superior), ''),
+		COALESCE((SELECT name FROM entities WHERE id = inferior), '')
+	FROM connections WHERE `
+
+// Record the items the query selects as purged. The query selects the entity,
+// the related entity, the field and the names of both entities.
+func (c *Conatho) auditPurged(query string, args ...any) error {
+	type purged struct {
+		entity, related []byte
+		field           string
+		from, to        string
+	}
+	var items []purged
+
+	rows, err := c.db().Query(query, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var p purged
+		err := rows.Scan(&p.entity, &p.related, &p.field, &p.from, &p.to)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range items {
+		entity, _ := uuid.FromBytes(p.entity)
+		related, _ := uuid.FromBytes(p.related)
+
+		old := strconv.Quote(p.from)
+		if related != uuid.Nil {
+			old = auditConnectionEnds(p.from, p.to)
+		}
+		err := c.audit(AuditPurge, entity, related, p.field, old, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package conatho
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Entities named by their name, connected by connections named after both
+func testConnected(t *testing.T, c *Conatho, names ...string) map[string]*Entity {
+	t.Helper()
+	entities := make(map[string]*Entity)
+	for i, name := range names {
+		created, err := c.CreateEntity(int32(i)*200, 0, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entities[name] = c.Entities[created.ID]
+	}
+	for i := 1; i < len(names); i++ {
+		err := entities[names[i-1]].ConnectTo(entities[names[i]], names[i-1]+names[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return entities
+}
+
+func connectionByName(t *testing.T, c *Conatho, name string) *Connection {
+	t.Helper()
+	for _, connection := range c.Connections {
+		if connection.Name == name {
+			return connection
+		}
+	}
+	t.Fatalf("no connection named %q", name)
+	return nil
+}
+
+func TestImportRestoresTrashedEntity(t *testing.T) {
+	c := testConatho(t)
+	entities := testConnected(t, c, "A", "B")
+	a := entities["A"]
+	connection := connectionByName(t, c, "AB")
+
+	typeID, _ := c.AddAttributeType("Old", DatatypeString)
+	_, err := a.addAttributeValue(typeID, "old value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Delete()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := testDocument([]DocumentAttributeType{}, DocumentEntity{ID: a.ID, Name: "A again", X: 5, Y: 6, Attributes: []DocumentAttribute{}})
+	report, err := c.ImportDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Restored != 1 || report.Entities != 0 || len(report.Dropped) > 0 {
+		t.Errorf("report:\n%s", report)
+	}
+	if want := []ImportItem{{ImportRestored, `entity "A again"`}}; !slices.Equal(report.Items, want) {
+		t.Errorf("items %v, want %v", report.Items, want)
+	}
+
+	restored := c.Entities[a.ID]
+	if restored == nil || restored.Name != "A again" || restored.X != 5 || restored.Y != 6 {
+		t.Fatalf("entity not restored with the imported contents: %+v", restored)
+	}
+	if values := attributeValues(t, restored); len(values) != 0 {
+		t.Errorf("attributes from before the trash are kept: %v", values)
+	}
+
+	// The history from before the trash is kept
+	history, err := restored.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var operations []AuditOperation
+	for _, entry := range history {
+		if entry.Entity == a.ID && entry.Related == uuid.Nil {
+			operations = append(operations, entry.Operation)
+		}
+	}
+	if !slices.Contains(operations, AuditCreate) || operations[0] != AuditRestore {
+		t.Errorf("history %v", operations)
+	}
+
+	// The connection deleted along with it can be restored by itself
+	trash, err := c.GetTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash.Entities) != 0 || len(trash.Connections) != 1 || trash.Connections[0].ID != connection.ID {
+		t.Fatalf("trash %+v", trash)
+	}
+	err = c.RestoreConnection(connection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportRestoresTrashedConnection(t *testing.T) {
+	c := testConatho(t)
+	entities := testConnected(t, c, "A", "B", "C")
+	connection := connectionByName(t, c, "AB")
+	err := c.RemoveConnection(connection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same ID now connects other entities
+	doc := testDocument([]DocumentAttributeType{})
+	doc.Connections = []DocumentConnection{{ID: connection.ID, Superior: entities["C"].ID, Inferior: entities["A"].ID, Name: "CA"}}
+	report, err := c.ImportDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Restored != 1 || report.Connections != 0 {
+		t.Errorf("report:\n%s", report)
+	}
+
+	restored := c.Connections[connection.ID]
+	if restored == nil || restored.Name != "CA" || restored.Superior != entities["C"].ID || restored.Inferior != entities["A"].ID {
+		t.Fatalf("connection not restored with the imported contents: %+v", restored)
+	}
+	if !slices.Contains(entities["C"].Connections, connection.ID) || slices.Contains(entities["B"].Connections, connection.ID) {
+		t.Error("connection not moved to the imported entities")
+	}
+
+	trash, err := c.GetTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !trash.Empty() {
+		t.Errorf("trash %+v", trash)
+	}
+}
+
+func TestReplaceTrashedConnections(t *testing.T) {
+	c := testConatho(t)
+	entities := testConnected(t, c, "A", "B", "C")
+	for _, name := range []string{"AB", "BC"} {
+		err := c.RemoveConnection(connectionByName(t, c, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// C is gone after replacing the contents
+	doc := testDocument([]DocumentAttributeType{},
+		DocumentEntity{ID: entities["A"].ID, Name: "A", Attributes: []DocumentAttribute{}},
+		DocumentEntity{ID: entities["B"].ID, Name: "B", Attributes: []DocumentAttribute{}},
+	)
+	_, err := c.Replace(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trash, err := c.GetTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tc := range trash.Connections {
+		names = append(names, tc.Name)
+	}
+	if !slices.Equal(names, []string{"AB"}) {
+		t.Fatalf("trashed connections %q, want [\"AB\"]", names)
+	}
+
+	err = c.RestoreConnection(trash.Connections[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
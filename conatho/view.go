@@ -0,0 +1,119 @@
+package conatho
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ViewState is how the file was last being looked at
+type ViewState struct {
+	X        int32     `json:"x"`
+	Y        int32     `json:"y"`
+	Zoom     float32   `json:"zoom"`
+	Selected uuid.UUID `json:"selected"`
+	Panel    string    `json:"panel"`
+}
+
+type Bookmark struct {
+	ID   int64   `json:"-"`
+	Name string  `json:"name"`
+	X    int32   `json:"x"`
+	Y    int32   `json:"y"`
+	Zoom float32 `json:"zoom"`
+}
+
+func (c *Conatho) GetViewState() (ViewState, error) {
+	v := ViewState{Zoom: 1}
+
+	var selected []byte
+	row := c.db().QueryRow("SELECT posx, posy, zoom, selected, panel FROM view_state WHERE id = 0")
+	err := row.Scan(&v.X, &v.Y, &v.Zoom, &selected, &v.Panel)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, nil
+	} else if err != nil {
+		return v, err
+	}
+
+	if selected != nil {
+		err = v.Selected.UnmarshalBinary(selected)
+		if err != nil {
+			return v, err
+		}
+	}
+
+	return v, nil
+}
+
+func (c *Conatho) SaveViewState(v ViewState) error {
+	var selected []byte
+	if v.Selected != uuid.Nil {
+		var err error
+		selected, err = v.Selected.MarshalBinary()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := c.db().Exec(`
+		INSERT OR REPLACE INTO view_state (id, posx, posy, zoom, selected, panel)
+		VALUES (0, ?, ?, ?, ?, ?)`, v.X, v.Y, v.Zoom, selected, v.Panel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Conatho) GetBookmarks() ([]Bookmark, error) {
+	bookmarks := []Bookmark{}
+
+	rows, err := c.db().Query(`
+		SELECT id, name, posx, posy, zoom
+		FROM bookmarks
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b Bookmark
+		err := rows.Scan(&b.ID, &b.Name, &b.X, &b.Y, &b.Zoom)
+		if err != nil {
+			return nil, err
+		}
+
+		bookmarks = append(bookmarks, b)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return bookmarks, nil
+}
+
+// AddBookmark stores a bookmark, a bookmark with the same name is replaced
+func (c *Conatho) AddBookmark(name string, x, y int32, zoom float32) (int64, error) {
+	var id int64
+
+	row := c.db().QueryRow(`
+		INSERT INTO bookmarks (name, posx, posy, zoom) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET posx = excluded.posx, posy = excluded.posy, zoom = excluded.zoom
+		RETURNING id`, name, x, y, zoom)
+	err := row.Scan(&id)
+	if err != nil {
+		return id, err
+	}
+
+	return id, nil
+}
+
+func (c *Conatho) RemoveBookmark(id int64) error {
+	_, err := c.db().Exec("DELETE FROM bookmarks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+)
+
+// MaxRecentFiles is the number of recently opened files that are remembered
+const MaxRecentFiles = 10
+
+type Config struct {
+	RecentFiles []string `json:"recent_files"`
+	// Days deleted entities and connections are kept in the trash, 0 keeps
+	// them until the trash is emptied
+	TrashRetentionDays int `json:"trash_retention_days,omitempty"`
+	// Name recorded with every change made to a file
+	Author string `json:"author,omitempty"`
+	// Show a marker on cards that were changed recently
+	MarkRecentChanges bool `json:"mark_recent_changes,omitempty"`
+	// Width and height of thumbnails in pixels, 0 derives it from the size of
+	// the cards and the display scale
+	ThumbnailSize int `json:"thumbnail_size,omitempty"`
+
+	path string
+}
+
+// Path returns the location of the user config, which follows the XDG base
+// directory spec on Linux ($XDG_CONFIG_HOME/connect-a-thon/config.json)
+func Path() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "connect-a-thon", "config.json"), nil
+}
+
+// Load reads the user config, a missing file results in an empty config
+func Load() (Config, error) {
+	var cfg Config
+
+	path, err := Path()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, err
+	}
+
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func (cfg *Config) Save() error {
+	if cfg.path == "" {
+		path, err := Path()
+		if err != nil {
+			return err
+		}
+		cfg.path = path
+	}
+
+	err := os.MkdirAll(filepath.Dir(cfg.path), 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(cfg.path, data, 0644)
+}
+
+// AddRecentFile moves the file to the front of the recent files list
+func (cfg *Config) AddRecentFile(fPath string) {
+	absPath, err := filepath.Abs(fPath)
+	if err == nil {
+		fPath = absPath
+	}
+
+	i := slices.Index(cfg.RecentFiles, fPath)
+	if i >= 0 {
+		cfg.RecentFiles = slices.Delete(cfg.RecentFiles, i, i+1)
+	}
+
+	cfg.RecentFiles = slices.Insert(cfg.RecentFiles, 0, fPath)
+	if len(cfg.RecentFiles) > MaxRecentFiles {
+		cfg.RecentFiles = cfg.RecentFiles[:MaxRecentFiles]
+	}
+}
+
+// LastFile returns the most recently opened file if it still exists
+func (cfg *Config) LastFile() (string, bool) {
+	if len(cfg.RecentFiles) == 0 {
+		return "", false
+	}
+
+	_, err := os.Stat(cfg.RecentFiles[0])
+	if err != nil {
+		return "", false
+	}
+
+	return cfg.RecentFiles[0], true
+}
+
+// AuthorName returns the configured author, or the name of the user account
+// when none is set
+func (cfg *Config) AuthorName() string {
+	if cfg.Author != "" {
+		return cfg.Author
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.Username
+}
@@ -0,0 +1,80 @@
+// Package layout describes how entities are drawn on the canvas. It does not
+// depend on SDL so exporters can draw the canvas without a window.
+package layout
+
+import (
+	_ "embed"
+	"image"
+)
+
+// FontSize is the size of the font used for names on the canvas
+const FontSize = 14
+
+// FontFamily is the font used for names on the canvas
+const FontFamily = "Overpass Mono"
+
+// MenuIconSize is the width and height of the menu icon in the top left corner
+// of a card
+const MenuIconSize = 16
+
+// ExportMargin is the space around the entities in exported images
+const ExportMargin = 20
+
+// UnknownPNG is shown instead of the thumbnail of entities without an image
+//
+//go:embed unknown.png
+var UnknownPNG []byte
+
+// Layout holds the sizes of entity cards
+type Layout struct {
+	EntityWidth       int32
+	EntityHeight      int32
+	EntityPadding     int32
+	EntityHandleSize  int32
+	EntityThumbWidth  int32
+	EntityThumbHeight int32
+}
+
+func Default() Layout {
+	return Layout{
+		EntityWidth:       150,
+		EntityHeight:      200,
+		EntityPadding:     4,
+		EntityHandleSize:  6,
+		EntityThumbWidth:  128,
+		EntityThumbHeight: 128,
+	}
+}
+
+// SuperiorHandle returns the centre of the handle at the bottom of a card at
+// x, y. Connections to inferiors start here.
+func (l Layout) SuperiorHandle(x, y int32) (int32, int32) {
+	return x + l.EntityWidth/2, y + l.EntityHeight
+}
+
+// InferiorHandle returns the centre of the handle at the top of a card at
+// x, y. Connections from superiors end here.
+func (l Layout) InferiorHandle(x, y int32) (int32, int32) {
+	return x + l.EntityWidth/2, y
+}
+
+// Thumbnail returns the top left corner of the thumbnail of a card at x, y
+func (l Layout) Thumbnail(x, y int32) (int32, int32) {
+	return x + (l.EntityWidth-l.EntityThumbWidth)/2, y + l.EntityPadding*2 + MenuIconSize
+}
+
+// Name returns the top left corner of the name of a card at x, y
+func (l Layout) Name(x, y int32) (int32, int32) {
+	_, thumbY := l.Thumbnail(x, y)
+	return x + l.EntityPadding, thumbY + l.EntityThumbHeight
+}
+
+// Bounds returns the area covered by a card at x, y including its handles
+func (l Layout) Bounds(x, y int32) image.Rectangle {
+	return image.Rect(
+		int(x),
+		int(y-l.EntityHandleSize/2),
+		int(x+l.EntityWidth),
+		int(y+l.EntityHeight+l.EntityHandleSize/2),
+	)
+}
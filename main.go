@@ -2,11 +2,14 @@ package main
 
 import (
 	"connect-a-thon/conatho"
+	"connect-a-thon/config"
+	"connect-a-thon/layout"
 	"connect-a-thon/ui"
 
 	_ "net/http/pprof"
 
 	"fmt"
+	"os"
 
 	"github.com/jupiterrider/purego-sdl3/sdl"
 	"github.com/jupiterrider/purego-sdl3/ttf"
@@ -15,6 +18,15 @@ import (
 var con conatho.Conatho
 
 func main() {
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
 	// go func() {
 	// 	log.Println(http.ListenAndServe("localhost:6060", nil))
 	// }()
@@ -48,7 +60,7 @@ func main() {
 	defer sdl.DestroyRenderer(renderer)
 	defer sdl.DestroyWindow(window)
 
-	font := ttf.OpenFont("assets/overpass-mono/OverpassMono-Bold.ttf", 14)
+	font := ttf.OpenFont("assets/overpass-mono/OverpassMono-Bold.ttf", layout.FontSize)
 	if font == nil {
 		fmt.Println("Font could not be loaded!")
 		fmt.Println(sdl.GetError())
@@ -87,8 +99,25 @@ func main() {
 	// e1.EntityConnectTo(&e2, "Employs")
 	// e1.EntityConnectTo(&e3, "Employs")
 
-	ui := ui.NewUI(window, renderer, textengine, font)
-	// ui.LoadConatho("test.conatho")
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Println("Could not load config:", err)
+	}
+
+	ui := ui.NewUI(window, renderer, textengine, font, &cfg)
+
+	// Open the file given on the command line, otherwise reopen the last file
+	if len(args) > 0 {
+		err = ui.LoadConatho(args[0])
+		if err != nil {
+			fmt.Println(err)
+		}
+	} else if fPath, ok := cfg.LastFile(); ok {
+		err = ui.LoadConatho(fPath)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
 
 	running := true
 	for running {
@@ -111,17 +140,10 @@ func main() {
 			case sdl.EventTextInput:
 				input := event.Text()
 				ui.TextInput(input.Text())
-			case sdl.EventTextEditingCandidates:
-				fmt.Println("FIXME")
-			case sdl.EventTextEditing:
-				fmt.Println("FIXME")
 			case sdl.EventDropFile:
-				drop := event.Drop()
-				ui.Drop(drop)
-				fmt.Println(drop.Data(), drop.Source())
-			case sdl.EventDropText:
-				drop := event.Drop()
-				fmt.Println(drop.Data(), drop.Source())
+				ui.Drop(event.Drop())
+			case sdl.EventDropComplete:
+				ui.DropComplete()
 			}
 		}
 		sdl.SetRenderDrawColor(renderer, 0, 0, 0, 255)
@@ -131,4 +153,6 @@ func main() {
 
 		sdl.RenderPresent(renderer)
 	}
+
+	ui.SaveViewState()
 }
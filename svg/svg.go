@@ -0,0 +1,150 @@
+// Package svg draws the canvas as a standalone SVG image
+package svg
+
+import (
+	"bufio"
+	"connect-a-thon/conatho"
+	"connect-a-thon/layout"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Colours of the canvas
+const (
+	colorBackground = "#191919"
+	colorCard       = "#000000"
+	colorLine       = "#ffffff"
+	colorText       = "#ffffff"
+)
+
+var ErrNothingToExport = errors.New("no entities to export")
+
+type Options struct {
+	// Entities to draw, all entities when empty. Connections are drawn when
+	// both of their entities are.
+	Selection []uuid.UUID
+}
+
+func escape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+func dataURI(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// Export writes the entities and connections as they are drawn on the
+// canvas, with thumbnails embedded as PNG images
+func Export(w io.Writer, c *conatho.Conatho, l layout.Layout, opts Options) error {
+	var entities []*conatho.Entity
+	included := make(map[uuid.UUID]bool)
+	for _, k := range c.EntitiesKeys {
+		if len(opts.Selection) > 0 && !slices.Contains(opts.Selection, k) {
+			continue
+		}
+		entities = append(entities, c.Entities[k])
+		included[k] = true
+	}
+	if len(entities) == 0 {
+		return ErrNothingToExport
+	}
+
+	var connections []*conatho.Connection
+	for _, k := range c.ConnectionsKeys {
+		connection := c.Connections[k]
+		if included[connection.Superior] && included[connection.Inferior] {
+			connections = append(connections, connection)
+		}
+	}
+
+	var bounds image.Rectangle
+	for _, e := range entities {
+		bounds = bounds.Union(l.Bounds(e.X, e.Y))
+	}
+	bounds = bounds.Inset(-layout.ExportMargin)
+	minX, minY := bounds.Min.X, bounds.Min.Y
+	width, height := bounds.Dx(), bounds.Dy()
+
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.1" width="%d" height="%d" viewBox="%d %d %d %d" font-family="%s, monospace" font-size="%d" font-weight="bold">`+"\n",
+		width, height, minX, minY, width, height, layout.FontFamily, layout.FontSize)
+	fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", minX, minY, width, height, colorBackground)
+
+	// The placeholder thumbnail is only embedded once
+	fmt.Fprintln(bw, `<defs>`)
+	fmt.Fprintf(bw, `<image id="unknown" width="%d" height="%d" preserveAspectRatio="none" xlink:href="%s"/>`+"\n",
+		l.EntityThumbWidth, l.EntityThumbHeight, dataURI("image/png", layout.UnknownPNG))
+	fmt.Fprintln(bw, `</defs>`)
+
+	fmt.Fprintf(bw, `<g stroke="%s" stroke-width="1">`+"\n", colorLine)
+	for _, connection := range connections {
+		superior := c.Entities[connection.Superior]
+		inferior := c.Entities[connection.Inferior]
+		x1, y1 := l.SuperiorHandle(superior.X, superior.Y)
+		x2, y2 := l.InferiorHandle(inferior.X, inferior.Y)
+		fmt.Fprintf(bw, `<line x1="%d" y1="%d" x2="%d" y2="%d"/>`+"\n", x1, y1, x2, y2)
+	}
+	fmt.Fprintln(bw, `</g>`)
+
+	writeHandle := func(x, y int32) {
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n",
+			x-l.EntityHandleSize/2, y-l.EntityHandleSize/2, l.EntityHandleSize, l.EntityHandleSize, colorLine)
+	}
+
+	for _, e := range entities {
+		fmt.Fprintf(bw, `<g id="entity-%s">`+"\n", e.ID)
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="%s"/>`+"\n",
+			e.X, e.Y, l.EntityWidth, l.EntityHeight, colorCard, colorLine)
+
+		thumbX, thumbY := l.Thumbnail(e.X, e.Y)
+		thumbnail, err := e.EntityGetThumbnailPNG()
+		if err == nil {
+			fmt.Fprintf(bw, `<image x="%d" y="%d" width="%d" height="%d" preserveAspectRatio="none" xlink:href="%s"/>`+"\n",
+				thumbX, thumbY, l.EntityThumbWidth, l.EntityThumbHeight, dataURI("image/png", thumbnail))
+		} else if errors.Is(err, conatho.ErrEntityNoImage) {
+			fmt.Fprintf(bw, `<use x="%d" y="%d" xlink:href="#unknown"/>`+"\n", thumbX, thumbY)
+		} else {
+			return err
+		}
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="%s"/>`+"\n",
+			thumbX, thumbY, l.EntityThumbWidth, l.EntityThumbHeight, colorLine)
+
+		nameX, nameY := l.Name(e.X, e.Y)
+		fmt.Fprintf(bw, `<text x="%d" y="%d" fill="%s">%s</text>`+"\n",
+			nameX, nameY+layout.FontSize, colorText, escape(e.Name))
+
+		writeHandle(l.InferiorHandle(e.X, e.Y))
+		writeHandle(l.SuperiorHandle(e.X, e.Y))
+		fmt.Fprintln(bw, `</g>`)
+	}
+
+	// Labels are centred on the connection and drawn last so cards do not cover them
+	fmt.Fprintf(bw, `<g fill="%s" stroke="%s" stroke-width="3" paint-order="stroke" text-anchor="middle">`+"\n", colorText, colorBackground)
+	for _, connection := range connections {
+		if connection.Name == "" {
+			continue
+		}
+		superior := c.Entities[connection.Superior]
+		inferior := c.Entities[connection.Inferior]
+		x1, y1 := l.SuperiorHandle(superior.X, superior.Y)
+		x2, y2 := l.InferiorHandle(inferior.X, inferior.Y)
+		fmt.Fprintf(bw, `<text x="%d" y="%d">%s</text>`+"\n", (x1+x2)/2, (y1+y2)/2+layout.FontSize/3, escape(connection.Name))
+	}
+	fmt.Fprintln(bw, `</g>`)
+
+	fmt.Fprintln(bw, `</svg>`)
+
+	return bw.Flush()
+}
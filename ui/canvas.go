@@ -2,14 +2,26 @@ package ui
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/jupiterrider/purego-sdl3/sdl"
 )
 
 func (ui *UI) RenderCanvas() {
+	ui.renderRemoved()
+
 	sdl.SetRenderDrawColor(ui.Renderer, 255, 255, 255, 255)
 
 	for _, k := range ui.Conatho.ConnectionsKeys {
+		if kind, ok := ui.comparison.connectionChange(k); ok {
+			setChangeColor(ui.Renderer, kind)
+			ui.RenderConnection(k)
+			sdl.SetRenderDrawColor(ui.Renderer, 255, 255, 255, 255)
+			continue
+		}
 		ui.RenderConnection(k)
 	}
 
@@ -32,6 +44,8 @@ func (ui *UI) RenderCanvas() {
 		var x2 float32
 		var y2 float32
 		sdl.GetMouseState(&x2, &y2)
+		x2 /= ui.Zoom
+		y2 /= ui.Zoom
 
 		sdl.SetRenderDrawColor(ui.Renderer, 255, 255, 255, 255)
 		sdl.RenderLine(ui.Renderer, x1, y1, x2, y2)
@@ -41,14 +55,23 @@ func (ui *UI) RenderCanvas() {
 		var x2 float32
 		var y2 float32
 		sdl.GetMouseState(&x2, &y2)
+		x2 /= ui.Zoom
+		y2 /= ui.Zoom
 		sdl.SetRenderDrawColor(ui.Renderer, 255, 0, 0, 255)
 		sdl.RenderLine(ui.Renderer, float32(ui.savedPosX+ui.GlobalX), float32(ui.savedPosY+ui.GlobalY), x2, y2)
 	}
 }
 
 func (ui *UI) MouseDownCanvas(button uint8, mouseX, mouseY int32) {
-	actualX := mouseX - ui.GlobalX
-	actualY := mouseY - ui.GlobalY
+	// A snapshot can only be looked at
+	if ui.snapshot != nil {
+		if button == 3 {
+			ui.startDrag(ActionDragCanvas)
+		}
+		return
+	}
+
+	actualX, actualY := ui.canvasPosition(mouseX, mouseY)
 
 	if button == 1 && ui.action == ActionEntityMenu {
 		thing, ok := ui.InEntityMenu(ui.selectedEntity, actualX, actualY)
@@ -61,10 +84,8 @@ func (ui *UI) MouseDownCanvas(button uint8, mouseX, mouseY int32) {
 				ui.action = ActionNone
 				ui.OpenWindowImageSelect()
 			case MenuItemDelete:
-				err := ui.selectedEntity.Delete()
-				if err != nil {
-					panic(err.Error())
-				}
+				ui.action = ActionNone
+				ui.OpenWindowDeleteEntity(ui.selectedEntity)
 			default:
 				ui.action = ActionNone
 			}
@@ -103,17 +124,16 @@ func (ui *UI) MouseDownCanvas(button uint8, mouseX, mouseY int32) {
 	} else if button == 3 {
 		_, entity := ui.InEntity(ui.Conatho.Entities, actualX, actualY)
 		if entity != nil {
-			ui.action = ActionDragEntity
+			ui.startDrag(ActionDragEntity)
 			ui.selectedEntity = entity
 		} else {
-			ui.action = ActionDragCanvas
+			ui.startDrag(ActionDragCanvas)
 		}
 	}
 }
 
 func (ui *UI) MouseUpCanvas(button uint8, mouseX, mouseY int32) {
-	actualX := mouseX - ui.GlobalX
-	actualY := mouseY - ui.GlobalY
+	actualX, actualY := ui.canvasPosition(mouseX, mouseY)
 
 	if button == 1 {
 		if ui.action == ActionConnectionSuperior {
@@ -154,21 +174,139 @@ func (ui *UI) MouseUpCanvas(button uint8, mouseX, mouseY int32) {
 	}
 }
 
+// Convert a position in the window to a position on the canvas
+func (ui *UI) canvasPosition(mouseX, mouseY int32) (int32, int32) {
+	return int32(float32(mouseX)/ui.Zoom) - ui.GlobalX, int32(float32(mouseY)/ui.Zoom) - ui.GlobalY
+}
+
 func (ui *UI) MouseMotionCanvas(relX, relY float32) {
 	if ui.action == ActionDragCanvas {
-		ui.GlobalX += int32(relX)
-		ui.GlobalY += int32(relY)
+		dx, dy := ui.dragDistance(relX, relY)
+		ui.GlobalX += dx
+		ui.GlobalY += dy
 	} else if ui.action == ActionDragEntity {
-		ui.selectedEntity.X += int32(relX)
-		ui.selectedEntity.Y += int32(relY)
+		dx, dy := ui.dragDistance(relX, relY)
+		ui.selectedEntity.X += dx
+		ui.selectedEntity.Y += dy
 	}
 }
 
+// Distance on the canvas of a mouse motion, the fraction of a pixel left over
+// when zoomed in is kept for the next motion so slow drags don't stall
+func (ui *UI) dragDistance(relX, relY float32) (int32, int32) {
+	x := relX/ui.Zoom + ui.dragRemX
+	y := relY/ui.Zoom + ui.dragRemY
+	dx, dy := int32(x), int32(y)
+	ui.dragRemX = x - float32(dx)
+	ui.dragRemY = y - float32(dy)
+	return dx, dy
+}
+
+// Start dragging the canvas or an entity
+func (ui *UI) startDrag(action Action) {
+	ui.action = action
+	ui.dragRemX = 0
+	ui.dragRemY = 0
+}
+
+const (
+	minZoom = 0.25
+	maxZoom = 4
+)
+
+// Zoom in or out while keeping the point under the mouse in place
+func (ui *UI) MouseWheelCanvas(y, mouseX, mouseY int32) {
+	canvasX, canvasY := ui.canvasPosition(mouseX, mouseY)
+
+	if y > 0 {
+		ui.Zoom *= 1.1
+	} else if y < 0 {
+		ui.Zoom /= 1.1
+	}
+	ui.Zoom = min(max(ui.Zoom, minZoom), maxZoom)
+
+	ui.GlobalX = int32(float32(mouseX)/ui.Zoom) - canvasX
+	ui.GlobalY = int32(float32(mouseY)/ui.Zoom) - canvasY
+}
+
 func (ui *UI) KeyDownCanvas(key sdl.Keycode) {
 	switch key {
 	case sdl.KeycodeA:
-		ui.OpenWindowAdd()
+		if ui.snapshot == nil {
+			ui.OpenWindowAdd()
+		}
 	case sdl.KeycodeEscape:
 		ui.CloseWindow()
 	}
 }
+
+// Entities that are at least partly on the screen
+func (ui *UI) visibleEntities() []uuid.UUID {
+	var width, height int32
+	sdl.GetRenderOutputSize(ui.Renderer, &width, &height)
+
+	x1, y1 := ui.canvasPosition(0, 0)
+	x2, y2 := ui.canvasPosition(width, height)
+
+	var visible []uuid.UUID
+	for _, k := range ui.Conatho.EntitiesKeys {
+		e := ui.Conatho.Entities[k]
+		if e.X+ui.EntityWidth >= x1 && e.X <= x2 && e.Y+ui.EntityHeight >= y1 && e.Y <= y2 {
+			visible = append(visible, k)
+		}
+	}
+	return visible
+}
+
+// DropCanvas sets a file dropped on a card as the image of the entity, a file
+// dropped on the empty canvas becomes a new entity named after it. More files
+// dropped at once are added to the gallery of the card, or become entities
+// next to each other. Files that could not be used are reported when the drop
+// is complete.
+func (ui *UI) DropCanvas(drop sdl.DropEvent) {
+	fPath := drop.Data()
+	actualX, actualY := ui.canvasPosition(int32(drop.X), int32(drop.Y))
+	defer func() { ui.dropped++ }()
+
+	f, err := os.Open(fPath)
+	if err != nil {
+		ui.dropFailed("Could not open file", fPath, err)
+		return
+	}
+	defer f.Close()
+
+	_, entity := ui.InEntity(ui.Conatho.Entities, actualX, actualY)
+	if entity != nil {
+		if ui.dropped == 0 {
+			err = entity.EntityAddImage(f)
+		} else {
+			_, err = entity.AddImage(f, "")
+		}
+		if err != nil {
+			ui.dropFailed("Could not add image", fPath, err)
+			return
+		}
+		ui.forgetThumbnail(entity)
+		return
+	}
+
+	name := strings.TrimSuffix(filepath.Base(fPath), filepath.Ext(fPath))
+	x := actualX - ui.EntityWidth/2 + ui.dropped*(ui.EntityWidth+ui.EntityPadding*4)
+	y := actualY - ui.EntityHeight/2
+
+	// No entity is left behind when the file is not an image
+	err = ui.Conatho.Transaction(func() error {
+		created, err := ui.Conatho.CreateEntity(x, y, name)
+		if err != nil {
+			return err
+		}
+		return ui.Conatho.Entities[created.ID].EntityAddImage(f)
+	})
+	if err != nil {
+		ui.dropFailed("Could not create entity", fPath, err)
+	}
+}
+
+func (ui *UI) dropFailed(what, fPath string, err error) {
+	ui.dropFailures = append(ui.dropFailures, fmt.Sprintf("%s %s: %v", what, filepath.Base(fPath), err))
+}
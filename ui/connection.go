@@ -85,13 +85,10 @@ func (ui *UI) RenderConnection(connectionID uuid.UUID) {
 	superior := ui.Conatho.Entities[connection.Superior]
 	inferior := ui.Conatho.Entities[connection.Inferior]
 
-	superiorConX := float32((superior.X + ui.EntityWidth/2) + ui.GlobalX)
-	superiorConY := float32((superior.Y + ui.EntityHeight) + ui.GlobalY)
+	superiorConX, superiorConY := ui.SuperiorHandle(superior.X+ui.GlobalX, superior.Y+ui.GlobalY)
+	inferiorConX, inferiorConY := ui.InferiorHandle(inferior.X+ui.GlobalX, inferior.Y+ui.GlobalY)
 
-	inferiorConX := float32((inferior.X + ui.EntityWidth/2) + ui.GlobalX)
-	inferiorConY := float32(inferior.Y + ui.GlobalY)
-
-	sdl.RenderLine(ui.Renderer, superiorConX, superiorConY, inferiorConX, inferiorConY)
+	sdl.RenderLine(ui.Renderer, float32(superiorConX), float32(superiorConY), float32(inferiorConX), float32(inferiorConY))
 }
 
 func (ui *UI) CrossesConnection(x1, y1, x2, y2 int32) *conatho.Connection {
@@ -101,11 +98,8 @@ func (ui *UI) CrossesConnection(x1, y1, x2, y2 int32) *conatho.Connection {
 		superior := ui.Conatho.Entities[connection.Superior]
 		inferior := ui.Conatho.Entities[connection.Inferior]
 
-		superiorConX := (superior.X + ui.EntityWidth/2)
-		superiorConY := (superior.Y + ui.EntityHeight)
-
-		inferiorConX := (inferior.X + ui.EntityWidth/2)
-		inferiorConY := inferior.Y
+		superiorConX, superiorConY := ui.SuperiorHandle(superior.X, superior.Y)
+		inferiorConX, inferiorConY := ui.InferiorHandle(inferior.X, inferior.Y)
 
 		if doIntersect(x1, y1, x2, y2, superiorConX, superiorConY, inferiorConX, inferiorConY) {
 			return connection
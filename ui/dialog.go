@@ -0,0 +1,46 @@
+package ui
+
+import (
+	"unsafe"
+
+	"github.com/jupiterrider/purego-sdl3/sdl"
+)
+
+// Callbacks can not be freed, so a single one is shared by all file dialogs
+var dialogCallback sdl.DialogFileCallback
+
+func (ui *UI) showFileDialog(save bool, filterName, pattern string, fn func(fPath string)) {
+	if dialogCallback == 0 {
+		dialogCallback = sdl.NewDialogFileCallback(func(userdata unsafe.Pointer, filelist []string, filter int32) {
+			if len(filelist) > 0 {
+				fPath := filelist[0]
+				ui.RunOnMainThread(func() {
+					if ui.dialogFunction != nil {
+						ui.dialogFunction(fPath)
+					}
+				})
+			}
+		})
+	}
+	ui.dialogFunction = fn
+
+	filters := []sdl.DialogFileFilter{
+		sdl.NewDialogFileFilter(filterName, pattern),
+		sdl.NewDialogFileFilter("All Files", "*"),
+	}
+	if save {
+		sdl.ShowSaveFileDialog(dialogCallback, nil, ui.Window, filters, "")
+	} else {
+		sdl.ShowOpenFileDialog(dialogCallback, nil, ui.Window, filters, "", false)
+	}
+}
+
+// Show a save file dialog, fn is called on the main thread with the chosen path
+func (ui *UI) SaveFileDialog(filterName, pattern string, fn func(fPath string)) {
+	ui.showFileDialog(true, filterName, pattern, fn)
+}
+
+// Show an open file dialog, fn is called on the main thread with the chosen path
+func (ui *UI) OpenFileDialog(filterName, pattern string, fn func(fPath string)) {
+	ui.showFileDialog(false, filterName, pattern, fn)
+}
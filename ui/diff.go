@@ -0,0 +1,210 @@
+package ui
+
+import (
+	"connect-a-thon/conatho"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jupiterrider/purego-sdl3/sdl"
+	"github.com/jupiterrider/purego-sdl3/ttf"
+)
+
+// The changes since another file shown on the canvas, added items are drawn
+// green, removed items red and modified items yellow
+type comparison struct {
+	changes     conatho.Changes
+	entities    map[uuid.UUID]conatho.ChangeKind
+	connections map[uuid.UUID]conatho.ChangeKind
+
+	// Positions of removed entities, so removed connections can be drawn
+	removed map[uuid.UUID]*conatho.DocumentEntity
+}
+
+func (c *comparison) entityChange(id uuid.UUID) (conatho.ChangeKind, bool) {
+	if c == nil {
+		return 0, false
+	}
+	kind, ok := c.entities[id]
+	return kind, ok
+}
+
+func (c *comparison) connectionChange(id uuid.UUID) (conatho.ChangeKind, bool) {
+	if c == nil {
+		return 0, false
+	}
+	kind, ok := c.connections[id]
+	return kind, ok
+}
+
+func setChangeColor(renderer *sdl.Renderer, kind conatho.ChangeKind) {
+	switch kind {
+	case conatho.ChangeAdded:
+		sdl.SetRenderDrawColor(renderer, 0, 200, 0, 255)
+	case conatho.ChangeRemoved:
+		sdl.SetRenderDrawColor(renderer, 220, 0, 0, 255)
+	default:
+		sdl.SetRenderDrawColor(renderer, 230, 200, 0, 255)
+	}
+}
+
+// Open an existing file next to the open one, it must be closed afterwards
+func openOtherConatho(fPath string) (*conatho.Conatho, error) {
+	if _, err := os.Stat(fPath); err != nil {
+		return nil, err
+	}
+
+	other, err := conatho.New(fPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = other.EntityGetAll()
+	if err == nil {
+		err = other.GetAttributeTypes()
+	}
+	if err != nil {
+		other.Close()
+		return nil, err
+	}
+
+	return &other, nil
+}
+
+// CompareWith shows what changed on the canvas since the file at fPath
+func (ui *UI) CompareWith(fPath string) error {
+	other, err := openOtherConatho(fPath)
+	if err != nil {
+		return err
+	}
+	defer other.Close()
+
+	changes, err := conatho.Diff(other, ui.Conatho)
+	if err != nil {
+		return err
+	}
+
+	c := comparison{
+		changes:     changes,
+		entities:    make(map[uuid.UUID]conatho.ChangeKind),
+		connections: make(map[uuid.UUID]conatho.ChangeKind),
+		removed:     make(map[uuid.UUID]*conatho.DocumentEntity),
+	}
+	for _, change := range changes.Entities {
+		if change.Kind == conatho.ChangeRemoved {
+			c.entities[change.Old.ID] = change.Kind
+			c.removed[change.Old.ID] = change.Old
+		} else {
+			c.entities[change.New.ID] = change.Kind
+		}
+	}
+	for _, change := range changes.Connections {
+		if change.Kind == conatho.ChangeRemoved {
+			c.connections[change.Old.ID] = change.Kind
+		} else {
+			c.connections[change.New.ID] = change.Kind
+		}
+	}
+	ui.comparison = &c
+
+	return nil
+}
+
+func (ui *UI) StopComparing() {
+	ui.comparison = nil
+}
+
+// Draw a frame around an entity that changed
+func (ui *UI) renderEntityChange(id uuid.UUID, rect *sdl.FRect) {
+	kind, ok := ui.comparison.entityChange(id)
+	if !ok {
+		return
+	}
+
+	setChangeColor(ui.Renderer, kind)
+	for i := float32(1); i <= 3; i++ {
+		sdl.RenderRect(ui.Renderer, &sdl.FRect{X: rect.X - i, Y: rect.Y - i, W: rect.W + 2*i, H: rect.H + 2*i})
+	}
+	sdl.SetRenderDrawColor(ui.Renderer, 255, 255, 255, 255)
+}
+
+// Draw the entities and connections that no longer exist where they were
+func (ui *UI) renderRemoved() {
+	if ui.comparison == nil {
+		return
+	}
+
+	position := func(id uuid.UUID) (int32, int32, bool) {
+		if e, ok := ui.Conatho.Entities[id]; ok {
+			return e.X, e.Y, true
+		}
+		if de, ok := ui.comparison.removed[id]; ok {
+			return de.X, de.Y, true
+		}
+		return 0, 0, false
+	}
+
+	setChangeColor(ui.Renderer, conatho.ChangeRemoved)
+	for _, change := range ui.comparison.changes.Connections {
+		if change.Kind != conatho.ChangeRemoved {
+			continue
+		}
+		superiorX, superiorY, ok := position(change.Old.Superior)
+		if !ok {
+			continue
+		}
+		inferiorX, inferiorY, ok := position(change.Old.Inferior)
+		if !ok {
+			continue
+		}
+
+		x1, y1 := ui.SuperiorHandle(superiorX+ui.GlobalX, superiorY+ui.GlobalY)
+		x2, y2 := ui.InferiorHandle(inferiorX+ui.GlobalX, inferiorY+ui.GlobalY)
+		sdl.RenderLine(ui.Renderer, float32(x1), float32(y1), float32(x2), float32(y2))
+	}
+
+	for _, change := range ui.comparison.changes.Entities {
+		if change.Kind != conatho.ChangeRemoved {
+			continue
+		}
+		de := change.Old
+		rect := sdl.FRect{
+			X: float32(de.X + ui.GlobalX),
+			Y: float32(de.Y + ui.GlobalY),
+			W: float32(ui.EntityWidth),
+			H: float32(ui.EntityHeight),
+		}
+		sdl.SetRenderDrawColor(ui.Renderer, 40, 0, 0, 255)
+		sdl.RenderFillRect(ui.Renderer, &rect)
+		ui.renderEntityChange(de.ID, &rect)
+
+		nameX, nameY := ui.Name(de.X+ui.GlobalX, de.Y+ui.GlobalY)
+		textName := ttf.CreateText(ui.TextEngine, ui.Font, de.Name, uint64(len(de.Name)))
+		ttf.DrawRendererText(textName, float32(nameX), float32(nameY))
+		ttf.DestroyText(textName)
+	}
+
+	sdl.SetRenderDrawColor(ui.Renderer, 255, 255, 255, 255)
+}
+
+func (ui *UI) OpenWindowChanges() {
+	if ui.comparison == nil {
+		return
+	}
+
+	report := strings.ReplaceAll(ui.comparison.changes.String(), "\t", "    ")
+	if ui.comparison.changes.Empty() {
+		report = "No changes"
+	}
+	changeswin := ui.createReportWindow("Changes", report)
+
+	changeswin.AddButton("Stop Comparing", func(win *UIWindow) {
+		win.ui.StopComparing()
+		win.ui.CloseWindow()
+	})
+	changeswin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = changeswin
+}
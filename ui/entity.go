@@ -2,13 +2,13 @@ package ui
 
 import (
 	"connect-a-thon/conatho"
+	"connect-a-thon/layout"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jupiterrider/purego-sdl3/img"
 	"github.com/jupiterrider/purego-sdl3/sdl"
 	"github.com/jupiterrider/purego-sdl3/ttf"
-
-	_ "embed"
 )
 
 type MenuItem int
@@ -29,7 +29,7 @@ var menuIconTexture *sdl.Texture
 
 func drawMenuIcon(renderer *sdl.Renderer, x, y float32) float32 {
 	if menuIconTexture == nil {
-		menuIconTexture = sdl.CreateTexture(renderer, sdl.PixelFormatRGBA8888, sdl.TextureAccessTarget, 16, 16)
+		menuIconTexture = sdl.CreateTexture(renderer, sdl.PixelFormatRGBA8888, sdl.TextureAccessTarget, layout.MenuIconSize, layout.MenuIconSize)
 		sdl.SetRenderTarget(renderer, menuIconTexture)
 
 		sdl.SetRenderDrawColor(renderer, 0, 0, 0, 0)
@@ -50,8 +50,6 @@ func drawMenuIcon(renderer *sdl.Renderer, x, y float32) float32 {
 	return float32(menuIconTexture.H)
 }
 
-//go:embed img/unknown.png
-var unknownPng []byte
 var unknownTexture *sdl.Texture
 
 func (ui *UI) updateThumbnail(e *conatho.Entity) error {
@@ -71,10 +69,18 @@ func (ui *UI) updateThumbnail(e *conatho.Entity) error {
 	return nil
 }
 
+// Destroy all cached thumbnails, they are loaded again when rendered
+func (ui *UI) clearThumbnailCache() {
+	for id, thumbnail := range ui.ThumbnailCache {
+		sdl.DestroyTexture(thumbnail)
+		delete(ui.ThumbnailCache, id)
+	}
+}
+
 func (ui *UI) renderThumbnail(e *conatho.Entity, rect *sdl.FRect) {
 	if !e.Image {
 		if unknownTexture == nil {
-			iostream := sdl.IOFromConstMem(unknownPng)
+			iostream := sdl.IOFromConstMem(layout.UnknownPNG)
 			unknownTexture = img.LoadTextureIO(ui.Renderer, iostream, true)
 		}
 		sdl.RenderTexture(ui.Renderer, unknownTexture, nil, rect)
@@ -98,37 +104,41 @@ func (ui *UI) RenderEntity(e *conatho.Entity) {
 	x := float32(e.X + ui.GlobalX)
 	y := float32(e.Y + ui.GlobalY)
 
-	nextY := y + float32(ui.EntityPadding)
-
 	rect := sdl.FRect{X: x, Y: y, W: float32(ui.EntityWidth), H: float32(ui.EntityHeight)}
 
 	sdl.SetRenderDrawColor(ui.Renderer, 0, 0, 0, 255)
 	sdl.RenderFillRect(ui.Renderer, &rect)
 	sdl.SetRenderDrawColor(ui.Renderer, 255, 255, 255, 255)
 	sdl.RenderRect(ui.Renderer, &rect)
+	ui.renderEntityChange(e.ID, &rect)
 
-	nextY += drawMenuIcon(ui.Renderer, x+float32(ui.EntityPadding), y+float32(ui.EntityPadding)) + float32(ui.EntityPadding)
+	drawMenuIcon(ui.Renderer, x+float32(ui.EntityPadding), y+float32(ui.EntityPadding))
 
+	thumbX, thumbY := ui.Thumbnail(e.X+ui.GlobalX, e.Y+ui.GlobalY)
 	imgRect := sdl.FRect{
-		X: x + float32((ui.EntityWidth-ui.EntityThumbWidth)/2),
-		Y: nextY,
+		X: float32(thumbX),
+		Y: float32(thumbY),
 		W: float32(ui.EntityThumbWidth),
 		H: float32(ui.EntityThumbHeight),
 	}
 	ui.renderThumbnail(e, &imgRect)
 	sdl.RenderRect(ui.Renderer, &imgRect)
-	nextY += imgRect.H
 
+	nameX, nameY := ui.Name(e.X+ui.GlobalX, e.Y+ui.GlobalY)
 	textName := ttf.CreateText(ui.TextEngine, ui.Font, e.Name, uint64(len(e.Name)))
 	defer ttf.DestroyText(textName)
-	ttf.DrawRendererText(textName, x+float32(ui.EntityPadding), nextY)
-	nextY += float32(ttf.GetFontHeight(ui.Font)) + float32(ui.EntityPadding)
+	ttf.DrawRendererText(textName, float32(nameX), float32(nameY))
+	nextY := float32(nameY) + float32(ttf.GetFontHeight(ui.Font)) + float32(ui.EntityPadding)
 
 	sdl.RenderDebugTextFormat(ui.Renderer, x+float32(ui.EntityPadding), nextY, "X: %d", e.X)
 	nextY += sdl.DebugTextFontCharacterSize + float32(ui.EntityPadding)
 
 	sdl.RenderDebugTextFormat(ui.Renderer, x+4, nextY, "Y: %d", e.Y)
 
+	if ui.Config != nil && ui.Config.MarkRecentChanges && time.Since(e.UpdatedAt) < recentChangeAge {
+		ui.renderRecentChangeMarker(x, y)
+	}
+
 	// Draw handles
 	sdl.RenderFillRect(ui.Renderer, &sdl.FRect{
 		X: x + float32(ui.EntityWidth/2-(ui.EntityHandleSize/2)),
@@ -144,6 +154,23 @@ func (ui *UI) RenderEntity(e *conatho.Entity) {
 	})
 }
 
+// Cards changed within this time get a marker
+const recentChangeAge = 7 * 24 * time.Hour
+
+// Yellow corner in the top right of the card
+func (ui *UI) renderRecentChangeMarker(x, y float32) {
+	size := float32(ui.EntityPadding * 3)
+	corner := x + float32(ui.EntityWidth)
+	color := sdl.FColor{R: 1, G: 0.8, B: 0, A: 1}
+	vertices := []sdl.Vertex{
+		{Position: sdl.FPoint{X: corner - size, Y: y}, Color: color},
+		{Position: sdl.FPoint{X: corner, Y: y}, Color: color},
+		{Position: sdl.FPoint{X: corner, Y: y + size}, Color: color},
+	}
+	sdl.RenderGeometry(ui.Renderer, nil, vertices, nil)
+	sdl.SetRenderDrawColor(ui.Renderer, 255, 255, 255, 255)
+}
+
 func (ui *UI) InEntity(entities map[uuid.UUID]*conatho.Entity, mouseX, mouseY int32) (uuid.UUID, *conatho.Entity) {
 	for u, e := range entities {
 		if mouseX >= e.X &&
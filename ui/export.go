@@ -0,0 +1,318 @@
+package ui
+
+import (
+	"connect-a-thon/conatho"
+	"connect-a-thon/layout"
+	"connect-a-thon/svg"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/google/uuid"
+	"github.com/jupiterrider/purego-sdl3/sdl"
+)
+
+// Run an export function on a newly created file
+func exportToFile(fPath string, export func(f *os.File) error) {
+	f, err := os.Create(fPath)
+	if err != nil {
+		fmt.Println("Could not create file:", err)
+		return
+	}
+
+	err = export(f)
+	// The file may not have been written completely when closing fails
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Println("Could not export:", err)
+	}
+}
+
+// OpenWindowExport lists the export formats, the same as the "Export" menu
+func (ui *UI) OpenWindowExport(items []MenuBarSubMenuItem) {
+	ui.CloseWindow()
+
+	exportwin := ui.CreateWindow(100, 100, 200, 200)
+	exportwin.SetCenter(true)
+	exportwin.AddLabel("Export")
+
+	for _, item := range items {
+		exportwin.AddButton(item.Name, func(win *UIWindow) {
+			win.ui.CloseWindow()
+			item.Function()
+		})
+	}
+	exportwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = exportwin
+}
+
+func (ui *UI) OpenWindowExportDOT() {
+	ui.CloseWindow()
+
+	dotwin := ui.CreateWindow(100, 100, 200, 200)
+	dotwin.SetCenter(true)
+
+	dotwin.AddLabel("Export DOT")
+
+	dotwin.AddLabel("Attributes (comma separated)")
+	dotwin.AddInputField("attributes")
+
+	dotwin.AddLabel("Thumbnails")
+	dotwin.AddComboBox("thumbnails", map[int64]string{
+		0: "No",
+		1: "Yes",
+	})
+
+	dotwin.AddButton("Export", func(win *UIWindow) {
+		var attributes []string
+		for _, attribute := range strings.Split(win.GetInputField("attributes"), ",") {
+			attribute = strings.TrimSpace(attribute)
+			if attribute != "" {
+				attributes = append(attributes, attribute)
+			}
+		}
+
+		thumbnails, err := win.GetComboBox("thumbnails")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		win.ui.CloseWindow()
+
+		win.ui.SaveFileDialog("DOT Files", "dot;gv", func(fPath string) {
+			opts := conatho.DOTOptions{Attributes: attributes}
+			if thumbnails == 1 {
+				opts.ThumbnailDir = strings.TrimSuffix(fPath, filepath.Ext(fPath)) + "_thumbnails"
+			}
+
+			exportToFile(fPath, func(f *os.File) error {
+				return win.ui.Conatho.ExportDOT(f, opts)
+			})
+		})
+	})
+	dotwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = dotwin
+}
+
+// Which entities are exported to SVG
+const (
+	svgSelectionAll int64 = iota
+	svgSelectionVisible
+	svgSelectionEntity
+)
+
+func (ui *UI) OpenWindowExportSVG() {
+	ui.CloseWindow()
+
+	svgwin := ui.CreateWindow(100, 100, 200, 200)
+	svgwin.SetCenter(true)
+
+	svgwin.AddLabel("Export SVG")
+
+	options := map[int64]string{
+		svgSelectionAll:     "Everything",
+		svgSelectionVisible: "Visible area",
+	}
+	// The selected entity may have been deleted since
+	var selected *conatho.Entity
+	if ui.selectedEntity != nil {
+		selected = ui.Conatho.Entities[ui.selectedEntity.ID]
+	}
+	if selected != nil {
+		options[svgSelectionEntity] = selected.Name + " and connected entities"
+	}
+
+	svgwin.AddLabel("Entities")
+	svgwin.AddComboBox("selection", options)
+
+	svgwin.AddButton("Export", func(win *UIWindow) {
+		key, err := win.GetComboBox("selection")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		var opts svg.Options
+		switch key {
+		case svgSelectionVisible:
+			opts.Selection = win.ui.visibleEntities()
+		case svgSelectionEntity:
+			opts.Selection = []uuid.UUID{selected.ID}
+			for _, id := range selected.Connections {
+				connection := win.ui.Conatho.Connections[id]
+				opts.Selection = append(opts.Selection, connection.Superior, connection.Inferior)
+			}
+		}
+		win.ui.CloseWindow()
+
+		win.ui.SaveFileDialog("SVG Files", "svg", func(fPath string) {
+			exportToFile(fPath, func(f *os.File) error {
+				return svg.Export(f, win.ui.Conatho, win.ui.Layout, opts)
+			})
+		})
+	})
+	svgwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = svgwin
+}
+
+// Largest render target used when exporting an image, larger images are
+// rendered in tiles
+const maxExportTileSize = 4096
+
+// Exported images are held in memory, so their size is limited
+const maxExportPixels = 1 << 28
+
+// ExportImage renders all entities at the scale into offscreen render targets
+// and writes them to a PNG image
+func (ui *UI) ExportImage(w io.Writer, scale float32) error {
+	if len(ui.Conatho.EntitiesKeys) == 0 {
+		return errors.New("no entities to export")
+	}
+
+	var bounds image.Rectangle
+	for _, k := range ui.Conatho.EntitiesKeys {
+		e := ui.Conatho.Entities[k]
+		bounds = bounds.Union(ui.Bounds(e.X, e.Y))
+	}
+	bounds = bounds.Inset(-layout.ExportMargin)
+
+	width := int(math.Ceil(float64(bounds.Dx()) * float64(scale)))
+	height := int(math.Ceil(float64(bounds.Dy()) * float64(scale)))
+	if width*height > maxExportPixels {
+		return fmt.Errorf("image of %dx%d pixels is too large, choose a smaller scale", width, height)
+	}
+
+	tileSize := int32(sdl.GetNumberProperty(sdl.GetRendererProperties(ui.Renderer), sdl.PropRendererMaxTextureSizeNumber, maxExportTileSize))
+	tileSize = min(tileSize, maxExportTileSize)
+
+	// Tiles start at whole canvas positions, so they line up without seams
+	step := int32(float32(tileSize-1) / scale)
+	if step < 1 {
+		return errors.New("scale is too large")
+	}
+
+	texture := sdl.CreateTexture(ui.Renderer, sdl.PixelFormatRGBA8888, sdl.TextureAccessTarget, tileSize, tileSize)
+	if texture == nil {
+		return errors.New(sdl.GetError())
+	}
+	defer sdl.DestroyTexture(texture)
+
+	// Render the canvas without the view and anything that is being dragged
+	globalX, globalY, action := ui.GlobalX, ui.GlobalY, ui.action
+	ui.action = ActionNone
+	defer func() {
+		ui.GlobalX, ui.GlobalY, ui.action = globalX, globalY, action
+		sdl.SetRenderTarget(ui.Renderer, nil)
+		sdl.SetRenderScale(ui.Renderer, 1, 1)
+	}()
+
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	pixel := func(canvas int32) int {
+		return int(math.Round(float64(canvas) * float64(scale)))
+	}
+
+	for canvasY := int32(0); pixel(canvasY) < height; canvasY += step {
+		for canvasX := int32(0); pixel(canvasX) < width; canvasX += step {
+			x, y := pixel(canvasX), pixel(canvasY)
+			tileWidth := min(pixel(canvasX+step), width) - x
+			tileHeight := min(pixel(canvasY+step), height) - y
+
+			sdl.SetRenderTarget(ui.Renderer, texture)
+			sdl.SetRenderScale(ui.Renderer, 1, 1)
+			sdl.SetRenderDrawColor(ui.Renderer, 25, 25, 25, 255)
+			sdl.RenderClear(ui.Renderer)
+
+			sdl.SetRenderScale(ui.Renderer, scale, scale)
+			ui.GlobalX = -(int32(bounds.Min.X) + canvasX)
+			ui.GlobalY = -(int32(bounds.Min.Y) + canvasY)
+			ui.RenderCanvas()
+
+			err := readPixels(ui.Renderer, out, image.Rect(x, y, x+tileWidth, y+tileHeight))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return png.Encode(w, out)
+}
+
+// Copy the top left of the render target into the area of the image
+func readPixels(renderer *sdl.Renderer, img *image.RGBA, area image.Rectangle) error {
+	surface := sdl.RenderReadPixels(renderer, &sdl.Rect{W: int32(area.Dx()), H: int32(area.Dy())})
+	if surface == nil {
+		return errors.New(sdl.GetError())
+	}
+	defer sdl.DestroySurface(surface)
+
+	converted := sdl.ConvertSurface(surface, sdl.PixelFormatRGBA32)
+	if converted == nil {
+		return errors.New(sdl.GetError())
+	}
+	defer sdl.DestroySurface(converted)
+
+	if sdl.MustLock(converted) {
+		sdl.LockSurface(converted)
+		defer sdl.UnlockSurface(converted)
+	}
+
+	pixels := unsafe.Slice((*byte)(converted.Pixels), int(converted.Pitch)*int(converted.H))
+	for row := 0; row < area.Dy(); row++ {
+		src := pixels[row*int(converted.Pitch) : row*int(converted.Pitch)+area.Dx()*4]
+		copy(img.Pix[img.PixOffset(area.Min.X, area.Min.Y+row):], src)
+	}
+
+	return nil
+}
+
+func (ui *UI) OpenWindowExportImage() {
+	ui.CloseWindow()
+
+	imagewin := ui.CreateWindow(100, 100, 200, 200)
+	imagewin.SetCenter(true)
+
+	imagewin.AddLabel("Export Image")
+
+	imagewin.AddLabel("Scale")
+	imagewin.AddInputField("scale")
+	imagewin.SetInputField("scale", strconv.FormatFloat(float64(ui.Zoom), 'f', -1, 32))
+
+	imagewin.AddButton("Export", func(win *UIWindow) {
+		scale, err := strconv.ParseFloat(strings.TrimSpace(win.GetInputField("scale")), 32)
+		if err != nil || scale <= 0 {
+			fmt.Println("Invalid scale:", win.GetInputField("scale"))
+			return
+		}
+		win.ui.CloseWindow()
+
+		win.ui.SaveFileDialog("PNG Images", "png", func(fPath string) {
+			exportToFile(fPath, func(f *os.File) error {
+				return win.ui.ExportImage(f, float32(scale))
+			})
+		})
+	})
+	imagewin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = imagewin
+}
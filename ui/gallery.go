@@ -0,0 +1,253 @@
+package ui
+
+import (
+	"connect-a-thon/conatho"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/jupiterrider/purego-sdl3/img"
+	"github.com/jupiterrider/purego-sdl3/sdl"
+)
+
+const galleryPreviewSize = 256
+const galleryViewSize = 800
+
+// File extensions of the supported image formats, for file dialogs
+const imageFilePattern = "png;jpg;jpeg;gif;webp;bmp;tif;tiff;qoi"
+
+func galleryLabel(i int, ei conatho.EntityImage) string {
+	label := strconv.Itoa(i + 1)
+	if ei.Caption != "" {
+		label += " " + ei.Caption
+	}
+	if ei.Primary {
+		label += " (primary)"
+	}
+	return label
+}
+
+// Add an image of the entity to the window, scaled to fit in size
+func (win *UIWindow) addEntityImage(e *conatho.Entity, imageID int64, size int32) error {
+	data, err := e.GetImageData(imageID)
+	if err != nil {
+		return err
+	}
+
+	iostream := sdl.IOFromConstMem(data)
+	texture := img.LoadTextureIO(win.ui.Renderer, iostream, true)
+
+	displayWidth := size
+	displayHeight := size
+	if texture.W > texture.H {
+		displayHeight = int32(float32(texture.H) / float32(texture.W) * float32(displayWidth))
+	} else if texture.H > texture.W {
+		displayWidth = int32(float32(texture.W) / float32(texture.H) * float32(displayHeight))
+	}
+
+	win.AddImage(texture, displayWidth, displayHeight)
+	return nil
+}
+
+// The thumbnail on the card is loaded again when the primary image may have
+// changed
+func (ui *UI) forgetThumbnail(e *conatho.Entity) {
+	if thumbnail, ok := ui.ThumbnailCache[e.ID]; ok {
+		sdl.DestroyTexture(thumbnail)
+		delete(ui.ThumbnailCache, e.ID)
+	}
+}
+
+// OpenWindowGallery shows the images of the entity, imageID is the image
+// shown first, 0 shows the primary image
+func (ui *UI) OpenWindowGallery(e *conatho.Entity, imageID int64) {
+	ui.CloseWindow()
+
+	images, err := e.GetImages()
+	if err != nil {
+		fmt.Println("Could not load images:", err)
+		return
+	}
+
+	gallerywin := ui.CreateWindow(100, 100, 200, 200)
+	gallerywin.SetCenter(true)
+
+	gallerywin.AddLabel("Images of " + e.Name)
+
+	current := slices.IndexFunc(images, func(ei conatho.EntityImage) bool {
+		return ei.ID == imageID || (imageID == 0 && ei.Primary)
+	})
+	if current < 0 && len(images) > 0 {
+		current = 0
+	}
+
+	if len(images) == 0 {
+		gallerywin.AddLabel("No images")
+	} else {
+		err := gallerywin.addEntityImage(e, images[current].ID, galleryPreviewSize)
+		if err != nil {
+			fmt.Println("Could not load image:", err)
+		}
+
+		options := make(map[int64]string)
+		for i, ei := range images {
+			options[int64(i)] = galleryLabel(i, ei)
+		}
+		gallerywin.AddComboBox("image", options)
+		gallerywin.SetComboBox("image", int64(current))
+
+		selected := func(win *UIWindow) (conatho.EntityImage, int, bool) {
+			i, err := win.GetComboBox("image")
+			if err != nil {
+				fmt.Println(err)
+				return conatho.EntityImage{}, 0, false
+			}
+			return images[i], int(i), true
+		}
+
+		gallerywin.AddButton("Show", func(win *UIWindow) {
+			ei, _, ok := selected(win)
+			if !ok {
+				return
+			}
+			win.ui.OpenWindowGallery(e, ei.ID)
+		})
+		gallerywin.AddButton("View", func(win *UIWindow) {
+			ei, i, ok := selected(win)
+			if !ok {
+				return
+			}
+			win.ui.OpenWindowViewImage(e, ei, i)
+		})
+		gallerywin.AddButton("Edit", func(win *UIWindow) {
+			ei, _, ok := selected(win)
+			if !ok {
+				return
+			}
+			win.ui.editStoredImage(e, ei)
+		})
+		gallerywin.AddButton("Make Primary", func(win *UIWindow) {
+			ei, _, ok := selected(win)
+			if !ok {
+				return
+			}
+			err := e.SetPrimaryImage(ei.ID)
+			if err != nil {
+				fmt.Println("Could not change primary image:", err)
+				return
+			}
+			win.ui.forgetThumbnail(e)
+			win.ui.OpenWindowGallery(e, ei.ID)
+		})
+		gallerywin.AddButton("Move Up", func(win *UIWindow) {
+			ei, i, ok := selected(win)
+			if !ok {
+				return
+			}
+			err := e.MoveImage(ei.ID, i-1)
+			if err != nil {
+				fmt.Println("Could not move image:", err)
+				return
+			}
+			win.ui.OpenWindowGallery(e, ei.ID)
+		})
+		gallerywin.AddButton("Move Down", func(win *UIWindow) {
+			ei, i, ok := selected(win)
+			if !ok {
+				return
+			}
+			err := e.MoveImage(ei.ID, i+1)
+			if err != nil {
+				fmt.Println("Could not move image:", err)
+				return
+			}
+			win.ui.OpenWindowGallery(e, ei.ID)
+		})
+		gallerywin.AddButton("Remove", func(win *UIWindow) {
+			ei, _, ok := selected(win)
+			if !ok {
+				return
+			}
+			err := e.RemoveImage(ei.ID)
+			if err != nil {
+				fmt.Println("Could not remove image:", err)
+				return
+			}
+			win.ui.forgetThumbnail(e)
+			win.ui.OpenWindowGallery(e, 0)
+		})
+
+		gallerywin.AddLabel("Caption")
+		gallerywin.AddInputField("caption")
+		gallerywin.SetInputField("caption", images[current].Caption)
+		gallerywin.AddButton("Save Caption", func(win *UIWindow) {
+			ei, _, ok := selected(win)
+			if !ok {
+				return
+			}
+			err := e.SetImageCaption(ei.ID, win.GetInputField("caption"))
+			if err != nil {
+				fmt.Println("Could not change caption:", err)
+				return
+			}
+			win.ui.OpenWindowGallery(e, ei.ID)
+		})
+	}
+
+	gallerywin.AddButton("Add", func(win *UIWindow) {
+		win.ui.OpenFileDialog("Images", imageFilePattern, func(fPath string) {
+			win.ui.addGalleryImage(e, fPath)
+		})
+	})
+	gallerywin.AddButton("Back", func(win *UIWindow) {
+		win.ui.OpenWindowEdit(e)
+	})
+	gallerywin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = gallerywin
+}
+
+// Add the image file after the other images of the entity
+func (ui *UI) addGalleryImage(e *conatho.Entity, fPath string) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		fmt.Println("Could not open file:", err)
+		return
+	}
+	defer f.Close()
+
+	imageID, err := e.AddImage(f, "")
+	if err != nil {
+		fmt.Println("Could not add image:", err)
+		return
+	}
+	ui.forgetThumbnail(e)
+	ui.OpenWindowGallery(e, imageID)
+}
+
+// OpenWindowViewImage shows an image of the entity at a larger size
+func (ui *UI) OpenWindowViewImage(e *conatho.Entity, ei conatho.EntityImage, i int) {
+	ui.CloseWindow()
+
+	viewwin := ui.CreateWindow(100, 100, 200, 200)
+	viewwin.SetCenter(true)
+
+	viewwin.AddLabel(galleryLabel(i, ei))
+	viewwin.AddLabel(fmt.Sprintf("%s, %d x %d", ei.MIMEType, ei.Width, ei.Height))
+	err := viewwin.addEntityImage(e, ei.ID, galleryViewSize)
+	if err != nil {
+		fmt.Println("Could not load image:", err)
+	}
+
+	viewwin.AddButton("Back", func(win *UIWindow) {
+		win.ui.OpenWindowGallery(e, ei.ID)
+	})
+	viewwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = viewwin
+}
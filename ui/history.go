@@ -0,0 +1,37 @@
+package ui
+
+import (
+	"connect-a-thon/conatho"
+	"fmt"
+	"strings"
+)
+
+// OpenWindowHistory lists the changes made to the entity and its connections
+func (ui *UI) OpenWindowHistory(e *conatho.Entity) {
+	history, err := e.History()
+	if err != nil {
+		fmt.Println("Could not load history:", err)
+		return
+	}
+
+	var sb strings.Builder
+	for _, a := range history {
+		sb.WriteString(a.String())
+		sb.WriteString("\n")
+	}
+	report := sb.String()
+	if len(history) == 0 {
+		report = "No changes recorded"
+	}
+
+	historywin := ui.createReportWindow("History of "+e.Name, report)
+
+	historywin.AddButton("Back", func(win *UIWindow) {
+		win.ui.OpenWindowEdit(e)
+	})
+	historywin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = historywin
+}
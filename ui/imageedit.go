@@ -0,0 +1,198 @@
+package ui
+
+import (
+	"bytes"
+	"connect-a-thon/conatho"
+	"fmt"
+	"image"
+	"os"
+	"strconv"
+
+	"github.com/jupiterrider/purego-sdl3/img"
+	"github.com/jupiterrider/purego-sdl3/sdl"
+)
+
+// An image being turned and cropped. A new image is only stored when the
+// edit is saved, a stored image keeps its original.
+type imageEditor struct {
+	entity *conatho.Entity
+	// Data of a new image, nil when editing a stored image
+	data []byte
+	// ID of the stored image
+	imageID int64
+	// Upright original
+	img  image.Image
+	edit conatho.ImageEdit
+	// Return to the gallery instead of closing the window
+	gallery bool
+}
+
+func (ed *imageEditor) size() (int, int) {
+	bounds := ed.img.Bounds()
+	return bounds.Dx(), bounds.Dy()
+}
+
+// Open the image file as new primary image of the entity
+func (ui *UI) openImageFile(e *conatho.Entity, fPath string) {
+	data, err := os.ReadFile(fPath)
+	if err != nil {
+		fmt.Println("Could not open file:", err)
+		return
+	}
+
+	decoded, err := conatho.DecodeImage(data)
+	if err != nil {
+		fmt.Println("Could not open image:", err)
+		return
+	}
+
+	ui.OpenWindowImageEditor(&imageEditor{entity: e, data: data, img: decoded})
+}
+
+// Edit a stored image of the entity
+func (ui *UI) editStoredImage(e *conatho.Entity, ei conatho.EntityImage) {
+	data, err := e.GetImageData(ei.ID)
+	if err != nil {
+		fmt.Println("Could not load image:", err)
+		return
+	}
+
+	decoded, err := conatho.DecodeImage(data)
+	if err != nil {
+		fmt.Println("Could not open image:", err)
+		return
+	}
+
+	ui.OpenWindowImageEditor(&imageEditor{entity: e, imageID: ei.ID, img: decoded, edit: ei.Edit, gallery: true})
+}
+
+// OpenWindowImageEditor shows the image as it will be shown on the card and
+// turns, flips and crops it
+func (ui *UI) OpenWindowImageEditor(ed *imageEditor) {
+	ui.CloseWindow()
+
+	editorwin := ui.CreateWindow(100, 100, 200, 200)
+	editorwin.SetCenter(true)
+
+	editorwin.AddLabel("Edit Image")
+
+	preview, err := conatho.ImageEditPreview(ed.img, ed.edit, galleryPreviewSize)
+	if err != nil {
+		fmt.Println("Could not show image:", err)
+	} else {
+		iostream := sdl.IOFromConstMem(preview)
+		texture := img.LoadTextureIO(ui.Renderer, iostream, true)
+		editorwin.AddImage(texture, galleryPreviewSize, galleryPreviewSize)
+	}
+
+	width, height := ed.edit.Size(ed.size())
+	editorwin.AddLabel(fmt.Sprintf("%d x %d", width, height))
+
+	editorwin.AddButton("Rotate Left", func(win *UIWindow) {
+		ed.edit = ed.edit.RotateLeft(ed.size())
+		win.ui.OpenWindowImageEditor(ed)
+	})
+	editorwin.AddButton("Rotate Right", func(win *UIWindow) {
+		ed.edit = ed.edit.RotateRight(ed.size())
+		win.ui.OpenWindowImageEditor(ed)
+	})
+	editorwin.AddButton("Flip", func(win *UIWindow) {
+		ed.edit = ed.edit.ToggleFlip(ed.size())
+		win.ui.OpenWindowImageEditor(ed)
+	})
+
+	// The crop is entered in pixels of the turned image
+	crop := ed.edit.Crop
+	if crop.Empty() {
+		crop = image.Rect(0, 0, width, height)
+	}
+	for _, field := range []struct {
+		name  string
+		value int
+	}{
+		{"x", crop.Min.X},
+		{"y", crop.Min.Y},
+		{"width", crop.Dx()},
+		{"height", crop.Dy()},
+	} {
+		editorwin.AddLabel("Crop " + field.name)
+		editorwin.AddInputField(field.name)
+		editorwin.SetInputField(field.name, strconv.Itoa(field.value))
+	}
+
+	editorwin.AddButton("Crop", func(win *UIWindow) {
+		var values [4]int
+		for i, name := range []string{"x", "y", "width", "height"} {
+			n, err := strconv.Atoi(win.GetInputField(name))
+			if err != nil {
+				fmt.Println("Invalid crop", name)
+				return
+			}
+			values[i] = n
+		}
+		rect := image.Rect(values[0], values[1], values[0]+values[2], values[1]+values[3])
+		if !rect.In(image.Rect(0, 0, width, height)) {
+			fmt.Println("Crop is outside of the image")
+			return
+		}
+		ed.edit.Crop = rect
+		win.ui.OpenWindowImageEditor(ed)
+	})
+	editorwin.AddButton("Square Crop", func(win *UIWindow) {
+		ed.edit.Crop = ed.edit.CenteredSquare(ed.size())
+		win.ui.OpenWindowImageEditor(ed)
+	})
+	editorwin.AddButton("No Crop", func(win *UIWindow) {
+		ed.edit.Crop = image.Rectangle{}
+		win.ui.OpenWindowImageEditor(ed)
+	})
+
+	editorwin.AddButton("Save", func(win *UIWindow) {
+		err := win.ui.saveImageEdit(ed)
+		if err != nil {
+			fmt.Println("Could not save image:", err)
+			return
+		}
+		win.ui.forgetThumbnail(ed.entity)
+		if ed.gallery {
+			win.ui.OpenWindowGallery(ed.entity, ed.imageID)
+		} else {
+			win.ui.CloseWindow()
+		}
+	})
+	editorwin.AddButton("Cancel", func(win *UIWindow) {
+		if ed.gallery {
+			win.ui.OpenWindowGallery(ed.entity, ed.imageID)
+		} else {
+			win.ui.CloseWindow()
+		}
+	})
+
+	ui.window = editorwin
+}
+
+// Store a new image as primary image with the edit, or change the edit of a
+// stored image
+func (ui *UI) saveImageEdit(ed *imageEditor) error {
+	if ed.data == nil {
+		return ed.entity.SetImageEdit(ed.imageID, ed.edit)
+	}
+
+	err := ed.entity.EntityAddImage(bytes.NewReader(ed.data))
+	if err != nil {
+		return err
+	}
+
+	images, err := ed.entity.GetImages()
+	if err != nil {
+		return err
+	}
+	for _, ei := range images {
+		if ei.Primary {
+			ed.imageID = ei.ID
+			ed.data = nil
+			return ed.entity.SetImageEdit(ei.ID, ed.edit)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package ui
+
+import (
+	"connect-a-thon/conatho"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Maximum number of lines shown in the report window
+const maxReportLines = 30
+
+// Run an import function on an opened file and show the report
+func (ui *UI) importFromFile(fPath string, title string, importer func(r io.Reader) (conatho.ImportReport, error)) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		fmt.Println("Could not open file:", err)
+		return
+	}
+	defer f.Close()
+
+	report, err := importer(f)
+	if err != nil {
+		fmt.Println("Could not import:", err)
+		return
+	}
+
+	// Imports may have replaced the images of existing entities
+	ui.clearThumbnailCache()
+
+	ui.OpenWindowReport(title, report.String())
+}
+
+// Run an import function on an opened file without changing anything, the
+// report offers to run the import for real
+func (ui *UI) dryRunFromFile(fPath string, title string, importer func(r io.Reader) (conatho.ImportReport, error)) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		fmt.Println("Could not open file:", err)
+		return
+	}
+	defer f.Close()
+
+	report, err := ui.Conatho.DryRun(func() (conatho.ImportReport, error) {
+		return importer(f)
+	})
+	if err != nil {
+		fmt.Println("Could not import:", err)
+		return
+	}
+
+	ui.OpenWindowDryRunReport(title, report.String(), func() {
+		ui.importFromFile(fPath, title, importer)
+	})
+}
+
+func (ui *UI) createReportWindow(title string, report string) *UIWindow {
+	ui.CloseWindow()
+
+	reportwin := ui.CreateWindow(100, 100, 200, 200)
+	reportwin.SetCenter(true)
+
+	reportwin.AddLabel(title)
+
+	lines := strings.Split(strings.TrimRight(report, "\n"), "\n")
+	for i, line := range lines {
+		if i == maxReportLines {
+			reportwin.AddLabel(fmt.Sprintf("... and %d more", len(lines)-maxReportLines))
+			break
+		}
+		reportwin.AddLabel(line)
+	}
+
+	return reportwin
+}
+
+func (ui *UI) OpenWindowReport(title string, report string) {
+	reportwin := ui.createReportWindow(title, report)
+
+	reportwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = reportwin
+}
+
+// OpenWindowDryRunReport shows the report of a dry run, apply runs the import
+func (ui *UI) OpenWindowDryRunReport(title string, report string, apply func()) {
+	reportwin := ui.createReportWindow(title, report)
+
+	reportwin.AddButton("Import", func(win *UIWindow) {
+		apply()
+	})
+	reportwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = reportwin
+}
+
+// Number of rows shown in the preview of a CSV file
+const csvPreviewRows = 5
+
+// Maximum length of a line in the preview of a CSV file
+const csvPreviewWidth = 80
+
+// Combobox keys for columns that are not mapped to an existing attribute type
+const (
+	csvColumnSkip int64 = -2
+	csvColumnNew  int64 = -1
+)
+
+func (ui *UI) openCSV(fPath string) (conatho.CSVTable, bool) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		fmt.Println("Could not open file:", err)
+		return conatho.CSVTable{}, false
+	}
+	defer f.Close()
+
+	table, err := conatho.ReadCSV(f)
+	if err != nil {
+		fmt.Println("Could not read CSV:", err)
+		return table, false
+	}
+
+	return table, true
+}
+
+func (win *UIWindow) addCSVPreview(table conatho.CSVTable) {
+	lines := [][]string{table.Headers}
+	lines = append(lines, table.Rows[:min(len(table.Rows), csvPreviewRows)]...)
+
+	for _, line := range lines {
+		text := strings.Join(line, " | ")
+		if utf8.RuneCountInString(text) > csvPreviewWidth {
+			text = string([]rune(text)[:csvPreviewWidth-3]) + "..."
+		}
+		win.AddLabel(text)
+	}
+	if len(table.Rows) > csvPreviewRows {
+		win.AddLabel(fmt.Sprintf("... %d rows in total", len(table.Rows)))
+	}
+}
+
+func csvColumnOptions(table conatho.CSVTable) map[int64]string {
+	options := make(map[int64]string)
+	for i, header := range table.Headers {
+		options[int64(i)] = header
+	}
+	return options
+}
+
+func (ui *UI) OpenWindowImportCSVEntities(table conatho.CSVTable) {
+	ui.CloseWindow()
+
+	csvwin := ui.CreateWindow(100, 100, 200, 200)
+	csvwin.SetCenter(true)
+
+	csvwin.AddLabel("Import CSV Entities")
+	csvwin.addCSVPreview(table)
+
+	csvwin.AddLabel("Name column")
+	csvwin.AddComboBox("name", csvColumnOptions(table))
+	csvwin.SetComboBox("name", int64(table.NameColumn()))
+
+	keyOptions := csvColumnOptions(table)
+	keyOptions[-1] = "None"
+	csvwin.AddLabel("Unique key column")
+	csvwin.AddComboBox("key", keyOptions)
+	csvwin.SetComboBox("key", -1)
+	for i, header := range table.Headers {
+		if id, ok := ui.Conatho.AttributeTypeByName(header); ok && ui.Conatho.AttributeTypes[id].Key {
+			csvwin.SetComboBox("key", int64(i))
+			break
+		}
+	}
+
+	for i, header := range table.Headers {
+		datatype := table.DetectDatatype(i)
+
+		options := map[int64]string{
+			csvColumnSkip: "Skip",
+			csvColumnNew:  "New type (" + datatype.String() + ")",
+		}
+		for id, attributeType := range ui.Conatho.AttributeTypes {
+			options[id] = attributeType.Name
+		}
+
+		identifier := "column" + strconv.Itoa(i)
+		csvwin.AddLabel(header)
+		csvwin.AddComboBox(identifier, options)
+		if id, ok := ui.Conatho.AttributeTypeByName(header); ok {
+			csvwin.SetComboBox(identifier, id)
+		} else {
+			csvwin.SetComboBox(identifier, csvColumnNew)
+		}
+	}
+
+	readMapping := func(win *UIWindow) (conatho.CSVEntityMapping, bool) {
+		nameColumn, err := win.GetComboBox("name")
+		if err != nil {
+			fmt.Println(err)
+			return conatho.CSVEntityMapping{}, false
+		}
+		keyColumn, err := win.GetComboBox("key")
+		if err != nil {
+			fmt.Println(err)
+			return conatho.CSVEntityMapping{}, false
+		}
+
+		mapping := conatho.CSVEntityMapping{NameColumn: int(nameColumn)}
+		for i := range table.Headers {
+			if i == mapping.NameColumn {
+				continue
+			}
+
+			key, err := win.GetComboBox("column" + strconv.Itoa(i))
+			if err != nil {
+				fmt.Println(err)
+				return conatho.CSVEntityMapping{}, false
+			}
+
+			column := conatho.CSVColumn{Column: i, Key: int64(i) == keyColumn}
+			switch key {
+			case csvColumnSkip:
+				continue
+			case csvColumnNew:
+				column.Datatype = table.DetectDatatype(i)
+			default:
+				column.AttributeType = key
+			}
+			mapping.Columns = append(mapping.Columns, column)
+		}
+
+		return mapping, true
+	}
+
+	importCSV := func(mapping conatho.CSVEntityMapping) {
+		report, err := ui.Conatho.ImportCSVEntities(table, mapping)
+		if err != nil {
+			fmt.Println("Could not import:", err)
+			return
+		}
+		ui.OpenWindowReport("Import CSV Entities", report.String())
+	}
+
+	csvwin.AddButton("Import", func(win *UIWindow) {
+		if mapping, ok := readMapping(win); ok {
+			importCSV(mapping)
+		}
+	})
+	csvwin.AddButton("Dry Run", func(win *UIWindow) {
+		mapping, ok := readMapping(win)
+		if !ok {
+			return
+		}
+
+		report, err := win.ui.Conatho.DryRun(func() (conatho.ImportReport, error) {
+			return win.ui.Conatho.ImportCSVEntities(table, mapping)
+		})
+		if err != nil {
+			fmt.Println("Could not import:", err)
+			return
+		}
+		win.ui.OpenWindowDryRunReport("Import CSV Entities", report.String(), func() {
+			importCSV(mapping)
+		})
+	})
+	csvwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = csvwin
+}
+
+func (ui *UI) OpenWindowImportCSVConnections(table conatho.CSVTable) {
+	ui.CloseWindow()
+
+	csvwin := ui.CreateWindow(100, 100, 200, 200)
+	csvwin.SetCenter(true)
+
+	csvwin.AddLabel("Import CSV Connections")
+	csvwin.addCSVPreview(table)
+
+	csvwin.AddLabel("Superior column")
+	csvwin.AddComboBox("superior", csvColumnOptions(table))
+
+	csvwin.AddLabel("Inferior column")
+	csvwin.AddComboBox("inferior", csvColumnOptions(table))
+	csvwin.SetComboBox("inferior", 1)
+
+	nameOptions := csvColumnOptions(table)
+	nameOptions[-1] = "None"
+	csvwin.AddLabel("Name column")
+	csvwin.AddComboBox("name", nameOptions)
+	if len(table.Headers) > 2 {
+		csvwin.SetComboBox("name", 2)
+	}
+
+	matchOptions := map[int64]string{0: "Name"}
+	for id, attributeType := range ui.Conatho.AttributeTypes {
+		matchOptions[id] = attributeType.Name
+	}
+	csvwin.AddLabel("Match entities on")
+	csvwin.AddComboBox("match", matchOptions)
+
+	csvwin.AddButton("Import", func(win *UIWindow) {
+		var mapping conatho.CSVConnectionMapping
+		for identifier, value := range map[string]*int{
+			"superior": &mapping.SuperiorColumn,
+			"inferior": &mapping.InferiorColumn,
+			"name":     &mapping.NameColumn,
+		} {
+			key, err := win.GetComboBox(identifier)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			*value = int(key)
+		}
+
+		match, err := win.GetComboBox("match")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		mapping.MatchAttribute = match
+
+		report, err := win.ui.Conatho.ImportCSVConnections(table, mapping)
+		if err != nil {
+			fmt.Println("Could not import:", err)
+			return
+		}
+		win.ui.OpenWindowReport("Import CSV Connections", report.String())
+	})
+	csvwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = csvwin
+}
@@ -0,0 +1,178 @@
+package ui
+
+import (
+	"connect-a-thon/conatho"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Conflicts shown at once, more are shown on further pages
+const mergeConflictsPerPage = 8
+
+// Maximum length of a value in the conflict choices
+const mergeValueWidth = 40
+
+func shortenValue(text string) string {
+	if utf8.RuneCountInString(text) > mergeValueWidth {
+		return string([]rune(text)[:mergeValueWidth-3]) + "..."
+	}
+	return text
+}
+
+func (ui *UI) OpenWindowMerge() {
+	ui.CloseWindow()
+
+	mergewin := ui.CreateWindow(100, 100, 200, 200)
+	mergewin.SetCenter(true)
+
+	mergewin.AddLabel("Merge")
+
+	mergewin.AddLabel("Their copy")
+	mergewin.AddInputField("theirs")
+	mergewin.AddButton("Choose", func(win *UIWindow) {
+		win.ui.OpenFileDialog("Conatho Files", "conatho", func(fPath string) {
+			win.SetInputField("theirs", fPath)
+		})
+	})
+
+	mergewin.AddLabel("Common base (optional)")
+	mergewin.AddInputField("base")
+	mergewin.AddButton("Choose", func(win *UIWindow) {
+		win.ui.OpenFileDialog("Conatho Files", "conatho", func(fPath string) {
+			win.SetInputField("base", fPath)
+		})
+	})
+
+	mergewin.AddLabel("Conflicts are shown before anything is changed")
+	mergewin.AddButton("Merge", func(win *UIWindow) {
+		merge, err := win.ui.prepareMerge(strings.TrimSpace(win.GetInputField("theirs")), strings.TrimSpace(win.GetInputField("base")))
+		if err != nil {
+			fmt.Println("Could not merge:", err)
+			return
+		}
+
+		if len(merge.Conflicts) > 0 {
+			win.ui.OpenWindowMergeConflicts(merge, 0)
+		} else {
+			win.ui.applyMerge(merge)
+		}
+	})
+	mergewin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = mergewin
+}
+
+func (ui *UI) prepareMerge(theirsPath, basePath string) (*conatho.Merge, error) {
+	theirs, err := openOtherConatho(theirsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer theirs.Close()
+
+	var base *conatho.Conatho
+	if basePath != "" {
+		base, err = openOtherConatho(basePath)
+		if err != nil {
+			return nil, err
+		}
+		defer base.Close()
+	}
+
+	return ui.Conatho.PrepareMerge(theirs, base)
+}
+
+// OpenWindowMergeConflicts lets the user choose between our and their version
+// of every conflict before merging, page is the page of conflicts shown
+func (ui *UI) OpenWindowMergeConflicts(merge *conatho.Merge, page int) {
+	ui.CloseWindow()
+
+	conflictwin := ui.CreateWindow(100, 100, 200, 200)
+	conflictwin.SetCenter(true)
+
+	pages := (len(merge.Conflicts) + mergeConflictsPerPage - 1) / mergeConflictsPerPage
+	first := page * mergeConflictsPerPage
+	last := min(first+mergeConflictsPerPage, len(merge.Conflicts))
+
+	conflictwin.AddLabel(fmt.Sprintf("Merge: %d conflicts", len(merge.Conflicts)))
+	if pages > 1 {
+		conflictwin.AddLabel(fmt.Sprintf("Page %d of %d", page+1, pages))
+	}
+
+	for i := first; i < last; i++ {
+		conflict := merge.Conflicts[i]
+		identifier := fmt.Sprintf("conflict%d", i)
+		conflictwin.AddLabel(conflict.Item + " " + conflict.Field)
+		conflictwin.AddComboBox(identifier, map[int64]string{
+			int64(conatho.KeepOurs):   "Keep ours: " + shortenValue(conflict.Ours),
+			int64(conatho.TakeTheirs): "Take theirs: " + shortenValue(conflict.Theirs),
+		})
+		conflictwin.SetComboBox(identifier, int64(conflict.Resolution))
+	}
+
+	// The choices of the page are kept when going to another page
+	resolve := func(win *UIWindow) bool {
+		for i := first; i < last; i++ {
+			resolution, err := win.GetComboBox(fmt.Sprintf("conflict%d", i))
+			if err != nil {
+				fmt.Println(err)
+				return false
+			}
+			merge.Conflicts[i].Resolution = conatho.Resolution(resolution)
+		}
+		return true
+	}
+
+	if page > 0 {
+		conflictwin.AddButton("Previous", func(win *UIWindow) {
+			if resolve(win) {
+				win.ui.OpenWindowMergeConflicts(merge, page-1)
+			}
+		})
+	}
+	if page < pages-1 {
+		conflictwin.AddButton("Next", func(win *UIWindow) {
+			if resolve(win) {
+				win.ui.OpenWindowMergeConflicts(merge, page+1)
+			}
+		})
+	}
+
+	conflictwin.AddButton("Merge", func(win *UIWindow) {
+		if resolve(win) {
+			win.ui.applyMerge(merge)
+		}
+	})
+	conflictwin.AddButton("Cancel", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = conflictwin
+}
+
+func (ui *UI) applyMerge(merge *conatho.Merge) {
+	changes := merge.Changes()
+
+	_, err := ui.Conatho.ApplyMerge(merge)
+	if err != nil {
+		fmt.Println("Could not merge:", err)
+		return
+	}
+
+	// All entities have been loaded again
+	ui.selectedEntity = nil
+	ui.action = ActionNone
+	ui.StopComparing()
+	ui.clearThumbnailCache()
+
+	report := strings.ReplaceAll(changes.String(), "\t", "    ")
+	if changes.Empty() {
+		report = "Nothing to merge"
+	}
+	for _, dropped := range merge.Dropped {
+		report += "Dropped " + dropped + "\n"
+	}
+	ui.OpenWindowReport("Merged", report)
+}
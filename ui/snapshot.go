@@ -0,0 +1,287 @@
+package ui
+
+import (
+	"connect-a-thon/conatho"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jupiterrider/purego-sdl3/sdl"
+	"github.com/jupiterrider/purego-sdl3/ttf"
+)
+
+// A snapshot shown read-only on the canvas, it is written to a temporary file
+// while the file it was taken of is kept open
+type snapshotView struct {
+	snapshot conatho.Snapshot
+	file     *conatho.Conatho
+	dir      string
+
+	globalX int32
+	globalY int32
+	zoom    float32
+}
+
+const snapshotTimeFormat = "2006-01-02 15:04"
+
+func snapshotLabel(s conatho.Snapshot) string {
+	return s.Created.Format(snapshotTimeFormat) + " " + s.Name
+}
+
+// ViewSnapshot shows the snapshot on the canvas until StopViewingSnapshot is
+// called, nothing can be changed in the meantime
+func (ui *UI) ViewSnapshot(s conatho.Snapshot) error {
+	ui.StopViewingSnapshot()
+
+	dir, err := os.MkdirTemp("", "connect-a-thon-snapshot")
+	if err != nil {
+		return err
+	}
+
+	con, err := ui.Conatho.SnapshotToFile(s.ID, filepath.Join(dir, "snapshot.conatho"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	ui.snapshot = &snapshotView{
+		snapshot: s,
+		file:     ui.Conatho,
+		dir:      dir,
+		globalX:  ui.GlobalX,
+		globalY:  ui.GlobalY,
+		zoom:     ui.Zoom,
+	}
+	ui.Conatho = con
+	ui.selectedEntity = nil
+	ui.action = ActionNone
+	ui.StopComparing()
+	ui.clearThumbnailCache()
+
+	return nil
+}
+
+// StopViewingSnapshot returns to the file the snapshot was taken of
+func (ui *UI) StopViewingSnapshot() {
+	if ui.snapshot == nil {
+		return
+	}
+
+	err := ui.Conatho.Close()
+	if err != nil {
+		fmt.Println("Could not close snapshot:", err)
+	}
+	err = os.RemoveAll(ui.snapshot.dir)
+	if err != nil {
+		fmt.Println("Could not remove snapshot:", err)
+	}
+
+	ui.Conatho = ui.snapshot.file
+	ui.GlobalX = ui.snapshot.globalX
+	ui.GlobalY = ui.snapshot.globalY
+	ui.Zoom = ui.snapshot.zoom
+	ui.snapshot = nil
+	ui.selectedEntity = nil
+	ui.action = ActionNone
+	ui.clearThumbnailCache()
+}
+
+// Banner below the menu bar telling which snapshot is shown
+func (ui *UI) renderSnapshotBanner() {
+	var rendererWidth int32
+	sdl.GetRenderOutputSize(ui.Renderer, &rendererWidth, nil)
+
+	height := ttf.GetFontHeight(ui.Font) + ui.menuBar.Padding*2
+	sdl.SetRenderDrawColor(ui.Renderer, 0, 60, 120, 255)
+	sdl.RenderFillRect(ui.Renderer, &sdl.FRect{
+		X: 0,
+		Y: float32(ui.menuBar.Height),
+		W: float32(rendererWidth),
+		H: float32(height),
+	})
+
+	label := "Snapshot " + snapshotLabel(ui.snapshot.snapshot) + " (read-only)"
+	text := ttf.CreateText(ui.TextEngine, ui.Font, label, 0)
+	ttf.DrawRendererText(text, float32(ui.menuBar.Padding), float32(ui.menuBar.Height+ui.menuBar.Padding))
+	ttf.DestroyText(text)
+
+	sdl.SetRenderDrawColor(ui.Renderer, 255, 255, 255, 255)
+}
+
+// The file snapshots are taken of and restored to
+func (ui *UI) snapshotFile() *conatho.Conatho {
+	if ui.snapshot != nil {
+		return ui.snapshot.file
+	}
+	return ui.Conatho
+}
+
+func (ui *UI) OpenWindowTakeSnapshot() {
+	ui.CloseWindow()
+
+	snapshotwin := ui.CreateWindow(100, 100, 200, 200)
+	snapshotwin.SetCenter(true)
+
+	snapshotwin.AddLabel("Take Snapshot")
+	snapshotwin.AddInputField("name")
+	snapshotwin.AddButton("Take", func(win *UIWindow) {
+		name := win.GetInputField("name")
+		if name == "" {
+			return
+		}
+
+		_, err := win.ui.snapshotFile().CreateSnapshot(name)
+		if err != nil {
+			fmt.Println("Could not take snapshot:", err)
+			return
+		}
+		win.ui.CloseWindow()
+	})
+	snapshotwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = snapshotwin
+}
+
+func (ui *UI) OpenWindowSnapshots() {
+	ui.CloseWindow()
+
+	snapshotwin := ui.CreateWindow(100, 100, 200, 200)
+	snapshotwin.SetCenter(true)
+
+	snapshots, err := ui.snapshotFile().GetSnapshots()
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	snapshotwin.AddLabel("Snapshots")
+	if ui.snapshot != nil {
+		snapshotwin.AddLabel("Viewing " + snapshotLabel(ui.snapshot.snapshot))
+	}
+
+	if len(snapshots) == 0 {
+		snapshotwin.AddLabel("No snapshots")
+	} else {
+		options := make(map[int64]string)
+		for i, s := range snapshots {
+			options[int64(i)] = snapshotLabel(s)
+		}
+		snapshotwin.AddComboBox("snapshot", options)
+
+		selected := func(win *UIWindow) (conatho.Snapshot, bool) {
+			i, err := win.GetComboBox("snapshot")
+			if err != nil {
+				fmt.Println(err)
+				return conatho.Snapshot{}, false
+			}
+			return snapshots[i], true
+		}
+
+		snapshotwin.AddButton("View", func(win *UIWindow) {
+			s, ok := selected(win)
+			if !ok {
+				return
+			}
+			err := win.ui.ViewSnapshot(s)
+			if err != nil {
+				fmt.Println("Could not view snapshot:", err)
+				return
+			}
+			win.ui.CloseWindow()
+		})
+		snapshotwin.AddButton("Restore", func(win *UIWindow) {
+			s, ok := selected(win)
+			if !ok {
+				return
+			}
+			win.ui.OpenWindowRestoreSnapshot(s)
+		})
+		snapshotwin.AddButton("Branch", func(win *UIWindow) {
+			s, ok := selected(win)
+			if !ok {
+				return
+			}
+			win.ui.SaveFileDialog("Conatho Files", "conatho", func(fPath string) {
+				win.ui.branchSnapshot(s, fPath)
+			})
+		})
+		snapshotwin.AddButton("Delete", func(win *UIWindow) {
+			s, ok := selected(win)
+			if !ok {
+				return
+			}
+			if win.ui.snapshot != nil && win.ui.snapshot.snapshot.ID == s.ID {
+				win.ui.StopViewingSnapshot()
+			}
+			err := win.ui.snapshotFile().DeleteSnapshot(s.ID)
+			if err != nil {
+				fmt.Println(err)
+			}
+			win.ui.OpenWindowSnapshots()
+		})
+	}
+
+	if ui.snapshot != nil {
+		snapshotwin.AddLabel("Changes can only be made to the file")
+		snapshotwin.AddButton("Back to File", func(win *UIWindow) {
+			win.ui.StopViewingSnapshot()
+			win.ui.CloseWindow()
+		})
+	}
+	snapshotwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = snapshotwin
+}
+
+// OpenWindowRestoreSnapshot asks before replacing the contents of the file
+func (ui *UI) OpenWindowRestoreSnapshot(s conatho.Snapshot) {
+	ui.CloseWindow()
+
+	restorewin := ui.CreateWindow(100, 100, 200, 200)
+	restorewin.SetCenter(true)
+
+	restorewin.AddLabel("Restore " + snapshotLabel(s))
+	restorewin.AddLabel("Everything changed since will be lost,")
+	restorewin.AddLabel("take a snapshot first to keep it.")
+
+	restorewin.AddButton("Restore", func(win *UIWindow) {
+		win.ui.StopViewingSnapshot()
+
+		_, err := win.ui.Conatho.RestoreSnapshot(s.ID)
+		if err != nil {
+			fmt.Println("Could not restore snapshot:", err)
+			return
+		}
+
+		// All entities have been loaded again
+		win.ui.selectedEntity = nil
+		win.ui.action = ActionNone
+		win.ui.StopComparing()
+		win.ui.clearThumbnailCache()
+		win.ui.CloseWindow()
+	})
+	restorewin.AddButton("Cancel", func(win *UIWindow) {
+		win.ui.OpenWindowSnapshots()
+	})
+
+	ui.window = restorewin
+}
+
+// Write the snapshot to a new file and open it, existing files are never
+// overwritten
+func (ui *UI) branchSnapshot(s conatho.Snapshot, fPath string) {
+	branch, err := ui.snapshotFile().SnapshotToFile(s.ID, fPath)
+	if err != nil {
+		fmt.Println("Could not branch snapshot:", err)
+		return
+	}
+	branch.Close()
+
+	err = ui.LoadConatho(fPath)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jupiterrider/purego-sdl3/sdl"
+)
+
+// Thumbnails are made large enough to zoom in to twice the size without
+// getting blurry
+const thumbnailZoom = 2
+
+// Delete unused images and shrink the file
+func (ui *UI) compact() {
+	report, err := ui.Conatho.Compact()
+	if err != nil {
+		fmt.Println("Could not compact file:", err)
+		return
+	}
+	ui.OpenWindowReport("Compact", report.String())
+}
+
+// Make thumbnails as large as the thumbnail on a card is shown on this
+// display, unless set in the config
+func (ui *UI) setThumbnailSize() {
+	if ui.Config != nil && ui.Config.ThumbnailSize > 0 {
+		ui.Conatho.ThumbnailSize = ui.Config.ThumbnailSize
+		return
+	}
+
+	scale := sdl.GetWindowDisplayScale(ui.Window)
+	if scale <= 0 {
+		scale = 1
+	}
+	size := float64(max(ui.EntityThumbWidth, ui.EntityThumbHeight)) * float64(scale) * thumbnailZoom
+	ui.Conatho.ThumbnailSize = int(math.Ceil(size))
+}
+
+// Make all thumbnails again at the current thumbnail size
+func (ui *UI) regenerateThumbnails() {
+	ui.setThumbnailSize()
+	n, err := ui.Conatho.RegenerateThumbnails()
+	if err != nil {
+		fmt.Println("Could not regenerate thumbnails:", err)
+		return
+	}
+	ui.clearThumbnailCache()
+	ui.OpenWindowReport("Regenerate Thumbnails", fmt.Sprintf("Made %d thumbnails of %d x %d pixels", n, ui.Conatho.ThumbnailSize, ui.Conatho.ThumbnailSize))
+}
@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"connect-a-thon/conatho"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const trashTimeFormat = "2006-01-02 15:04"
+
+// Remove what has been in the trash longer than the configured retention
+func (ui *UI) purgeTrash() {
+	if ui.Config == nil || ui.Config.TrashRetentionDays <= 0 {
+		return
+	}
+
+	before := time.Now().AddDate(0, 0, -ui.Config.TrashRetentionDays)
+	_, err := ui.Conatho.PurgeTrash(before)
+	if err != nil {
+		fmt.Println("Could not purge trash:", err)
+	}
+}
+
+// OpenWindowDeleteEntity asks before moving the entity to the trash
+func (ui *UI) OpenWindowDeleteEntity(e *conatho.Entity) {
+	ui.CloseWindow()
+
+	deletewin := ui.CreateWindow(100, 100, 200, 200)
+	deletewin.SetCenter(true)
+
+	deletewin.AddLabel("Move " + strconv.Quote(e.Name) + " to the trash?")
+	deletewin.AddLabel(fmt.Sprintf("Its %d connections go with it.", len(e.Connections)))
+
+	deletewin.AddButton("Delete", func(win *UIWindow) {
+		err := e.Delete()
+		if err != nil {
+			fmt.Println("Could not delete entity:", err)
+			return
+		}
+		if win.ui.selectedEntity == e {
+			win.ui.selectedEntity = nil
+		}
+		win.ui.CloseWindow()
+	})
+	deletewin.AddButton("Cancel", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = deletewin
+}
+
+func (ui *UI) OpenWindowTrash() {
+	ui.CloseWindow()
+
+	trashwin := ui.CreateWindow(100, 100, 200, 200)
+	trashwin.SetCenter(true)
+	trashwin.Name = "trash"
+
+	trash, err := ui.Conatho.GetTrash()
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	trashwin.AddLabel("Trash")
+
+	if trash.Empty() {
+		trashwin.AddLabel("The trash is empty")
+	} else {
+		// Entities first, then connections
+		options := make(map[int64]string)
+		for i, te := range trash.Entities {
+			options[int64(i)] = te.DeletedAt.Format(trashTimeFormat) + " " + te.Name
+		}
+		for i, tc := range trash.Connections {
+			options[int64(len(trash.Entities)+i)] = fmt.Sprintf("%s %s -> %s %s",
+				tc.DeletedAt.Format(trashTimeFormat), tc.SuperiorName, tc.InferiorName, tc.Name)
+		}
+		trashwin.AddComboBox("item", options)
+
+		trashwin.AddButton("Restore", func(win *UIWindow) {
+			i, err := win.GetComboBox("item")
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			if i < int64(len(trash.Entities)) {
+				// All entities are loaded again
+				win.ui.selectedEntity = nil
+				win.ui.action = ActionNone
+				err = win.ui.Conatho.RestoreEntity(trash.Entities[i].ID)
+			} else {
+				err = win.ui.Conatho.RestoreConnection(trash.Connections[i-int64(len(trash.Entities))].ID)
+			}
+			if err != nil {
+				fmt.Println("Could not restore:", err)
+				return
+			}
+			win.ui.OpenWindowTrash()
+		})
+		trashwin.AddButton("Empty Trash", func(win *UIWindow) {
+			_, err := win.ui.Conatho.EmptyTrash()
+			if err != nil {
+				fmt.Println("Could not empty trash:", err)
+				return
+			}
+			win.ui.OpenWindowTrash()
+		})
+	}
+
+	if ui.Config != nil {
+		trashwin.AddLabel("Days to keep deleted items, 0 keeps them")
+		trashwin.AddInputField("retention")
+		trashwin.SetInputField("retention", strconv.Itoa(ui.Config.TrashRetentionDays))
+		trashwin.AddButton("Save", func(win *UIWindow) {
+			days, err := strconv.Atoi(win.GetInputField("retention"))
+			if err != nil || days < 0 {
+				fmt.Println("Invalid number of days")
+				return
+			}
+
+			win.ui.Config.TrashRetentionDays = days
+			err = win.ui.Config.Save()
+			if err != nil {
+				fmt.Println("Could not save config:", err)
+				return
+			}
+			win.ui.purgeTrash()
+			win.ui.OpenWindowTrash()
+		})
+	}
+
+	trashwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = trashwin
+}
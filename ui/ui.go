@@ -2,10 +2,15 @@ package ui
 
 import (
 	"connect-a-thon/conatho"
+	"connect-a-thon/config"
+	"connect-a-thon/layout"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
-	"unsafe"
+	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/jupiterrider/purego-sdl3/img"
@@ -34,11 +39,13 @@ const (
 type MenuBarSubMenuItem struct {
 	Name     string
 	Function func()
+	Edits    bool // Not available while viewing a snapshot
 }
 
 type MenuBarSubMenu struct {
 	Name    string
 	Items   []MenuBarSubMenuItem
+	Edits   bool // All items change the file
 	X1      int32
 	X2      int32
 	texture *sdl.Texture
@@ -54,15 +61,12 @@ type MenuBar struct {
 type UI struct {
 	GlobalX int32
 	GlobalY int32
+	Zoom    float32
 
-	EntityWidth       int32
-	EntityHeight      int32
-	EntityPadding     int32
-	EntityHandleSize  int32
-	EntityThumbWidth  int32
-	EntityThumbHeight int32
+	layout.Layout
 
 	Conatho *conatho.Conatho
+	Config  *config.Config
 	// Entities     map[uuid.UUID]*conatho.Entity
 	// EntitiesKeys []uuid.UUID
 
@@ -77,6 +81,9 @@ type UI struct {
 	selectedEntity *conatho.Entity
 	savedPosX      int32
 	savedPosY      int32
+	// Fraction of a pixel not yet moved by the current drag
+	dragRemX float32
+	dragRemY float32
 
 	window *UIWindow
 
@@ -84,24 +91,37 @@ type UI struct {
 
 	menuBar            MenuBar
 	menuBarOpenSubMenu int
+
+	// Functions queued from other threads, like file dialog callbacks
+	mainThread     []func()
+	mainThreadLock sync.Mutex
+
+	dialogFunction func(fPath string)
+
+	comparison *comparison
+
+	snapshot *snapshotView
+
+	// Files dropped so far by the current drag and drop
+	dropped int32
+	// Files of the current drag and drop that could not be used, reported
+	// once all are dropped
+	dropFailures []string
 }
 
-func NewUI(window *sdl.Window, renderer *sdl.Renderer, textEngine *ttf.TextEngine, font *ttf.Font) *UI {
+func NewUI(window *sdl.Window, renderer *sdl.Renderer, textEngine *ttf.TextEngine, font *ttf.Font, cfg *config.Config) *UI {
 	ui := UI{
 		GlobalX: 0,
 		GlobalY: 0,
+		Zoom:    1,
 
-		EntityWidth:       150,
-		EntityHeight:      200,
-		EntityPadding:     4,
-		EntityHandleSize:  6,
-		EntityThumbWidth:  128,
-		EntityThumbHeight: 128,
+		Layout: layout.Default(),
 
 		Window:         window,
 		Renderer:       renderer,
 		TextEngine:     textEngine,
 		Font:           font,
+		Config:         cfg,
 		ThumbnailCache: make(map[uuid.UUID]*sdl.Texture),
 
 		action: ActionNone,
@@ -117,6 +137,7 @@ func (ui *UI) OpenWindowAdd() {
 
 	addwin := ui.CreateWindow(100, 100, 200, 200)
 	addwin.SetCenter(true)
+	addwin.Name = "add"
 
 	addwin.AddLabel("Add Entity")
 	addwin.AddInputField("name")
@@ -145,26 +166,16 @@ func (ui *UI) OpenWindowImageSelect() {
 	imgwin.SetCenter(true)
 	imgwin.AddLabel("Select Image")
 	imgwin.AddInputField("imagePath")
-	imgwin.AddButton("Add", func(win *UIWindow) {
+	imgwin.AddButton("Browse", func(win *UIWindow) {
+		e := win.ui.selectedEntity
+		win.ui.OpenFileDialog("Images", imageFilePattern, func(fPath string) {
+			win.ui.openImageFile(e, fPath)
+		})
+	})
+	imgwin.AddButton("Open", func(win *UIWindow) {
 		imagePath := win.GetInputField("imagePath")
-		f, err := os.Open(imagePath)
-		if err != nil {
-			fmt.Println("Could not open file:", err.Error())
-			return
-		}
-
-		err = win.ui.selectedEntity.EntityAddImage(f)
-		if err != nil {
-			fmt.Println(err.Error())
-		}
-
-		err = win.ui.updateThumbnail(win.ui.selectedEntity)
-		if err != nil {
-			panic(err.Error())
-		}
-
 		win.SetInputField("imagePath", "")
-		win.ui.CloseWindow()
+		win.ui.openImageFile(win.ui.selectedEntity, imagePath)
 	})
 	imgwin.AddButton("Close", func(win *UIWindow) {
 		win.SetInputField("imagePath", "")
@@ -174,11 +185,16 @@ func (ui *UI) OpenWindowImageSelect() {
 	ui.window = imgwin
 }
 
+const entityTimeFormat = "2006-01-02 15:04"
+
 func (ui *UI) OpenWindowEdit(e *conatho.Entity) {
 	ui.CloseWindow()
 
+	ui.selectedEntity = e
+
 	editwin := ui.CreateWindow(100, 100, 200, 200)
 	editwin.SetCenter(true)
+	editwin.Name = "edit"
 
 	image, err := e.EntityGetImage()
 	if err == nil {
@@ -196,6 +212,13 @@ func (ui *UI) OpenWindowEdit(e *conatho.Entity) {
 		editwin.AddImage(texture, displayWidth, displayHeight)
 	}
 
+	if !e.CreatedAt.IsZero() {
+		editwin.AddLabel("Created " + e.CreatedAt.Format(entityTimeFormat))
+	}
+	if !e.UpdatedAt.IsZero() {
+		editwin.AddLabel("Changed " + e.UpdatedAt.Format(entityTimeFormat))
+	}
+
 	attributes, err := e.GetAttributes()
 	if err != nil {
 		fmt.Println(err)
@@ -242,6 +265,12 @@ func (ui *UI) OpenWindowEdit(e *conatho.Entity) {
 		}
 		win.ui.CloseWindow()
 	})
+	editwin.AddButton("Gallery", func(win *UIWindow) {
+		win.ui.OpenWindowGallery(e, 0)
+	})
+	editwin.AddButton("History", func(win *UIWindow) {
+		win.ui.OpenWindowHistory(e)
+	})
 	editwin.AddButton("Close", func(win *UIWindow) {
 		win.ui.CloseWindow()
 	})
@@ -280,11 +309,134 @@ func (ui *UI) OpenWindowAddAttribute(e *conatho.Entity) {
 	ui.window = attrwin
 }
 
+func (ui *UI) OpenWindowRecent() {
+	ui.CloseWindow()
+
+	recentwin := ui.CreateWindow(100, 100, 200, 200)
+	recentwin.SetCenter(true)
+	recentwin.Name = "recent"
+
+	recentwin.AddLabel("Open Recent")
+	if ui.Config == nil || len(ui.Config.RecentFiles) == 0 {
+		recentwin.AddLabel("No recent files")
+	} else {
+		options := make(map[int64]string)
+		for i, fPath := range ui.Config.RecentFiles {
+			options[int64(i)] = fPath
+		}
+		recentwin.AddComboBox("file", options)
+
+		recentwin.AddButton("Open", func(win *UIWindow) {
+			i, err := win.GetComboBox("file")
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fPath := win.ui.Config.RecentFiles[i]
+			win.ui.CloseWindow()
+
+			err = win.ui.LoadConatho(fPath)
+			if err != nil {
+				fmt.Println(err)
+			}
+		})
+	}
+
+	recentwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = recentwin
+}
+
+func (ui *UI) OpenWindowAddBookmark() {
+	ui.CloseWindow()
+
+	bookmarkwin := ui.CreateWindow(100, 100, 200, 200)
+	bookmarkwin.SetCenter(true)
+
+	bookmarkwin.AddLabel("Add Bookmark")
+	bookmarkwin.AddInputField("name")
+	bookmarkwin.AddButton("Add", func(win *UIWindow) {
+		name := win.GetInputField("name")
+		if name == "" {
+			return
+		}
+
+		_, err := win.ui.Conatho.AddBookmark(name, win.ui.GlobalX, win.ui.GlobalY, win.ui.Zoom)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		win.ui.CloseWindow()
+	})
+	bookmarkwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = bookmarkwin
+}
+
+func (ui *UI) OpenWindowBookmarks() {
+	ui.CloseWindow()
+
+	bookmarkwin := ui.CreateWindow(100, 100, 200, 200)
+	bookmarkwin.SetCenter(true)
+	bookmarkwin.Name = "bookmarks"
+
+	bookmarks, err := ui.Conatho.GetBookmarks()
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	bookmarkwin.AddLabel("Bookmarks")
+	if len(bookmarks) == 0 {
+		bookmarkwin.AddLabel("No bookmarks")
+	} else {
+		options := make(map[int64]string)
+		for i, b := range bookmarks {
+			options[int64(i)] = b.Name
+		}
+		bookmarkwin.AddComboBox("bookmark", options)
+
+		bookmarkwin.AddButton("Go", func(win *UIWindow) {
+			i, err := win.GetComboBox("bookmark")
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			win.ui.GlobalX = bookmarks[i].X
+			win.ui.GlobalY = bookmarks[i].Y
+			win.ui.Zoom = bookmarks[i].Zoom
+			win.ui.CloseWindow()
+		})
+		bookmarkwin.AddButton("Delete", func(win *UIWindow) {
+			i, err := win.GetComboBox("bookmark")
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			err = win.ui.Conatho.RemoveBookmark(bookmarks[i].ID)
+			if err != nil {
+				fmt.Println(err)
+			}
+			win.ui.OpenWindowBookmarks()
+		})
+	}
+
+	bookmarkwin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = bookmarkwin
+}
+
 func (ui *UI) OpenWindowCreateType() {
 	ui.CloseWindow()
 
 	attrwin := ui.CreateWindow(100, 100, 200, 200)
 	attrwin.SetCenter(true)
+	attrwin.Name = "createType"
 
 	options := make(map[int64]string)
 	for k, v := range ui.Conatho.AttributeTypes {
@@ -303,6 +455,9 @@ func (ui *UI) OpenWindowCreateType() {
 		int64(conatho.DatatypeData):   "Data",
 	})
 
+	attrwin.AddLabel("Unique key")
+	attrwin.AddComboBox("key", map[int64]string{0: "No", 1: "Yes"})
+
 	attrwin.AddButton("Add", func(win *UIWindow) {
 		name := win.GetInputField("name")
 
@@ -311,7 +466,23 @@ func (ui *UI) OpenWindowCreateType() {
 			fmt.Println(err)
 			return
 		}
-		win.ui.Conatho.AddAttributeType(name, conatho.Datatype(datatype))
+		key, err := attrwin.GetComboBox("key")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		id, err := win.ui.Conatho.AddAttributeType(name, conatho.Datatype(datatype))
+		if err != nil {
+			fmt.Println("Could not add type:", err)
+			return
+		}
+		if key == 1 {
+			err = win.ui.Conatho.SetAttributeTypeKey(id, true)
+			if err != nil {
+				fmt.Println("Could not mark type as key:", err)
+			}
+		}
 		win.ui.CloseWindow()
 	})
 
@@ -322,6 +493,64 @@ func (ui *UI) OpenWindowCreateType() {
 	ui.window = attrwin
 }
 
+func (ui *UI) OpenWindowUniqueKeys() {
+	ui.CloseWindow()
+
+	keywin := ui.CreateWindow(100, 100, 200, 200)
+	keywin.SetCenter(true)
+
+	options := make(map[int64]string)
+	for k, v := range ui.Conatho.AttributeTypes {
+		if v.Type == conatho.DatatypeData {
+			continue
+		}
+		if v.Key {
+			options[k] = v.Name + " (key)"
+		} else {
+			options[k] = v.Name
+		}
+	}
+
+	keywin.AddLabel("Unique Keys")
+	if len(options) == 0 {
+		keywin.AddLabel("No number or string attribute types")
+		keywin.AddButton("Close", func(win *UIWindow) {
+			win.ui.CloseWindow()
+		})
+		ui.window = keywin
+		return
+	}
+
+	keywin.AddLabel("Type")
+	keywin.AddComboBox("type", options)
+
+	setKey := func(win *UIWindow, key bool) {
+		id, err := win.GetComboBox("type")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		err = win.ui.Conatho.SetAttributeTypeKey(id, key)
+		if err != nil {
+			fmt.Println("Could not change key:", err)
+			return
+		}
+		win.ui.OpenWindowUniqueKeys()
+	}
+
+	keywin.AddButton("Mark as Key", func(win *UIWindow) {
+		setKey(win, true)
+	})
+	keywin.AddButton("Unmark", func(win *UIWindow) {
+		setKey(win, false)
+	})
+	keywin.AddButton("Close", func(win *UIWindow) {
+		win.ui.CloseWindow()
+	})
+
+	ui.window = keywin
+}
+
 func (ui *UI) CloseWindow() {
 	if ui.window != nil {
 		ui.window.Destroy()
@@ -334,7 +563,13 @@ func (ui *UI) LoadConatho(fPath string) error {
 	if err != nil {
 		return err
 	}
+
+	ui.SaveViewState()
+	ui.CloseWindow()
+	ui.StopComparing()
 	ui.Conatho = &con
+	ui.setAuthor()
+	ui.setThumbnailSize()
 
 	err = con.EntityGetAll()
 	if err != nil {
@@ -346,9 +581,106 @@ func (ui *UI) LoadConatho(fPath string) error {
 		panic(err.Error())
 	}
 
+	ui.purgeTrash()
+	ui.addRecentFile(fPath)
+	ui.restoreViewState()
+
 	return nil
 }
 
+// SaveViewState stores the viewport, selection and open panel in the file
+func (ui *UI) SaveViewState() {
+	ui.StopViewingSnapshot()
+	if ui.Conatho == nil {
+		return
+	}
+
+	v := conatho.ViewState{
+		X:    ui.GlobalX,
+		Y:    ui.GlobalY,
+		Zoom: ui.Zoom,
+	}
+	if ui.selectedEntity != nil {
+		v.Selected = ui.selectedEntity.ID
+	}
+	if ui.window != nil {
+		v.Panel = ui.window.Name
+	}
+
+	err := ui.Conatho.SaveViewState(v)
+	if err != nil {
+		fmt.Println("Could not save view state:", err)
+	}
+}
+
+func (ui *UI) restoreViewState() {
+	v, err := ui.Conatho.GetViewState()
+	if err != nil {
+		fmt.Println("Could not load view state:", err)
+	}
+
+	ui.GlobalX = v.X
+	ui.GlobalY = v.Y
+	ui.Zoom = min(max(v.Zoom, minZoom), maxZoom)
+	ui.action = ActionNone
+	ui.selectedEntity = ui.Conatho.Entities[v.Selected]
+
+	switch v.Panel {
+	case "add":
+		ui.OpenWindowAdd()
+	case "edit":
+		if ui.selectedEntity != nil {
+			ui.OpenWindowEdit(ui.selectedEntity)
+		}
+	case "recent":
+		ui.OpenWindowRecent()
+	case "bookmarks":
+		ui.OpenWindowBookmarks()
+	case "createType":
+		ui.OpenWindowCreateType()
+	case "trash":
+		ui.OpenWindowTrash()
+	}
+}
+
+// RunOnMainThread queues a function to be run before the next frame is
+// rendered, SDL rendering functions must only be called from the main thread
+func (ui *UI) RunOnMainThread(fn func()) {
+	ui.mainThreadLock.Lock()
+	ui.mainThread = append(ui.mainThread, fn)
+	ui.mainThreadLock.Unlock()
+}
+
+func (ui *UI) runMainThread() {
+	ui.mainThreadLock.Lock()
+	queue := ui.mainThread
+	ui.mainThread = nil
+	ui.mainThreadLock.Unlock()
+
+	for _, fn := range queue {
+		fn()
+	}
+}
+
+// Changes to the file are recorded under the author from the config
+func (ui *UI) setAuthor() {
+	if ui.Config != nil {
+		ui.Conatho.Author = ui.Config.AuthorName()
+	}
+}
+
+func (ui *UI) addRecentFile(fPath string) {
+	if ui.Config == nil {
+		return
+	}
+
+	ui.Config.AddRecentFile(fPath)
+	err := ui.Config.Save()
+	if err != nil {
+		fmt.Println("Could not save config:", err)
+	}
+}
+
 var backgroundTexture *sdl.Texture
 
 func initBackgroundTexture(renderer *sdl.Renderer) *sdl.Texture {
@@ -374,6 +706,8 @@ func (ui *UI) renderBackground() {
 		backgroundTexture = initBackgroundTexture(ui.Renderer)
 	}
 	sdl.GetRenderOutputSize(ui.Renderer, &rendererWidth, &rendererHeight)
+	rendererWidth = int32(float32(rendererWidth) / ui.Zoom)
+	rendererHeight = int32(float32(rendererHeight) / ui.Zoom)
 
 	dstrect := sdl.FRect{
 		X: float32(ui.GlobalX%backgroundTexture.W - backgroundTexture.W),
@@ -435,6 +769,78 @@ func GenerateMenuTexture(renderer *sdl.Renderer, font *ttf.Font, items []string,
 }
 
 func (ui *UI) MakeMenuBar() {
+	// Listed both in their own menu and under "File → Export"
+	exportItems := []MenuBarSubMenuItem{
+		MenuBarSubMenuItem{
+			Name: "DOT",
+			Function: func() {
+				if ui.Conatho != nil {
+					ui.OpenWindowExportDOT()
+				}
+			},
+		},
+		MenuBarSubMenuItem{
+			Name: "SVG",
+			Function: func() {
+				if ui.Conatho != nil {
+					ui.OpenWindowExportSVG()
+				}
+			},
+		},
+		MenuBarSubMenuItem{
+			Name: "GraphML",
+			Function: func() {
+				if ui.Conatho == nil {
+					return
+				}
+				ui.SaveFileDialog("GraphML Files", "graphml", func(fPath string) {
+					exportToFile(fPath, func(f *os.File) error {
+						return ui.Conatho.ExportGraphML(f)
+					})
+				})
+			},
+		},
+		MenuBarSubMenuItem{
+			Name: "GEDCOM",
+			Function: func() {
+				if ui.Conatho == nil {
+					return
+				}
+				ui.SaveFileDialog("GEDCOM Files", "ged", func(fPath string) {
+					exportToFile(fPath, func(f *os.File) error {
+						return ui.Conatho.ExportGEDCOM(f)
+					})
+				})
+			},
+		},
+		MenuBarSubMenuItem{
+			Name: "JSON",
+			Function: func() {
+				if ui.Conatho == nil {
+					return
+				}
+				ui.SaveFileDialog("JSON Files", "json", func(fPath string) {
+					exportToFile(fPath, func(f *os.File) error {
+						return ui.Conatho.Export(f)
+					})
+				})
+			},
+		},
+		MenuBarSubMenuItem{
+			Name: "Archive",
+			Function: func() {
+				if ui.Conatho == nil {
+					return
+				}
+				ui.SaveFileDialog("Connect-a-thon Archives", "zip", func(fPath string) {
+					exportToFile(fPath, func(f *os.File) error {
+						return ui.Conatho.ExportArchive(f)
+					})
+				})
+			},
+		},
+	}
+
 	ui.menuBar = MenuBar{
 		SubMenus: []MenuBarSubMenu{
 			MenuBarSubMenu{
@@ -443,36 +849,75 @@ func (ui *UI) MakeMenuBar() {
 					MenuBarSubMenuItem{
 						Name: "New",
 						Function: func() {
-							callback := sdl.NewDialogFileCallback(func(userdata unsafe.Pointer, filelist []string, filter int32) {
-								if len(filelist) > 0 {
-									con, err := conatho.New(filelist[0])
-									if err != nil {
-										fmt.Println(err)
-									} else {
-										ui.Conatho = &con
-									}
+							ui.SaveFileDialog("Conatho Files", "conatho", func(fPath string) {
+								con, err := conatho.New(fPath)
+								if err != nil {
+									fmt.Println(err)
+								} else {
+									ui.SaveViewState()
+									ui.CloseWindow()
+									ui.StopComparing()
+									ui.Conatho = &con
+									ui.setAuthor()
+									ui.setThumbnailSize()
+									ui.GlobalX = 0
+									ui.GlobalY = 0
+									ui.Zoom = 1
+									ui.selectedEntity = nil
+									ui.addRecentFile(fPath)
 								}
 							})
-							sdl.NewDialogFileFilter("Conatho Files", "conatho")
-							sdl.ShowSaveFileDialog(callback, nil, ui.Window, []sdl.DialogFileFilter{
-								sdl.NewDialogFileFilter("Conatho Files", "conatho"),
-								sdl.NewDialogFileFilter("All Files", "*"),
-							}, "")
 						},
 					},
 					MenuBarSubMenuItem{
 						Name: "Open",
 						Function: func() {
-							callback := sdl.NewDialogFileCallback(func(userdata unsafe.Pointer, filelist []string, filter int32) {
-								if len(filelist) > 0 {
-									ui.LoadConatho(filelist[0])
+							ui.OpenFileDialog("Conatho Files", "conatho", func(fPath string) {
+								err := ui.LoadConatho(fPath)
+								if err != nil {
+									fmt.Println(err)
 								}
 							})
-							sdl.NewDialogFileFilter("Conatho Files", "conatho")
-							sdl.ShowOpenFileDialog(callback, nil, ui.Window, []sdl.DialogFileFilter{
-								sdl.NewDialogFileFilter("Conatho Files", "conatho"),
-								sdl.NewDialogFileFilter("All Files", "*"),
-							}, "", false)
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Open Recent",
+						Function: func() {
+							ui.OpenWindowRecent()
+						},
+					},
+					MenuBarSubMenuItem{
+						Name:  "Merge",
+						Edits: true,
+						Function: func() {
+							if ui.Conatho != nil {
+								ui.OpenWindowMerge()
+							}
+						},
+					},
+					MenuBarSubMenuItem{
+						Name:  "Trash",
+						Edits: true,
+						Function: func() {
+							if ui.Conatho != nil {
+								ui.OpenWindowTrash()
+							}
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Export",
+						Function: func() {
+							if ui.Conatho != nil {
+								ui.OpenWindowExport(exportItems)
+							}
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Export Image",
+						Function: func() {
+							if ui.Conatho != nil {
+								ui.OpenWindowExportImage()
+							}
 						},
 					},
 					MenuBarSubMenuItem{
@@ -484,7 +929,193 @@ func (ui *UI) MakeMenuBar() {
 				},
 			},
 			MenuBarSubMenu{
-				Name: "Attributes",
+				Name:  "Import",
+				Edits: true,
+				Items: []MenuBarSubMenuItem{
+					MenuBarSubMenuItem{
+						Name: "GraphML",
+						Function: func() {
+							if ui.Conatho == nil {
+								return
+							}
+							ui.OpenFileDialog("GraphML Files", "graphml;xml", func(fPath string) {
+								ui.importFromFile(fPath, "Import GraphML", ui.Conatho.ImportGraphML)
+							})
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "GEDCOM",
+						Function: func() {
+							if ui.Conatho == nil {
+								return
+							}
+							ui.OpenFileDialog("GEDCOM Files", "ged", func(fPath string) {
+								ui.importFromFile(fPath, "Import GEDCOM", ui.Conatho.ImportGEDCOM)
+							})
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "JSON",
+						Function: func() {
+							if ui.Conatho == nil {
+								return
+							}
+							ui.OpenFileDialog("JSON Files", "json", func(fPath string) {
+								ui.importFromFile(fPath, "Import JSON", func(r io.Reader) (conatho.ImportReport, error) {
+									return ui.Conatho.ImportWithFiles(r, filepath.Dir(fPath))
+								})
+							})
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "JSON (Dry Run)",
+						Function: func() {
+							if ui.Conatho == nil {
+								return
+							}
+							ui.OpenFileDialog("JSON Files", "json", func(fPath string) {
+								ui.dryRunFromFile(fPath, "Import JSON", func(r io.Reader) (conatho.ImportReport, error) {
+									return ui.Conatho.ImportWithFiles(r, filepath.Dir(fPath))
+								})
+							})
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Archive",
+						Function: func() {
+							if ui.Conatho == nil {
+								return
+							}
+							ui.OpenFileDialog("Connect-a-thon Archives", "zip", func(fPath string) {
+								ui.importFromFile(fPath, "Import Archive", ui.Conatho.ImportArchive)
+							})
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "CSV Entities",
+						Function: func() {
+							if ui.Conatho == nil {
+								return
+							}
+							ui.OpenFileDialog("CSV Files", "csv", func(fPath string) {
+								if table, ok := ui.openCSV(fPath); ok {
+									ui.OpenWindowImportCSVEntities(table)
+								}
+							})
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "CSV Connections",
+						Function: func() {
+							if ui.Conatho == nil {
+								return
+							}
+							ui.OpenFileDialog("CSV Files", "csv", func(fPath string) {
+								if table, ok := ui.openCSV(fPath); ok {
+									ui.OpenWindowImportCSVConnections(table)
+								}
+							})
+						},
+					},
+				},
+			},
+			MenuBarSubMenu{
+				Name:  "Export",
+				Items: exportItems,
+			},
+			MenuBarSubMenu{
+				Name: "View",
+				Items: []MenuBarSubMenuItem{
+					MenuBarSubMenuItem{
+						Name:  "Add Bookmark",
+						Edits: true,
+						Function: func() {
+							if ui.Conatho != nil {
+								ui.OpenWindowAddBookmark()
+							}
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Bookmarks",
+						Function: func() {
+							if ui.Conatho != nil {
+								ui.OpenWindowBookmarks()
+							}
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Compare With File",
+						Function: func() {
+							if ui.Conatho == nil {
+								return
+							}
+							ui.OpenFileDialog("Conatho Files", "conatho", func(fPath string) {
+								err := ui.CompareWith(fPath)
+								if err != nil {
+									fmt.Println("Could not compare:", err)
+									return
+								}
+								ui.OpenWindowChanges()
+							})
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Changes",
+						Function: func() {
+							ui.OpenWindowChanges()
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Mark Recent Changes",
+						Function: func() {
+							if ui.Config == nil {
+								return
+							}
+							ui.Config.MarkRecentChanges = !ui.Config.MarkRecentChanges
+							err := ui.Config.Save()
+							if err != nil {
+								fmt.Println("Could not save config:", err)
+							}
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Reset Zoom",
+						Function: func() {
+							ui.Zoom = 1
+						},
+					},
+				},
+			},
+			MenuBarSubMenu{
+				Name: "Snapshots",
+				Items: []MenuBarSubMenuItem{
+					MenuBarSubMenuItem{
+						Name: "Take Snapshot",
+						Function: func() {
+							if ui.Conatho != nil {
+								ui.OpenWindowTakeSnapshot()
+							}
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Snapshots",
+						Function: func() {
+							if ui.Conatho != nil {
+								ui.OpenWindowSnapshots()
+							}
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Back to File",
+						Function: func() {
+							ui.StopViewingSnapshot()
+						},
+					},
+				},
+			},
+			MenuBarSubMenu{
+				Name:  "Attributes",
+				Edits: true,
 				Items: []MenuBarSubMenuItem{
 					MenuBarSubMenuItem{
 						Name: "New Type",
@@ -494,6 +1125,36 @@ func (ui *UI) MakeMenuBar() {
 							}
 						},
 					},
+					MenuBarSubMenuItem{
+						Name: "Unique Keys",
+						Function: func() {
+							if ui.Conatho != nil {
+								ui.OpenWindowUniqueKeys()
+							}
+						},
+					},
+				},
+			},
+			MenuBarSubMenu{
+				Name:  "Tools",
+				Edits: true,
+				Items: []MenuBarSubMenuItem{
+					MenuBarSubMenuItem{
+						Name: "Compact",
+						Function: func() {
+							if ui.Conatho != nil {
+								ui.compact()
+							}
+						},
+					},
+					MenuBarSubMenuItem{
+						Name: "Regenerate Thumbnails",
+						Function: func() {
+							if ui.Conatho != nil {
+								ui.regenerateThumbnails()
+							}
+						},
+					},
 				},
 			},
 		},
@@ -580,7 +1241,11 @@ func (ui *UI) MouseDownMenuBar(button uint8, mouseX, mouseY int32) bool {
 		if ui.action == ActionOpenSubmenu {
 			ui.action = ActionNone
 			if item, ok := ui.InSubMenu(ui.menuBarOpenSubMenu, mouseX, mouseY); ok {
-				ui.menuBar.SubMenus[ui.menuBarOpenSubMenu].Items[item].Function()
+				subMenu := ui.menuBar.SubMenus[ui.menuBarOpenSubMenu]
+				if ui.snapshot != nil && (subMenu.Edits || subMenu.Items[item].Edits) {
+					return true
+				}
+				subMenu.Items[item].Function()
 				return true
 			}
 		} else {
@@ -608,11 +1273,19 @@ func (ui *UI) RenderMenuBar() {
 }
 
 func (ui *UI) Render() {
+	ui.runMainThread()
+
+	sdl.SetRenderScale(ui.Renderer, ui.Zoom, ui.Zoom)
 	ui.renderBackground()
 
 	if ui.Conatho != nil {
 		ui.RenderCanvas()
 	}
+	sdl.SetRenderScale(ui.Renderer, 1, 1)
+
+	if ui.snapshot != nil {
+		ui.renderSnapshotBanner()
+	}
 
 	ui.RenderMenuBar()
 
@@ -652,6 +1325,8 @@ func (ui *UI) MouseMotion(relX, relY float32) {
 func (ui *UI) MouseWheel(direction sdl.MouseWheelDirection, x, y, mouseX, mouseY int32) {
 	if ui.window != nil {
 		ui.window.MouseWheel(direction, x, y, mouseX, mouseY)
+	} else if ui.Conatho != nil {
+		ui.MouseWheelCanvas(y, mouseX, mouseY)
 	}
 }
 
@@ -672,5 +1347,16 @@ func (ui *UI) TextInput(text string) {
 func (ui *UI) Drop(drop sdl.DropEvent) {
 	if ui.window != nil {
 		ui.window.Drop(drop)
+	} else if ui.Conatho != nil && ui.snapshot == nil {
+		ui.DropCanvas(drop)
+	}
+}
+
+func (ui *UI) DropComplete() {
+	ui.dropped = 0
+
+	if len(ui.dropFailures) > 0 {
+		ui.OpenWindowReport("Drop Files", strings.Join(ui.dropFailures, "\n"))
+		ui.dropFailures = nil
 	}
 }
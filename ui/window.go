@@ -52,6 +52,9 @@ type hitbox struct {
 type UIWindow struct {
 	ui *UI
 
+	// Name of the panel, used to reopen it when the file is loaded again
+	Name string
+
 	X int32
 	Y int32
 	W int32
@@ -323,6 +326,21 @@ func (win *UIWindow) GetComboBox(identifier string) (int64, error) {
 	return 0, errors.New("combobox not found")
 }
 
+// Select the option with the key
+func (win *UIWindow) SetComboBox(identifier string, key int64) bool {
+	for _, c := range win.Components {
+		if c.Type == UIComponentComboBox && c.Identifier == identifier {
+			for i, k := range c.OptionsKeys {
+				if k == key {
+					c.selected = int64(i)
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 func (win *UIWindow) RenderWindow() {
 	x := win.X
 	y := win.Y